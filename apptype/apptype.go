@@ -20,6 +20,9 @@ const (
 	BrushTypeLine
 	BrushTypeRectangle
 	BrushTypeCircle
+	BrushTypeMarquee   // Rectangular selection, not a painting tool
+	BrushTypeLasso     // Freehand selection, not a painting tool
+	BrushTypeMagicWand // Selection by color, not a painting tool
 )
 
 // String returns a human-readable name for the brush type
@@ -37,6 +40,12 @@ func (bt BrushType) String() string {
 		return "Rectangle"
 	case BrushTypeCircle:
 		return "Circle"
+	case BrushTypeMarquee:
+		return "Marquee"
+	case BrushTypeLasso:
+		return "Lasso"
+	case BrushTypeMagicWand:
+		return "Magic Wand"
 	default:
 		return "Unknown"
 	}
@@ -44,15 +53,175 @@ func (bt BrushType) String() string {
 
 // IsValid checks if the brush type is valid
 func (bt BrushType) IsValid() bool {
-	return bt >= BrushTypePencil && bt <= BrushTypeCircle
+	return bt >= BrushTypePencil && bt <= BrushTypeMagicWand
 }
 
-// Brushable defines the interface for objects that can be painted on
+// IsFreehand reports whether the brush type paints continuously under the mouse while dragging
+func (bt BrushType) IsFreehand() bool {
+	return bt == BrushTypePencil || bt == BrushTypeEraser
+}
+
+// IsShape reports whether the brush type is drawn by dragging between two points
+// rather than painting directly under the mouse
+func (bt BrushType) IsShape() bool {
+	return bt == BrushTypeLine || bt == BrushTypeRectangle || bt == BrushTypeCircle
+}
+
+// IsSelection reports whether the brush type changes the selection instead of painting
+func (bt BrushType) IsSelection() bool {
+	return bt == BrushTypeMarquee || bt == BrushTypeLasso || bt == BrushTypeMagicWand
+}
+
+// FillConnectivity determines which neighbouring pixels the fill tool treats as connected
+type FillConnectivity int
+
+// Fill connectivity constants
+const (
+	FillConnectivity4 FillConnectivity = iota // Orthogonal neighbours only
+	FillConnectivity8                         // Orthogonal and diagonal neighbours
+)
+
+// String returns a human-readable name for the fill connectivity
+func (fc FillConnectivity) String() string {
+	switch fc {
+	case FillConnectivity4:
+		return "4-way"
+	case FillConnectivity8:
+		return "8-way"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the fill connectivity is valid
+func (fc FillConnectivity) IsValid() bool {
+	return fc == FillConnectivity4 || fc == FillConnectivity8
+}
+
+// Fill tolerance limits
+const (
+	MinFillTolerance = 0   // Only exact color matches are filled
+	MaxFillTolerance = 255 // Every color matches
+)
+
+// FillOptions configures the behaviour of the fill tool
+type FillOptions struct {
+	Connectivity FillConnectivity // Which neighbours are considered connected
+	Tolerance    int              // Maximum per-channel difference from the clicked color
+	Global       bool             // Replace every matching pixel, not just the connected region
+}
+
+// Validate checks if the fill options are valid
+func (o FillOptions) Validate() error {
+	if !o.Connectivity.IsValid() {
+		return fmt.Errorf("invalid fill connectivity: %d", o.Connectivity)
+	}
+	if o.Tolerance < MinFillTolerance || o.Tolerance > MaxFillTolerance {
+		return fmt.Errorf("fill tolerance must be between %d and %d, got: %d",
+			MinFillTolerance, MaxFillTolerance, o.Tolerance)
+	}
+	return nil
+}
+
+// Shape stroke width limits
+const (
+	MinStrokeWidth = 1
+	MaxStrokeWidth = 64
+)
+
+// ShapeOptions configures the behaviour of the shape tools
+type ShapeOptions struct {
+	Filled      bool // Fill the shape instead of drawing its outline
+	StrokeWidth int  // Outline thickness in pixels (ignored when filled)
+}
+
+// Validate checks if the shape options are valid
+func (o ShapeOptions) Validate() error {
+	if o.StrokeWidth < MinStrokeWidth || o.StrokeWidth > MaxStrokeWidth {
+		return fmt.Errorf("stroke width must be between %d and %d, got: %d",
+			MinStrokeWidth, MaxStrokeWidth, o.StrokeWidth)
+	}
+	return nil
+}
+
+// WandOptions configures the behaviour of the magic wand selection tool
+type WandOptions struct {
+	Tolerance  int  // Maximum per-channel difference from the clicked color
+	Contiguous bool // Select only the region connected to the clicked pixel
+}
+
+// Validate checks if the magic wand options are valid
+func (o WandOptions) Validate() error {
+	if o.Tolerance < MinFillTolerance || o.Tolerance > MaxFillTolerance {
+		return fmt.Errorf("wand tolerance must be between %d and %d, got: %d",
+			MinFillTolerance, MaxFillTolerance, o.Tolerance)
+	}
+	return nil
+}
+
+// DefaultWandOptions selects the contiguous region of exact color matches.
+// Projects saved without magic wand settings open with it too.
+var DefaultWandOptions = WandOptions{
+	Tolerance:  MinFillTolerance,
+	Contiguous: true,
+}
+
+// Onion skin limits
+const (
+	MinOnionFrames = 0 // No neighbouring frames are shown
+	MaxOnionFrames = 8 // Most neighbouring frames shown on each side
+)
+
+// OnionSkinOptions configures how neighbouring animation frames are shown
+// over the current frame while editing
+type OnionSkinOptions struct {
+	Enabled  bool        // Show neighbouring frames
+	Before   int         // Number of previous frames shown
+	After    int         // Number of following frames shown
+	Opacity  uint8       // Opacity of the nearest frames; further frames fade out
+	PrevTint color.NRGBA // Tint of previous frames; its alpha sets the tint strength
+	NextTint color.NRGBA // Tint of following frames; its alpha sets the tint strength
+}
+
+// Validate checks if the onion skin options are valid
+func (o OnionSkinOptions) Validate() error {
+	if o.Before < MinOnionFrames || o.Before > MaxOnionFrames {
+		return fmt.Errorf("onion skin frames before must be between %d and %d, got: %d",
+			MinOnionFrames, MaxOnionFrames, o.Before)
+	}
+	if o.After < MinOnionFrames || o.After > MaxOnionFrames {
+		return fmt.Errorf("onion skin frames after must be between %d and %d, got: %d",
+			MinOnionFrames, MaxOnionFrames, o.After)
+	}
+	return nil
+}
+
+// DefaultOnionSkin shows one frame either side, previous frames tinted red
+// and following frames tinted blue. Projects saved without onion skin
+// settings open with it too.
+var DefaultOnionSkin = OnionSkinOptions{
+	Enabled:  false,
+	Before:   1,
+	After:    1,
+	Opacity:  96,
+	PrevTint: color.NRGBA{R: 255, G: 64, B: 64, A: 160},
+	NextTint: color.NRGBA{R: 64, G: 128, B: 255, A: 160},
+}
+
+// Brushable defines the interface for objects that can be painted on.
+// On a layered canvas both methods target the active layer.
 type Brushable interface {
 	// SetColor sets the color at the specified canvas coordinates
-	// Returns an error if the operation fails
+	// Returns an error if the operation fails (e.g. the target layer is locked)
 	SetColor(c color.Color, x, y int) error
 
+	// GetPixelColor returns the color at the specified canvas coordinates
+	// Returns an error if the coordinates are outside the canvas
+	GetPixelColor(x, y int) (color.Color, error)
+
+	// GetCanvasSize returns the canvas dimensions in pixels
+	GetCanvasSize() (cols, rows int)
+
 	// MouseToCanvasXY converts mouse event coordinates to canvas coordinates
 	// Returns nil pointers if the coordinates are outside the canvas
 	MouseToCanvasXY(ev *desktop.MouseEvent) (*int, *int)
@@ -92,10 +261,15 @@ func (c PelCanvasConfig) TotalPixels() int {
 
 // State represents the current state of the application
 type State struct {
-	BrushColor     color.Color // Current brush color
-	BrushType      BrushType   // Current brush tool type
-	SwatchSelected int         // Index of the currently selected color swatch
-	FilePath       string      // Path to the currently open file (empty if new/unsaved)
+	BrushColor     color.Color      // Current brush color
+	BrushType      BrushType        // Current brush tool type
+	SwatchSelected int              // Index of the currently selected color swatch
+	FilePath       string           // Path to the currently open file (empty if new/unsaved)
+	FillOptions    FillOptions      // Options used by the fill tool
+	ShapeOptions   ShapeOptions     // Options used by the shape tools
+	OnionSkin      OnionSkinOptions // Display of neighbouring animation frames
+	LockToPalette  bool             // Colors chosen in the picker snap to the nearest swatch
+	WandOptions    WandOptions      // Options used by the magic wand tool
 }
 
 // SetFilePath updates the file path for the current project
@@ -122,6 +296,39 @@ func (s *State) SetSwatchSelected(index int) {
 	}
 }
 
+// SetFillOptions updates the fill tool options
+func (s *State) SetFillOptions(opts FillOptions) {
+	if opts.Validate() == nil {
+		s.FillOptions = opts
+	}
+}
+
+// SetShapeOptions updates the shape tool options
+func (s *State) SetShapeOptions(opts ShapeOptions) {
+	if opts.Validate() == nil {
+		s.ShapeOptions = opts
+	}
+}
+
+// SetOnionSkin updates the onion skin display options
+func (s *State) SetOnionSkin(opts OnionSkinOptions) {
+	if opts.Validate() == nil {
+		s.OnionSkin = opts
+	}
+}
+
+// SetWandOptions updates the magic wand tool options
+func (s *State) SetWandOptions(opts WandOptions) {
+	if opts.Validate() == nil {
+		s.WandOptions = opts
+	}
+}
+
+// SetLockToPalette turns snapping picker colors to the swatches on or off
+func (s *State) SetLockToPalette(locked bool) {
+	s.LockToPalette = locked
+}
+
 // HasUnsavedChanges returns true if there's a file path (indicating the project has been saved)
 func (s *State) HasFilePath() bool {
 	return s.FilePath != ""
@@ -138,5 +345,17 @@ func (s *State) Validate() error {
 	if s.BrushColor == nil {
 		return fmt.Errorf("brush color cannot be nil")
 	}
+	if err := s.FillOptions.Validate(); err != nil {
+		return err
+	}
+	if err := s.ShapeOptions.Validate(); err != nil {
+		return err
+	}
+	if err := s.OnionSkin.Validate(); err != nil {
+		return err
+	}
+	if err := s.WandOptions.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
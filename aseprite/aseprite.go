@@ -0,0 +1,612 @@
+// Package aseprite decodes Aseprite (.ase/.aseprite) files into Pel's
+// document model: frames with their durations, layers with their settings,
+// tags and the palette. It is written in pure Go, following the published
+// file format specification, and also registers the format with the image
+// package so that image.Decode returns the first frame flattened.
+package aseprite
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"path/filepath"
+	"strings"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// File extensions used by Aseprite
+const (
+	FileExtension  = ".aseprite"
+	ShortExtension = ".ase"
+)
+
+// File format constants
+const (
+	formatName       = "aseprite"
+	formatMagic      = "????\xe0\xa5" // File size, then the header magic number
+	headerSize       = 128
+	frameHeaderSize  = 16
+	chunkHeaderSize  = 6
+	headerMagic      = 0xA5E0
+	frameMagic       = 0xF1FA
+	oldChunkCountMax = 0xFFFF  // Old chunk count meaning "see the new field"
+	maxCelPixels     = 1 << 24 // Largest cel accepted, against corrupt sizes
+	maxPaletteSize   = 256     // Most colors a palette holds
+)
+
+// Chunk types
+const (
+	chunkOldPalette   = 0x0004
+	chunkOldPalette64 = 0x0011
+	chunkLayer        = 0x2004
+	chunkCel          = 0x2005
+	chunkTags         = 0x2018
+	chunkPalette      = 0x2019
+)
+
+// Header, layer and palette flags
+const (
+	headerLayerOpacityValid = 1
+	layerVisible            = 1
+	layerEditable           = 2
+	layerBackground         = 8
+	paletteEntryHasName     = 1
+)
+
+// Layer types
+const (
+	layerTypeNormal  = 0
+	layerTypeGroup   = 1
+	layerTypeTilemap = 2
+)
+
+// Cel types
+const (
+	celRaw            = 0
+	celLinked         = 1
+	celCompressed     = 2
+	celCompressedTile = 3
+)
+
+// Aseprite errors
+var (
+	ErrNotAseprite = errors.New("not an aseprite file")
+	ErrTruncated   = errors.New("aseprite file is truncated")
+	ErrNoLayers    = errors.New("aseprite file has no image layers")
+)
+
+// ColorMode is the pixel format of an Aseprite file
+type ColorMode int
+
+// Color mode constants, valued as the bits per pixel stored in the file
+const (
+	ColorModeIndexed   ColorMode = 8
+	ColorModeGrayscale ColorMode = 16
+	ColorModeRGBA      ColorMode = 32
+)
+
+// String returns a human-readable name for the color mode
+func (mode ColorMode) String() string {
+	switch mode {
+	case ColorModeIndexed:
+		return "Indexed"
+	case ColorModeGrayscale:
+		return "Grayscale"
+	case ColorModeRGBA:
+		return "RGBA"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the color mode is valid
+func (mode ColorMode) IsValid() bool {
+	return mode == ColorModeIndexed || mode == ColorModeGrayscale || mode == ColorModeRGBA
+}
+
+// bytesPerPixel returns the size of one pixel in cel data
+func (mode ColorMode) bytesPerPixel() int {
+	return int(mode) / 8
+}
+
+// Document is the content of an Aseprite file mapped onto Pel's model
+type Document struct {
+	Timeline  *animation.Timeline // Frames, each with one Pel layer per Aseprite image layer
+	Palette   []color.NRGBA       // Embedded palette, empty if the file has none
+	ColorMode ColorMode           // Pixel format the file was saved in
+}
+
+// header is the fixed 128 byte file header
+type header struct {
+	frames           int
+	width            int
+	height           int
+	colorMode        ColorMode
+	flags            uint32
+	transparentIndex uint8
+}
+
+// aseLayer is a layer chunk
+type aseLayer struct {
+	flags      uint16
+	layerType  uint16
+	childLevel int
+	blend      uint16
+	opacity    uint8
+	name       string
+}
+
+// aseCel is a cel chunk: the pixels of one layer on one frame
+type aseCel struct {
+	layer   int
+	x, y    int
+	opacity uint8
+	link    int    // Frame holding the pixels of a linked cel, or -1
+	width   int    // Width of the pixel data
+	height  int    // Height of the pixel data
+	pixels  []byte // Uncompressed pixel data in the file's color mode
+}
+
+// aseFrame is one frame and its cels, keyed by layer index
+type aseFrame struct {
+	duration int
+	cels     map[int]*aseCel
+}
+
+// file is everything read from an Aseprite file before it is mapped onto
+// Pel's model. Cels are converted last as indexed pixels need the palette.
+type file struct {
+	header  header
+	layers  []aseLayer
+	frames  []aseFrame
+	tags    []animation.Tag
+	palette []color.NRGBA
+	hasNew  bool // A new palette chunk was read; old palette chunks are ignored
+}
+
+func init() {
+	image.RegisterFormat(formatName, formatMagic, decodeImage, DecodeConfig)
+}
+
+// IsAsepritePath returns true if the path names an Aseprite file
+func IsAsepritePath(path string) bool {
+	ext := filepath.Ext(path)
+	return strings.EqualFold(ext, FileExtension) || strings.EqualFold(ext, ShortExtension)
+}
+
+// Decode reads an Aseprite file. Group layers are flattened away, with a
+// hidden group hiding its children, and tilemap layers are left out. Tags
+// whose names repeat an earlier tag are left out as Pel tag names are unique.
+func Decode(r io.Reader) (*Document, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read aseprite file: %w", err)
+	}
+
+	f, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return f.document()
+}
+
+// DecodeConfig returns the color model and size of an Aseprite file
+// without decoding its frames
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	data := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return image.Config{}, fmt.Errorf("%w: %v", ErrNotAseprite, err)
+	}
+
+	h, err := parseHeader(newReader(data))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: h.width, Height: h.height}, nil
+}
+
+// decodeImage returns the visible layers of the first frame flattened, for
+// image.Decode
+func decodeImage(r io.Reader) (image.Image, error) {
+	doc, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Timeline.Frame(0).Layers.Flatten(), nil
+}
+
+// parse reads the header and every frame of an Aseprite file
+func parse(data []byte) (*file, error) {
+	r := newReader(data)
+	h, err := parseHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &file{header: h}
+	for i := 0; i < h.frames; i++ {
+		frame, err := f.parseFrame(r)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		f.frames = append(f.frames, frame)
+	}
+	return f, nil
+}
+
+// parseHeader reads and checks the file header
+func parseHeader(r *reader) (header, error) {
+	r.dword() // File size
+	magic := r.word()
+	h := header{
+		frames: int(r.word()),
+		width:  int(r.word()),
+		height: int(r.word()),
+	}
+	h.colorMode = ColorMode(r.word())
+	h.flags = r.dword()
+	r.skip(2 + 4 + 4) // Deprecated speed and two reserved DWORDs
+	h.transparentIndex = r.byte()
+	r.skip(headerSize - 29) // Rest of the header: color count, pixel ratio, grid
+
+	if r.err != nil {
+		return header{}, fmt.Errorf("%w: %v", ErrNotAseprite, r.err)
+	}
+	if magic != headerMagic {
+		return header{}, ErrNotAseprite
+	}
+	if !h.colorMode.IsValid() {
+		return header{}, fmt.Errorf("unsupported color depth: %d", h.colorMode)
+	}
+	if h.width <= 0 || h.height <= 0 {
+		return header{}, fmt.Errorf("invalid image dimensions: %dx%d", h.width, h.height)
+	}
+	if h.frames <= 0 {
+		return header{}, fmt.Errorf("file has no frames")
+	}
+	return h, nil
+}
+
+// parseFrame reads a frame header and its chunks
+func (f *file) parseFrame(r *reader) (aseFrame, error) {
+	start := r.pos
+	size := int(r.dword())
+	magic := r.word()
+	chunks := int(r.word())
+	frame := aseFrame{duration: int(r.word()), cels: make(map[int]*aseCel)}
+	r.skip(2)
+	if newChunks := int(r.dword()); newChunks != 0 || chunks == oldChunkCountMax {
+		chunks = newChunks
+	}
+
+	if r.err != nil {
+		return aseFrame{}, r.err
+	}
+	if magic != frameMagic {
+		return aseFrame{}, fmt.Errorf("invalid frame magic number: %#x", magic)
+	}
+	if size < frameHeaderSize || size > len(r.data)-start {
+		return aseFrame{}, fmt.Errorf("%w: frame of %d bytes", ErrTruncated, size)
+	}
+
+	body := newReader(r.data[r.pos : start+size])
+	r.pos = start + size
+	for i := 0; i < chunks && body.remaining() > 0; i++ {
+		chunkSize := int(body.dword())
+		chunkType := body.word()
+		data := body.bytes(chunkSize - chunkHeaderSize)
+		if body.err != nil {
+			return aseFrame{}, body.err
+		}
+
+		if err := f.parseChunk(&frame, chunkType, newReader(data)); err != nil {
+			return aseFrame{}, fmt.Errorf("chunk %#04x: %w", chunkType, err)
+		}
+	}
+	return frame, nil
+}
+
+// parseChunk reads the chunk types Pel uses. Other chunks, such as color
+// profiles, slices, tilesets and user data, are skipped.
+func (f *file) parseChunk(frame *aseFrame, chunkType uint16, r *reader) error {
+	switch chunkType {
+	case chunkLayer:
+		f.parseLayer(r)
+	case chunkCel:
+		return f.parseCel(frame, r)
+	case chunkTags:
+		f.parseTags(r)
+	case chunkPalette:
+		f.parsePalette(r)
+	case chunkOldPalette, chunkOldPalette64:
+		if !f.hasNew {
+			f.parseOldPalette(r, chunkType == chunkOldPalette64)
+		}
+	}
+	return r.err
+}
+
+// parseLayer reads a layer chunk
+func (f *file) parseLayer(r *reader) {
+	l := aseLayer{
+		flags:      r.word(),
+		layerType:  r.word(),
+		childLevel: int(r.word()),
+	}
+	r.skip(4) // Default width and height, ignored by Aseprite
+	l.blend = r.word()
+	l.opacity = r.byte()
+	r.skip(3)
+	l.name = r.string()
+
+	if f.header.flags&headerLayerOpacityValid == 0 {
+		l.opacity = layer.MaxOpacity
+	}
+	f.layers = append(f.layers, l)
+}
+
+// parseCel reads a cel chunk. Tilemap cels are skipped.
+func (f *file) parseCel(frame *aseFrame, r *reader) error {
+	cel := &aseCel{
+		layer:   int(r.word()),
+		x:       int(r.short()),
+		y:       int(r.short()),
+		opacity: r.byte(),
+		link:    -1,
+	}
+	celType := r.word()
+	r.skip(2 + 5) // Z-index and reserved bytes
+
+	switch celType {
+	case celLinked:
+		cel.link = int(r.word())
+	case celRaw, celCompressed:
+		cel.width = int(r.word())
+		cel.height = int(r.word())
+		if cel.width*cel.height > maxCelPixels {
+			return fmt.Errorf("cel too large: %dx%d", cel.width, cel.height)
+		}
+		size := cel.width * cel.height * f.header.colorMode.bytesPerPixel()
+		if celType == celRaw {
+			cel.pixels = r.bytes(size)
+			break
+		}
+
+		zr, err := zlib.NewReader(bytes.NewReader(r.bytes(r.remaining())))
+		if err != nil {
+			return fmt.Errorf("failed to decompress cel: %w", err)
+		}
+		cel.pixels = make([]byte, size)
+		if _, err := io.ReadFull(zr, cel.pixels); err != nil {
+			return fmt.Errorf("failed to decompress cel: %w", err)
+		}
+	case celCompressedTile:
+		return nil
+	default:
+		return fmt.Errorf("unknown cel type: %d", celType)
+	}
+
+	frame.cels[cel.layer] = cel
+	return r.err
+}
+
+// parseTags reads a tags chunk
+func (f *file) parseTags(r *reader) {
+	count := int(r.word())
+	r.skip(8)
+	for i := 0; i < count && r.err == nil; i++ {
+		tag := animation.Tag{From: int(r.word()), To: int(r.word())}
+		tag.Direction = aseDirection(r.byte())
+		r.skip(2 + 6 + 3 + 1) // Repeat count, reserved, deprecated color, extra byte
+		tag.Name = r.string()
+		f.tags = append(f.tags, tag)
+	}
+}
+
+// parsePalette reads a palette chunk, growing the palette to its new size.
+// Chunks with a palette larger than maxPaletteSize are ignored.
+func (f *file) parsePalette(r *reader) {
+	size := int(r.dword())
+	first := int(r.dword())
+	last := int(r.dword())
+	r.skip(8)
+	if r.err != nil || first > last || last >= size || size > maxPaletteSize {
+		return
+	}
+
+	f.hasNew = true
+	f.growPalette(size)
+	for i := first; i <= last && r.err == nil; i++ {
+		flags := r.word()
+		f.palette[i] = color.NRGBA{R: r.byte(), G: r.byte(), B: r.byte(), A: r.byte()}
+		if flags&paletteEntryHasName != 0 {
+			r.string()
+		}
+	}
+}
+
+// parseOldPalette reads a palette chunk from older files, whose components
+// are 0-255 or, for sixBit chunks, 0-63
+func (f *file) parseOldPalette(r *reader, sixBit bool) {
+	packets := int(r.word())
+	index := 0
+	for p := 0; p < packets && r.err == nil; p++ {
+		index += int(r.byte())
+		count := int(r.byte())
+		if count == 0 {
+			count = 256
+		}
+		f.growPalette(index + count)
+		for i := 0; i < count && r.err == nil; i++ {
+			c := color.NRGBA{R: r.byte(), G: r.byte(), B: r.byte(), A: 255}
+			if sixBit {
+				c.R, c.G, c.B = scale6(c.R), scale6(c.G), scale6(c.B)
+			}
+			f.palette[index] = c
+			index++
+		}
+	}
+}
+
+// growPalette extends the palette with opaque black up to size entries
+func (f *file) growPalette(size int) {
+	for len(f.palette) < size {
+		f.palette = append(f.palette, color.NRGBA{A: 255})
+	}
+}
+
+// scale6 converts a 0-63 color component to 0-255
+func scale6(v uint8) uint8 {
+	return uint8(int(v&63) * 255 / 63)
+}
+
+// aseDirection converts an Aseprite loop direction. Ping-pong reverse has no
+// Pel equivalent and becomes ping-pong.
+func aseDirection(d uint8) animation.Direction {
+	switch d {
+	case 1:
+		return animation.DirectionReverse
+	case 2, 3:
+		return animation.DirectionPingPong
+	default:
+		return animation.DirectionForward
+	}
+}
+
+// aseBlendModes maps Aseprite blend modes to Pel's. Modes Pel lacks, such as
+// dodge, burn or hue, fall back to normal.
+var aseBlendModes = map[uint16]layer.BlendMode{
+	0:  layer.BlendNormal,
+	1:  layer.BlendMultiply,
+	2:  layer.BlendScreen,
+	3:  layer.BlendOverlay,
+	4:  layer.BlendDarken,
+	5:  layer.BlendLighten,
+	10: layer.BlendDifference,
+	14: layer.BlendColor,
+	16: layer.BlendAdditive,
+}
+
+// document maps the parsed file onto Pel's model
+func (f *file) document() (*Document, error) {
+	// Pel layers are flat: keep image layers, hiding those inside hidden groups
+	var properties []layer.Properties
+	var backgrounds []bool
+	pelIndex := make([]int, len(f.layers))
+	var groupVisible []bool // Visibility of the enclosing groups, by child level
+	for i, l := range f.layers {
+		pelIndex[i] = -1
+		groupVisible = groupVisible[:min(l.childLevel, len(groupVisible))]
+		visible := l.flags&layerVisible != 0
+		for _, v := range groupVisible {
+			visible = visible && v
+		}
+
+		switch l.layerType {
+		case layerTypeGroup:
+			groupVisible = append(groupVisible, visible)
+		case layerTypeNormal:
+			pelIndex[i] = len(properties)
+			properties = append(properties, layer.Properties{
+				Name:    l.name,
+				Visible: visible,
+				Opacity: l.opacity,
+				Locked:  l.flags&layerEditable == 0,
+				Blend:   aseBlendModes[l.blend],
+			})
+			backgrounds = append(backgrounds, l.flags&layerBackground != 0)
+		}
+	}
+	if len(properties) == 0 {
+		return nil, ErrNoLayers
+	}
+
+	frames := make([]*animation.Frame, 0, len(f.frames))
+	for i, aseFrame := range f.frames {
+		layers := make([]*layer.Layer, len(properties))
+		for j, props := range properties {
+			layers[j] = layer.New(props.Name, f.header.width, f.header.height)
+			layers[j].Properties = props
+		}
+
+		for aseIndex, cel := range aseFrame.cels {
+			if aseIndex < 0 || aseIndex >= len(pelIndex) || pelIndex[aseIndex] < 0 {
+				continue
+			}
+			if cel.link >= 0 {
+				cel = f.linkedCel(cel)
+				if cel == nil {
+					continue
+				}
+			}
+			j := pelIndex[aseIndex]
+			f.drawCel(layers[j].Image, cel, backgrounds[j])
+		}
+
+		stack, err := layer.NewStackFromLayers(layers, len(layers)-1)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+		frame := animation.NewFrame(stack)
+		frame.Duration = min(max(aseFrame.duration, animation.MinDuration), animation.MaxDuration)
+		frames = append(frames, frame)
+	}
+
+	timeline, err := animation.NewTimelineFromFrames(frames, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range f.tags {
+		if err := timeline.AddTag(tag); err != nil && !errors.Is(err, animation.ErrDuplicateTag) {
+			return nil, fmt.Errorf("tag %q: %w", tag.Name, err)
+		}
+	}
+
+	return &Document{Timeline: timeline, Palette: f.palette, ColorMode: f.header.colorMode}, nil
+}
+
+// linkedCel returns the cel a linked cel shares its pixels with, taking its
+// position and opacity too as Aseprite does
+func (f *file) linkedCel(cel *aseCel) *aseCel {
+	if cel.link >= len(f.frames) {
+		return nil
+	}
+	linked := f.frames[cel.link].cels[cel.layer]
+	if linked == nil || linked.link >= 0 {
+		return nil
+	}
+	return linked
+}
+
+// drawCel converts a cel's pixels to NRGBA and draws them on dst at the cel
+// position, scaled by the cel opacity
+func (f *file) drawCel(dst *image.NRGBA, cel *aseCel, background bool) {
+	src := image.NewNRGBA(image.Rect(cel.x, cel.y, cel.x+cel.width, cel.y+cel.height))
+	bpp := f.header.colorMode.bytesPerPixel()
+	for i := 0; i < cel.width*cel.height; i++ {
+		p := cel.pixels[i*bpp : (i+1)*bpp]
+
+		var c color.NRGBA
+		switch f.header.colorMode {
+		case ColorModeRGBA:
+			c = color.NRGBA{R: p[0], G: p[1], B: p[2], A: p[3]}
+		case ColorModeGrayscale:
+			c = color.NRGBA{R: p[0], G: p[0], B: p[0], A: p[1]}
+		case ColorModeIndexed:
+			// The transparent index is only transparent outside background layers
+			if int(p[0]) < len(f.palette) && (background || p[0] != f.header.transparentIndex) {
+				c = f.palette[p[0]]
+			}
+		}
+		c.A = uint8(int(c.A) * int(cel.opacity) / 255)
+		src.Pix[i*4], src.Pix[i*4+1], src.Pix[i*4+2], src.Pix[i*4+3] = c.R, c.G, c.B, c.A
+	}
+
+	draw.Draw(dst, src.Rect, src, src.Rect.Min, draw.Src)
+}
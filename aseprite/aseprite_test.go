@@ -0,0 +1,225 @@
+package aseprite
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// decodeFixture decodes a file from testdata
+func decodeFixture(t *testing.T, name string) *Document {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode(%s): %v", name, err)
+	}
+	return doc
+}
+
+// checkPixel compares one pixel of a layer image
+func checkPixel(t *testing.T, l *layer.Layer, x, y int, want color.NRGBA) {
+	t.Helper()
+	if got := l.Image.NRGBAAt(x, y); got != want {
+		t.Errorf("layer %q pixel (%d, %d) = %v, want %v", l.Name, x, y, got, want)
+	}
+}
+
+func TestDecodeRGBA(t *testing.T) {
+	doc := decodeFixture(t, "rgba.aseprite")
+	if doc.ColorMode != ColorModeRGBA {
+		t.Errorf("ColorMode = %v, want %v", doc.ColorMode, ColorModeRGBA)
+	}
+	if cols, rows := doc.Timeline.Size(); cols != 4 || rows != 2 {
+		t.Errorf("Size() = %dx%d, want 4x2", cols, rows)
+	}
+	if doc.Timeline.Len() != 1 || doc.Timeline.Frame(0).Duration != 120 {
+		t.Fatalf("got %d frames, first lasting %d ms, want 1 frame of 120 ms",
+			doc.Timeline.Len(), doc.Timeline.Frame(0).Duration)
+	}
+
+	// The group is flattened away and hides its child
+	layers := doc.Timeline.Frame(0).Layers.Layers()
+	want := []layer.Properties{
+		{Name: "Background", Visible: true, Opacity: 255, Blend: layer.BlendNormal},
+		{Name: "Child", Visible: false, Opacity: 255, Blend: layer.BlendNormal},
+		{Name: "Ink", Visible: true, Opacity: 128, Locked: true, Blend: layer.BlendMultiply},
+	}
+	if len(layers) != len(want) {
+		t.Fatalf("got %d layers, want %d", len(layers), len(want))
+	}
+	for i, l := range layers {
+		if l.Properties != want[i] {
+			t.Errorf("layer %d = %+v, want %+v", i, l.Properties, want[i])
+		}
+	}
+
+	checkPixel(t, layers[0], 3, 1, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+	checkPixel(t, layers[1], 0, 0, color.NRGBA{R: 1, G: 2, B: 3, A: 255})
+	checkPixel(t, layers[2], 0, 1, color.NRGBA{})
+	checkPixel(t, layers[2], 1, 1, color.NRGBA{B: 255, A: 255})
+	checkPixel(t, layers[2], 2, 1, color.NRGBA{G: 255, A: 64})
+	if len(doc.Palette) != 0 {
+		t.Errorf("got %d palette colors, want none", len(doc.Palette))
+	}
+}
+
+func TestDecodeGrayscale(t *testing.T) {
+	doc := decodeFixture(t, "grayscale.aseprite")
+	if doc.ColorMode != ColorModeGrayscale {
+		t.Errorf("ColorMode = %v, want %v", doc.ColorMode, ColorModeGrayscale)
+	}
+
+	// Cel opacity scales the alpha of every pixel
+	l := doc.Timeline.Frame(0).Layers.Layer(0)
+	checkPixel(t, l, 0, 0, color.NRGBA{A: 128})
+	checkPixel(t, l, 1, 0, color.NRGBA{R: 128, G: 128, B: 128, A: 128})
+	checkPixel(t, l, 0, 1, color.NRGBA{R: 255, G: 255, B: 255, A: 64})
+	checkPixel(t, l, 1, 1, color.NRGBA{R: 64, G: 64, B: 64})
+}
+
+func TestDecodeIndexed(t *testing.T) {
+	doc := decodeFixture(t, "indexed.aseprite")
+	if doc.ColorMode != ColorModeIndexed {
+		t.Errorf("ColorMode = %v, want %v", doc.ColorMode, ColorModeIndexed)
+	}
+
+	palette := []color.NRGBA{{A: 255}, {R: 255, A: 255}, {G: 255, A: 255}, {B: 255, A: 255}}
+	if !slices.Equal(doc.Palette, palette) {
+		t.Errorf("Palette = %v, want %v", doc.Palette, palette)
+	}
+
+	// The transparent index is opaque on the background layer only
+	layers := doc.Timeline.Frame(0).Layers.Layers()
+	checkPixel(t, layers[0], 0, 0, color.NRGBA{A: 255})
+	checkPixel(t, layers[0], 1, 0, color.NRGBA{R: 255, A: 255})
+	checkPixel(t, layers[0], 2, 0, color.NRGBA{G: 255, A: 255})
+	checkPixel(t, layers[1], 0, 0, color.NRGBA{})
+	checkPixel(t, layers[1], 1, 0, color.NRGBA{B: 255, A: 255})
+	checkPixel(t, layers[1], 2, 0, color.NRGBA{})
+}
+
+func TestDecodeLinkedCelsAndTags(t *testing.T) {
+	doc := decodeFixture(t, "linked_tags.aseprite")
+	timeline := doc.Timeline
+
+	// Durations below the minimum are clamped
+	durations := []int{100, 150, animation.MinDuration}
+	if timeline.Len() != len(durations) {
+		t.Fatalf("got %d frames, want %d", timeline.Len(), len(durations))
+	}
+	for i, want := range durations {
+		if got := timeline.Frame(i).Duration; got != want {
+			t.Errorf("frame %d lasts %d ms, want %d", i, got, want)
+		}
+	}
+
+	red, green := color.NRGBA{R: 255, A: 255}, color.NRGBA{G: 255, A: 255}
+	first := timeline.Frame(0).Layers.Layer(0)
+	linked := timeline.Frame(1).Layers.Layer(0)
+	last := timeline.Frame(2).Layers.Layer(0)
+	checkPixel(t, first, 0, 0, red)
+	checkPixel(t, linked, 0, 0, red)
+	checkPixel(t, last, 0, 0, color.NRGBA{})
+	checkPixel(t, last, 1, 1, green)
+
+	// Linked cels become independent copies in Pel
+	if &first.Image.Pix[0] == &linked.Image.Pix[0] {
+		t.Error("linked cel shares pixels with the cel it links to")
+	}
+
+	tags := []animation.Tag{
+		{Name: "idle", From: 0, To: 1, Direction: animation.DirectionForward},
+		{Name: "walk", From: 1, To: 2, Direction: animation.DirectionPingPong},
+		{Name: "back", From: 2, To: 2, Direction: animation.DirectionReverse},
+	}
+	if got := timeline.Tags(); !slices.Equal(got, tags) {
+		t.Errorf("Tags() = %v, want %v", got, tags)
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "indexed.aseprite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != formatName || config.Width != 3 || config.Height != 1 {
+		t.Fatalf("DecodeConfig() = %+v, %q, %v, want 3x1 %s", config, format, err, formatName)
+	}
+
+	// The first frame is flattened with the sprite over the background
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(1, 0)); got != (color.NRGBA{B: 255, A: 255}) {
+		t.Errorf("flattened pixel (1, 0) = %v, want blue", got)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "rgba.aseprite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Decode(bytes.NewReader(data[:headerSize-1])); err == nil {
+		t.Error("Decode() of a short header succeeded")
+	}
+	if _, err := Decode(bytes.NewReader(data[:len(data)-10])); err == nil {
+		t.Error("Decode() of a truncated frame succeeded")
+	}
+
+	corrupt := slices.Clone(data)
+	corrupt[4] = 0
+	if _, err := Decode(bytes.NewReader(corrupt)); err != ErrNotAseprite {
+		t.Errorf("Decode() of a bad magic number = %v, want %v", err, ErrNotAseprite)
+	}
+}
+
+func TestDecodeOversizedPalette(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "indexed.aseprite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The palette size follows the chunk size and type of the palette chunk
+	chunk := bytes.Index(data, []byte{chunkPalette & 0xFF, chunkPalette >> 8})
+	if chunk < 0 {
+		t.Fatal("no palette chunk in indexed.aseprite")
+	}
+	corrupt := slices.Clone(data)
+	copy(corrupt[chunk+2:], []byte{0xFF, 0xFF, 0xFF, 0x7F})
+
+	doc, err := Decode(bytes.NewReader(corrupt))
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(doc.Palette) > maxPaletteSize {
+		t.Errorf("len(Palette) = %d, want at most %d", len(doc.Palette), maxPaletteSize)
+	}
+}
+
+func TestIsAsepritePath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"walk.aseprite": true,
+		"walk.ASE":      true,
+		"walk.png":      false,
+		"aseprite":      false,
+	} {
+		if got := IsAsepritePath(path); got != want {
+			t.Errorf("IsAsepritePath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
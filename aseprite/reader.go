@@ -0,0 +1,80 @@
+// Package aseprite provides little-endian reading of Aseprite file data.
+package aseprite
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// reader reads the little-endian values of the Aseprite format from a byte
+// slice. The first read past the end is remembered in err and every later
+// read returns zero values, so a whole record can be read before checking.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// newReader creates a reader over data
+func newReader(data []byte) *reader {
+	return &reader{data: data}
+}
+
+// bytes returns the next n bytes without copying them
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data)-r.pos {
+		r.err = fmt.Errorf("%w: need %d bytes at offset %d", ErrTruncated, n, r.pos)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// skip moves past the next n bytes
+func (r *reader) skip(n int) {
+	r.bytes(n)
+}
+
+// byte reads a BYTE
+func (r *reader) byte() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// word reads a WORD, an unsigned 16-bit integer
+func (r *reader) word() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+// short reads a SHORT, a signed 16-bit integer
+func (r *reader) short() int16 {
+	return int16(r.word())
+}
+
+// dword reads a DWORD, an unsigned 32-bit integer
+func (r *reader) dword() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// string reads a STRING, a WORD length followed by that many UTF-8 bytes
+func (r *reader) string() string {
+	n := int(r.word())
+	return string(r.bytes(n))
+}
+
+// remaining returns the number of unread bytes
+func (r *reader) remaining() int {
+	return len(r.data) - r.pos
+}
@@ -0,0 +1,326 @@
+// Package dither provides ordered and error-diffusion dithering of images
+// to a fixed palette. It has no UI dependencies.
+package dither
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"github.com/carlomunguia/pel/palette"
+)
+
+// Method selects the dithering algorithm
+type Method int
+
+// Dithering methods
+const (
+	MethodNone           Method = iota // Nearest palette color, no dithering
+	MethodBayer2                       // Ordered dithering with a 2x2 Bayer matrix
+	MethodBayer4                       // Ordered dithering with a 4x4 Bayer matrix
+	MethodBayer8                       // Ordered dithering with an 8x8 Bayer matrix
+	MethodFloydSteinberg               // Error diffusion to four neighbours
+	MethodAtkinson                     // Error diffusion of 3/4 of the error to six neighbours
+	MethodCheckerboard                 // Alternates the two nearest colors in a checkerboard
+)
+
+// Methods lists every dithering method in display order
+var Methods = []Method{
+	MethodNone,
+	MethodBayer2,
+	MethodBayer4,
+	MethodBayer8,
+	MethodFloydSteinberg,
+	MethodAtkinson,
+	MethodCheckerboard,
+}
+
+// String returns the display name of the method
+func (m Method) String() string {
+	switch m {
+	case MethodNone:
+		return "None"
+	case MethodBayer2:
+		return "Bayer 2x2"
+	case MethodBayer4:
+		return "Bayer 4x4"
+	case MethodBayer8:
+		return "Bayer 8x8"
+	case MethodFloydSteinberg:
+		return "Floyd-Steinberg"
+	case MethodAtkinson:
+		return "Atkinson"
+	case MethodCheckerboard:
+		return "Checkerboard"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid returns true if the method is a known method
+func (m Method) IsValid() bool {
+	return m >= MethodNone && m <= MethodCheckerboard
+}
+
+// Strength limits
+const (
+	MinStrength     = 0.0
+	MaxStrength     = 1.0
+	DefaultStrength = 1.0
+)
+
+// MaxColors is the largest palette that can be dithered to
+const MaxColors = 256
+
+// ErrEmptyPalette is returned when there are no colors to dither to
+var ErrEmptyPalette = errors.New("palette has no colors")
+
+// Options controls how an image is dithered
+type Options struct {
+	Method   Method         // Dithering algorithm
+	Strength float64        // Amount of dithering, from MinStrength (none) to MaxStrength (full)
+	Metric   palette.Metric // How the nearest palette color is chosen
+}
+
+// DefaultOptions returns full-strength Floyd-Steinberg dithering with
+// perceptual color matching
+func DefaultOptions() Options {
+	return Options{Method: MethodFloydSteinberg, Strength: DefaultStrength, Metric: palette.MetricOKLab}
+}
+
+// Validate checks if the options are valid
+func (opts Options) Validate() error {
+	if !opts.Method.IsValid() {
+		return fmt.Errorf("invalid dithering method: %d", opts.Method)
+	}
+	if opts.Strength < MinStrength || opts.Strength > MaxStrength || math.IsNaN(opts.Strength) {
+		return fmt.Errorf("strength must be between %g and %g, got: %g", MinStrength, MaxStrength, opts.Strength)
+	}
+	if !opts.Metric.IsValid() {
+		return fmt.Errorf("invalid color metric: %d", opts.Metric)
+	}
+	return nil
+}
+
+// Bayer threshold matrices; entries run from 0 to n*n-1
+var (
+	bayer2 = [][]int{
+		{0, 2},
+		{3, 1},
+	}
+	bayer4 = [][]int{
+		{0, 8, 2, 10},
+		{12, 4, 14, 6},
+		{3, 11, 1, 9},
+		{15, 7, 13, 5},
+	}
+	bayer8 = [][]int{
+		{0, 32, 8, 40, 2, 34, 10, 42},
+		{48, 16, 56, 24, 50, 18, 58, 26},
+		{12, 44, 4, 36, 14, 46, 6, 38},
+		{60, 28, 52, 20, 62, 30, 54, 22},
+		{3, 35, 11, 43, 1, 33, 9, 41},
+		{51, 19, 59, 27, 49, 17, 57, 25},
+		{15, 47, 7, 39, 13, 45, 5, 37},
+		{63, 31, 55, 23, 61, 29, 53, 21},
+	}
+)
+
+// diffusion is one neighbour receiving a share of a pixel's error
+type diffusion struct {
+	dx, dy int
+	weight float64
+}
+
+// Error diffusion kernels
+var (
+	floydSteinberg = []diffusion{
+		{1, 0, 7.0 / 16}, {-1, 1, 3.0 / 16}, {0, 1, 5.0 / 16}, {1, 1, 1.0 / 16},
+	}
+	atkinson = []diffusion{
+		{1, 0, 1.0 / 8}, {2, 0, 1.0 / 8}, {-1, 1, 1.0 / 8}, {0, 1, 1.0 / 8}, {1, 1, 1.0 / 8}, {0, 2, 1.0 / 8},
+	}
+)
+
+// Apply dithers img to the given colors and returns the index of the chosen
+// color for every pixel. Fully transparent pixels are skipped; their
+// indices are meaningless and the caller should leave them alone.
+func Apply(img *image.NRGBA, colors []color.Color, opts Options) (*image.Paletted, error) {
+	if img == nil {
+		return nil, fmt.Errorf("image cannot be nil")
+	}
+	if len(colors) == 0 {
+		return nil, ErrEmptyPalette
+	}
+	if len(colors) > MaxColors {
+		return nil, fmt.Errorf("palette has %d colors, at most %d", len(colors), MaxColors)
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	d := &ditherer{
+		img:     img,
+		colors:  make([][3]float64, len(colors)),
+		matcher: palette.NewMatcher(colors, opts.Metric),
+		opts:    opts,
+		out:     image.NewPaletted(img.Rect, colors),
+	}
+	for i, c := range colors {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		d.colors[i] = [3]float64{float64(n.R), float64(n.G), float64(n.B)}
+	}
+
+	switch opts.Method {
+	case MethodBayer2:
+		d.ordered(bayer2)
+	case MethodBayer4:
+		d.ordered(bayer4)
+	case MethodBayer8:
+		d.ordered(bayer8)
+	case MethodFloydSteinberg:
+		d.diffuse(floydSteinberg)
+	case MethodAtkinson:
+		d.diffuse(atkinson)
+	case MethodCheckerboard:
+		d.checkerboard()
+	default:
+		d.ordered(nil)
+	}
+	return d.out, nil
+}
+
+// ditherer holds the state of one Apply call
+type ditherer struct {
+	img     *image.NRGBA
+	colors  [][3]float64 // Palette colors as RGB components
+	matcher *palette.Matcher
+	opts    Options
+	out     *image.Paletted
+}
+
+// nearest returns the palette index closest to an RGB color
+func (d *ditherer) nearest(rgb [3]float64) int {
+	return d.matcher.Nearest(color.NRGBA{R: clamp8(rgb[0]), G: clamp8(rgb[1]), B: clamp8(rgb[2]), A: 255})
+}
+
+// spread returns the amplitude of ordered dithering: the average distance
+// between neighbouring palette colors along one channel, scaled by strength
+func (d *ditherer) spread() float64 {
+	return d.opts.Strength * 255 / math.Max(1, math.Cbrt(float64(len(d.colors))))
+}
+
+// ordered offsets every pixel by the Bayer threshold at its position before
+// choosing the nearest color. A nil matrix maps straight to the nearest color.
+func (d *ditherer) ordered(matrix [][]int) {
+	spread := d.spread()
+	bounds := d.img.Rect
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := d.img.NRGBAAt(x, y)
+			if c.A == 0 {
+				continue
+			}
+
+			offset := 0.0
+			if n := len(matrix); n > 0 {
+				threshold := (float64(matrix[mod(y, n)][mod(x, n)])+0.5)/float64(n*n) - 0.5
+				offset = threshold * spread
+			}
+			rgb := [3]float64{float64(c.R) + offset, float64(c.G) + offset, float64(c.B) + offset}
+			d.out.SetColorIndex(x, y, uint8(d.nearest(rgb)))
+		}
+	}
+}
+
+// diffuse maps pixels to the nearest color from left to right and top to
+// bottom, passing each pixel's error on to its unvisited neighbours
+func (d *ditherer) diffuse(kernel []diffusion) {
+	bounds := d.img.Rect
+	w, h := bounds.Dx(), bounds.Dy()
+	errs := make([][3]float64, w*h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := d.img.NRGBAAt(bounds.Min.X+x, bounds.Min.Y+y)
+			if c.A == 0 {
+				continue
+			}
+
+			e := errs[y*w+x]
+			rgb := [3]float64{float64(c.R) + e[0], float64(c.G) + e[1], float64(c.B) + e[2]}
+			i := d.nearest(rgb)
+			d.out.SetColorIndex(bounds.Min.X+x, bounds.Min.Y+y, uint8(i))
+
+			for _, k := range kernel {
+				nx, ny := x+k.dx, y+k.dy
+				if nx < 0 || nx >= w || ny >= h {
+					continue
+				}
+				for ch := range rgb {
+					errs[ny*w+nx][ch] += (rgb[ch] - d.colors[i][ch]) * k.weight * d.opts.Strength
+				}
+			}
+		}
+	}
+}
+
+// checkerboard uses the nearest color, except where the half-way mix of the
+// two nearest colors is closer; there it alternates the two in a
+// checkerboard. Lower strengths require the mix to be a closer match.
+func (d *ditherer) checkerboard() {
+	bounds := d.img.Rect
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := d.img.NRGBAAt(x, y)
+			if c.A == 0 {
+				continue
+			}
+
+			rgb := [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+			first, second := d.twoNearest(rgb)
+			chosen := first
+			if second >= 0 {
+				a, b := d.colors[first], d.colors[second]
+				mix := [3]float64{(a[0] + b[0]) / 2, (a[1] + b[1]) / 2, (a[2] + b[2]) / 2}
+				if distance(rgb, mix) < distance(rgb, a)*d.opts.Strength && mod(x+y, 2) == 1 {
+					chosen = second
+				}
+			}
+			d.out.SetColorIndex(x, y, uint8(chosen))
+		}
+	}
+}
+
+// twoNearest returns the nearest and second nearest palette indices to an
+// RGB color, or -1 for the second if the palette has one color
+func (d *ditherer) twoNearest(rgb [3]float64) (int, int) {
+	first := d.nearest(rgb)
+	second, secondDistance := -1, math.Inf(1)
+	for i, c := range d.colors {
+		if i == first || c == d.colors[first] {
+			continue
+		}
+		if dist := distance(rgb, c); dist < secondDistance {
+			second, secondDistance = i, dist
+		}
+	}
+	return first, second
+}
+
+// distance returns the squared Euclidean distance between two RGB colors
+func distance(a, b [3]float64) float64 {
+	dr, dg, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dr*dr + dg*dg + db*db
+}
+
+// clamp8 rounds a color component and clamps it to 0-255
+func clamp8(v float64) uint8 {
+	return uint8(math.Round(min(max(v, 0), 255)))
+}
+
+// mod returns the non-negative remainder of a divided by n
+func mod(a, n int) int {
+	return ((a % n) + n) % n
+}
@@ -0,0 +1,256 @@
+// Package palette provides the binary palette formats: Adobe .act color
+// tables and Adobe .ase swatch exchange files.
+package palette
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"unicode/utf16"
+)
+
+// Adobe color table constants
+const (
+	maxACTColors     = 256
+	actTableSize     = maxACTColors * 3
+	actExtendedSize  = actTableSize + 4 // Table followed by the color count and transparent index
+	actNoTransparent = 0xFFFF           // Transparent index meaning "none"
+)
+
+// Adobe swatch exchange constants
+const (
+	aseSignature    = "ASEF"
+	aseVersionMajor = 1
+	aseVersionMinor = 0
+	aseGroupStart   = 0xC001
+	aseGroupEnd     = 0xC002
+	aseColorEntry   = 0x0001
+	aseColorNormal  = 2
+	aseModelRGB     = "RGB "
+	aseModelCMYK    = "CMYK"
+	aseModelLAB     = "LAB "
+	aseModelGray    = "Gray"
+)
+
+// CIELAB D50 reference white, used by Adobe for LAB swatches
+const (
+	labWhiteX = 0.96422
+	labWhiteY = 1.0
+	labWhiteZ = 0.82521
+)
+
+// decodeACT reads an Adobe color table: 256 RGB triples, optionally followed
+// by the number of colors used and the index of the transparent color
+func decodeACT(r io.Reader) (*Palette, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != actTableSize && len(data) != actExtendedSize {
+		return nil, fmt.Errorf("color table is %d bytes, expected %d or %d", len(data), actTableSize, actExtendedSize)
+	}
+
+	count, transparent := maxACTColors, actNoTransparent
+	if len(data) == actExtendedSize {
+		if n := int(binary.BigEndian.Uint16(data[actTableSize:])); n > 0 && n <= maxACTColors {
+			count = n
+		}
+		transparent = int(binary.BigEndian.Uint16(data[actTableSize+2:]))
+	}
+
+	p := &Palette{Colors: make([]color.NRGBA, count)}
+	for i := range p.Colors {
+		p.Colors[i] = color.NRGBA{R: data[i*3], G: data[i*3+1], B: data[i*3+2], A: 255}
+		if i == transparent {
+			p.Colors[i].A = 0
+		}
+	}
+	return p, nil
+}
+
+// encodeACT writes an Adobe color table with the color count and the index
+// of the first fully transparent color
+func encodeACT(w io.Writer, p *Palette) error {
+	if len(p.Colors) > maxACTColors {
+		return fmt.Errorf("%w: %d, at most %d", ErrTooManyColors, len(p.Colors), maxACTColors)
+	}
+
+	data := make([]byte, actExtendedSize)
+	transparent := actNoTransparent
+	for i, c := range p.Colors {
+		data[i*3], data[i*3+1], data[i*3+2] = c.R, c.G, c.B
+		if c.A == 0 && transparent == actNoTransparent {
+			transparent = i
+		}
+	}
+	binary.BigEndian.PutUint16(data[actTableSize:], uint16(len(p.Colors)))
+	binary.BigEndian.PutUint16(data[actTableSize+2:], uint16(transparent))
+
+	_, err := w.Write(data)
+	return err
+}
+
+// decodeASE reads the color entries of an Adobe swatch exchange file. The
+// name of the first group becomes the palette name.
+func decodeASE(r io.Reader) (*Palette, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	br := bytes.NewReader(data)
+
+	var header struct {
+		Signature    [4]byte
+		Major, Minor uint16
+		Blocks       uint32
+	}
+	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if string(header.Signature[:]) != aseSignature {
+		return nil, fmt.Errorf("missing %q signature", aseSignature)
+	}
+
+	p := &Palette{}
+	for i := uint32(0); i < header.Blocks; i++ {
+		var block struct {
+			Type   uint16
+			Length uint32
+		}
+		if err := binary.Read(br, binary.BigEndian, &block); err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		if int64(block.Length) > int64(br.Len()) {
+			return nil, fmt.Errorf("block %d: %w", i, io.ErrUnexpectedEOF)
+		}
+		body := make([]byte, block.Length)
+		br.Read(body)
+
+		switch block.Type {
+		case aseGroupStart:
+			if name, err := readASEName(bytes.NewReader(body)); err == nil && p.Name == "" {
+				p.Name = name
+			}
+		case aseColorEntry:
+			c, err := readASEColor(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("block %d: %w", i, err)
+			}
+			p.Colors = append(p.Colors, c)
+		}
+	}
+	return p, nil
+}
+
+// readASEName reads a block name: a length in UTF-16 code units, including
+// the terminating zero, then the big-endian UTF-16 text
+func readASEName(r *bytes.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	units := make([]uint16, length)
+	if err := binary.Read(r, binary.BigEndian, units); err != nil {
+		return "", err
+	}
+	if n := len(units); n > 0 && units[n-1] == 0 {
+		units = units[:n-1]
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// readASEColor reads a color entry in any of the RGB, CMYK, LAB or gray models
+func readASEColor(r *bytes.Reader) (color.NRGBA, error) {
+	if _, err := readASEName(r); err != nil {
+		return color.NRGBA{}, err
+	}
+
+	var model [4]byte
+	if err := binary.Read(r, binary.BigEndian, &model); err != nil {
+		return color.NRGBA{}, err
+	}
+
+	components := map[string]int{aseModelRGB: 3, aseModelCMYK: 4, aseModelLAB: 3, aseModelGray: 1}
+	n, ok := components[string(model[:])]
+	if !ok {
+		return color.NRGBA{}, fmt.Errorf("unknown color model %q", model[:])
+	}
+	v := make([]float32, n)
+	if err := binary.Read(r, binary.BigEndian, v); err != nil {
+		return color.NRGBA{}, err
+	}
+
+	switch string(model[:]) {
+	case aseModelRGB:
+		return color.NRGBA{R: unit8(v[0]), G: unit8(v[1]), B: unit8(v[2]), A: 255}, nil
+	case aseModelCMYK:
+		k := 1 - v[3]
+		return color.NRGBA{R: unit8((1 - v[0]) * k), G: unit8((1 - v[1]) * k), B: unit8((1 - v[2]) * k), A: 255}, nil
+	case aseModelLAB:
+		return labToNRGBA(float64(v[0])*100, float64(v[1]), float64(v[2])), nil
+	default:
+		return color.NRGBA{R: unit8(v[0]), G: unit8(v[0]), B: unit8(v[0]), A: 255}, nil
+	}
+}
+
+// encodeASE writes an Adobe swatch exchange file with one RGB entry per
+// color, named by its hex value. The format has no alpha.
+func encodeASE(w io.Writer, p *Palette) error {
+	var buf bytes.Buffer
+	buf.WriteString(aseSignature)
+	binary.Write(&buf, binary.BigEndian, []uint16{aseVersionMajor, aseVersionMinor})
+	binary.Write(&buf, binary.BigEndian, uint32(len(p.Colors)))
+
+	for _, c := range p.Colors {
+		name := utf16.Encode([]rune(fmt.Sprintf("%02x%02x%02x", c.R, c.G, c.B)))
+		name = append(name, 0)
+
+		binary.Write(&buf, binary.BigEndian, uint16(aseColorEntry))
+		binary.Write(&buf, binary.BigEndian, uint32(2+len(name)*2+4+3*4+2))
+		binary.Write(&buf, binary.BigEndian, uint16(len(name)))
+		binary.Write(&buf, binary.BigEndian, name)
+		buf.WriteString(aseModelRGB)
+		binary.Write(&buf, binary.BigEndian, []float32{
+			float32(c.R) / 255, float32(c.G) / 255, float32(c.B) / 255,
+		})
+		binary.Write(&buf, binary.BigEndian, uint16(aseColorNormal))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// unit8 converts a 0-1 color component to 0-255
+func unit8(v float32) uint8 {
+	return uint8(math.Round(float64(min(max(v, 0), 1)) * 255))
+}
+
+// labToNRGBA converts a CIELAB color (D50 white) to opaque sRGB
+func labToNRGBA(l, a, b float64) color.NRGBA {
+	fy := (l + 16) / 116
+	fx := fy + a/500
+	fz := fy - b/200
+	finv := func(t float64) float64 {
+		if t3 := t * t * t; t3 > 216.0/24389 {
+			return t3
+		}
+		return (116*t - 16) * 27 / 24389
+	}
+	x, y, z := finv(fx)*labWhiteX, finv(fy)*labWhiteY, finv(fz)*labWhiteZ
+
+	// Bradford-adapted D50 XYZ to linear sRGB
+	lr := 3.1338561*x - 1.6168667*y - 0.4906146*z
+	lg := -0.9787684*x + 1.9161415*y + 0.0334540*z
+	lb := 0.0719453*x - 0.2289914*y + 1.4052427*z
+
+	gamma := func(c float64) float32 {
+		if c <= 0.0031308 {
+			return float32(12.92 * c)
+		}
+		return float32(1.055*math.Pow(c, 1/2.4) - 0.055)
+	}
+	return color.NRGBA{R: unit8(gamma(lr)), G: unit8(gamma(lg)), B: unit8(gamma(lb)), A: 255}
+}
@@ -0,0 +1,179 @@
+// Package palette provides color distance metrics for matching colors
+// against a palette.
+package palette
+
+import (
+	"image/color"
+	"math"
+)
+
+// Metric selects how the distance between two colors is measured
+type Metric int
+
+// Color distance metrics
+const (
+	MetricRGB    Metric = iota // Euclidean distance between sRGB values
+	MetricCIELAB               // CIE76 difference in CIELAB (D65 white)
+	MetricOKLab                // Euclidean distance in OKLab
+)
+
+// Metrics lists every metric in display order
+var Metrics = []Metric{MetricRGB, MetricCIELAB, MetricOKLab}
+
+// String returns the display name of the metric
+func (m Metric) String() string {
+	switch m {
+	case MetricRGB:
+		return "RGB"
+	case MetricCIELAB:
+		return "CIELAB"
+	case MetricOKLab:
+		return "OKLab"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid returns true if the metric is a known metric
+func (m Metric) IsValid() bool {
+	return m >= MetricRGB && m <= MetricOKLab
+}
+
+// CIELAB D65 reference white, used for sRGB colors
+const (
+	d65WhiteX = 0.95047
+	d65WhiteY = 1.0
+	d65WhiteZ = 1.08883
+)
+
+// Lab is a color in a perceptual space with lightness L and the opponent
+// axes A (green-red) and B (blue-yellow). It holds either CIELAB or OKLab
+// coordinates depending on where it came from.
+type Lab struct {
+	L, A, B float64
+}
+
+// ToCIELAB converts a color to CIELAB with the D65 white point, ignoring alpha
+func ToCIELAB(c color.Color) Lab {
+	r, g, b := linearRGB(c)
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / d65WhiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / d65WhiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / d65WhiteZ
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return Lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
+
+// ToOKLab converts a color to OKLab, ignoring alpha
+func ToOKLab(c color.Color) Lab {
+	r, g, b := linearRGB(c)
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	return Lab{
+		L: 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		A: 1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		B: 0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+// FromOKLab converts an OKLab color to opaque sRGB, clamping colors
+// outside the sRGB gamut
+func FromOKLab(lab Lab) color.NRGBA {
+	l := lab.L + 0.3963377774*lab.A + 0.2158037573*lab.B
+	m := lab.L - 0.1055613458*lab.A - 0.0638541728*lab.B
+	s := lab.L - 0.0894841775*lab.A - 1.2914855480*lab.B
+	l, m, s = l*l*l, m*m*m, s*s*s
+
+	return color.NRGBA{
+		R: srgb8(4.0767416621*l - 3.3077115913*m + 0.2309699292*s),
+		G: srgb8(-1.2684380046*l + 2.6097574011*m - 0.3413193965*s),
+		B: srgb8(-0.0041960863*l - 0.7034186147*m + 1.7076147010*s),
+		A: 255,
+	}
+}
+
+// srgb8 gamma-encodes a linear-light component and scales it to 0-255
+func srgb8(linear float64) uint8 {
+	if linear <= 0.0031308 {
+		return unit8(float32(12.92 * linear))
+	}
+	return unit8(float32(1.055*math.Pow(linear, 1/2.4) - 0.055))
+}
+
+// linearRGB returns the linear-light sRGB components of a color, from 0 to 1
+func linearRGB(c color.Color) (r, g, b float64) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	linear := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.04045 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return linear(n.R), linear(n.G), linear(n.B)
+}
+
+// coordinates returns the position of a color in the metric's color space
+func (m Metric) coordinates(c color.Color) Lab {
+	switch m {
+	case MetricCIELAB:
+		return ToCIELAB(c)
+	case MetricOKLab:
+		return ToOKLab(c)
+	default:
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		return Lab{L: float64(n.R), A: float64(n.G), B: float64(n.B)}
+	}
+}
+
+// Matcher finds the nearest palette color to any color under a metric.
+// Results are cached, so matching every pixel of an image is cheap.
+type Matcher struct {
+	metric Metric
+	points []Lab
+	cache  map[color.NRGBA]int
+}
+
+// NewMatcher creates a matcher for the given palette colors
+func NewMatcher(colors []color.Color, metric Metric) *Matcher {
+	matcher := &Matcher{
+		metric: metric,
+		points: make([]Lab, len(colors)),
+		cache:  make(map[color.NRGBA]int),
+	}
+	for i, c := range colors {
+		matcher.points[i] = metric.coordinates(c)
+	}
+	return matcher
+}
+
+// Nearest returns the index of the palette color closest to c, or -1 if the
+// palette is empty. Alpha is ignored; ties go to the earliest color.
+func (matcher *Matcher) Nearest(c color.Color) int {
+	if len(matcher.points) == 0 {
+		return -1
+	}
+
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	n.A = 255
+	if i, ok := matcher.cache[n]; ok {
+		return i
+	}
+
+	p := matcher.metric.coordinates(n)
+	best, bestDistance := 0, math.Inf(1)
+	for i, q := range matcher.points {
+		if d := labDistance(p, q); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	matcher.cache[n] = best
+	return best
+}
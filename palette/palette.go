@@ -0,0 +1,159 @@
+// Package palette provides reading and writing of palette files shared with
+// other pixel art and image editors: GIMP .gpl, JASC .pal, Adobe .act,
+// Adobe swatch exchange .ase and Lospec-style .hex lists. It has no UI
+// dependencies so the formats can be used and tested without a window.
+package palette
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Format is a palette file format
+type Format int
+
+// Format constants
+const (
+	FormatGPL  Format = iota // GIMP palette
+	FormatJASC               // JASC (Paint Shop Pro) palette
+	FormatACT                // Adobe color table
+	FormatASE                // Adobe swatch exchange
+	FormatHex                // One hex color per line, as used by Lospec
+)
+
+// Formats lists every palette format in menu order
+var Formats = []Format{FormatGPL, FormatJASC, FormatACT, FormatASE, FormatHex}
+
+// Palette errors
+var (
+	ErrEmptyPalette  = errors.New("palette has no colors")
+	ErrTooManyColors = errors.New("palette has too many colors for the format")
+	ErrInvalidFormat = errors.New("unknown palette format")
+)
+
+// String returns a human-readable name for the format
+func (f Format) String() string {
+	switch f {
+	case FormatGPL:
+		return "GIMP Palette"
+	case FormatJASC:
+		return "JASC Palette"
+	case FormatACT:
+		return "Adobe Color Table"
+	case FormatASE:
+		return "Adobe Swatch Exchange"
+	case FormatHex:
+		return "Hex List"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the format is valid
+func (f Format) IsValid() bool {
+	return f >= FormatGPL && f <= FormatHex
+}
+
+// Extension returns the file extension of the format, including the dot
+func (f Format) Extension() string {
+	switch f {
+	case FormatGPL:
+		return ".gpl"
+	case FormatJASC:
+		return ".pal"
+	case FormatACT:
+		return ".act"
+	case FormatASE:
+		return ".ase"
+	case FormatHex:
+		return ".hex"
+	default:
+		return ""
+	}
+}
+
+// FormatForPath returns the format implied by a file's extension
+func FormatForPath(path string) (Format, bool) {
+	ext := filepath.Ext(path)
+	for _, f := range Formats {
+		if strings.EqualFold(ext, f.Extension()) {
+			return f, true
+		}
+	}
+	return FormatGPL, false
+}
+
+// Palette is an ordered list of colors with an optional name
+type Palette struct {
+	Name   string
+	Colors []color.NRGBA
+}
+
+// Decode reads a palette in the given format
+func Decode(r io.Reader, format Format) (*Palette, error) {
+	var p *Palette
+	var err error
+	switch format {
+	case FormatGPL:
+		p, err = decodeGPL(r)
+	case FormatJASC:
+		p, err = decodeJASC(r)
+	case FormatACT:
+		p, err = decodeACT(r)
+	case FormatASE:
+		p, err = decodeASE(r)
+	case FormatHex:
+		p, err = decodeHex(r)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrInvalidFormat, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", format, err)
+	}
+	if len(p.Colors) == 0 {
+		return nil, ErrEmptyPalette
+	}
+	return p, nil
+}
+
+// Encode writes a palette in the given format
+func Encode(w io.Writer, p *Palette, format Format) error {
+	if p == nil || len(p.Colors) == 0 {
+		return ErrEmptyPalette
+	}
+
+	var err error
+	switch format {
+	case FormatGPL:
+		err = encodeGPL(w, p)
+	case FormatJASC:
+		err = encodeJASC(w, p)
+	case FormatACT:
+		err = encodeACT(w, p)
+	case FormatASE:
+		err = encodeASE(w, p)
+	case FormatHex:
+		err = encodeHex(w, p)
+	default:
+		return fmt.Errorf("%w: %d", ErrInvalidFormat, format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", format, err)
+	}
+	return nil
+}
+
+// FromColors creates a palette from any colors, converting them to NRGBA
+func FromColors(name string, colors []color.Color) *Palette {
+	p := &Palette{Name: name, Colors: make([]color.NRGBA, 0, len(colors))}
+	for _, c := range colors {
+		if c != nil {
+			p.Colors = append(p.Colors, color.NRGBAModel.Convert(c).(color.NRGBA))
+		}
+	}
+	return p
+}
@@ -0,0 +1,87 @@
+package palette
+
+import (
+	"bytes"
+	"errors"
+	"image/color"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// opaqueColors can be stored by every format
+var opaqueColors = []color.NRGBA{
+	{R: 0, G: 0, B: 0, A: 255},
+	{R: 255, G: 255, B: 255, A: 255},
+	{R: 190, G: 38, B: 51, A: 255},
+	{R: 1, G: 128, B: 254, A: 255},
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		colors   []color.NRGBA
+		keepName bool // The format stores the palette name
+	}{
+		{"GPL", FormatGPL, opaqueColors, true},
+		{"JASC", FormatJASC, opaqueColors, false},
+		{"ACT", FormatACT, opaqueColors, false},
+		{"ACT with transparent color", FormatACT, append(slices.Clone(opaqueColors), color.NRGBA{R: 10, G: 20, B: 30}), false},
+		{"ASE", FormatASE, opaqueColors, false},
+		{"hex", FormatHex, opaqueColors, false},
+		{"hex with alpha", FormatHex, append(slices.Clone(opaqueColors), color.NRGBA{R: 10, G: 20, B: 30, A: 128}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, &Palette{Name: "Test", Colors: tt.colors}, tt.format); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			p, err := Decode(&buf, tt.format)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if !slices.Equal(p.Colors, tt.colors) {
+				t.Errorf("Colors = %v, want %v", p.Colors, tt.colors)
+			}
+			if tt.keepName && p.Name != "Test" {
+				t.Errorf("Name = %q, want %q", p.Name, "Test")
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+	}{
+		{"GPL without header", FormatGPL, "0 0 0\n"},
+		{"GPL bad component", FormatGPL, "GIMP Palette\n0 0 256\n"},
+		{"JASC short", FormatJASC, "JASC-PAL\n0100\n2\n0 0 0\n"},
+		{"ACT wrong size", FormatACT, "\x00\x00\x00"},
+		{"ASE bad signature", FormatASE, "ASEX\x00\x01\x00\x00\x00\x00\x00\x00"},
+		{"hex bad color", FormatHex, "#12345\n"},
+		{"hex empty", FormatHex, "; no colors\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(strings.NewReader(tt.data), tt.format); err == nil {
+				t.Error("Decode() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestEncodeACTTooManyColors(t *testing.T) {
+	colors := make([]color.NRGBA, maxACTColors+1)
+	err := Encode(&bytes.Buffer{}, &Palette{Colors: colors}, FormatACT)
+	if !errors.Is(err, ErrTooManyColors) {
+		t.Errorf("Encode() error = %v, want %v", err, ErrTooManyColors)
+	}
+}
@@ -0,0 +1,336 @@
+// Package palette provides color quantization for generating a palette
+// from an image.
+package palette
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Method selects the color quantization algorithm
+type Method int
+
+// Quantization methods
+const (
+	MethodMedianCut Method = iota // Repeatedly split the widest box of colors at its median
+	MethodKMeans                  // Refine the median cut colors by k-means clustering
+)
+
+// Methods lists every quantization method in display order
+var Methods = []Method{MethodMedianCut, MethodKMeans}
+
+// String returns the display name of the method
+func (m Method) String() string {
+	switch m {
+	case MethodMedianCut:
+		return "Median Cut"
+	case MethodKMeans:
+		return "K-Means"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid returns true if the method is a known method
+func (m Method) IsValid() bool {
+	return m >= MethodMedianCut && m <= MethodKMeans
+}
+
+// Quantization constants
+const (
+	MaxKMeansIterations = 16      // Largest number of k-means refinement passes
+	histogramLimit      = 1 << 15 // Distinct colors above which similar colors are binned together
+	histogramBinBits    = 5       // Bits kept per channel when binning similar colors
+)
+
+// ErrNoOpaquePixels is returned when an image has nothing to quantize
+var ErrNoOpaquePixels = errors.New("image has no opaque pixels")
+
+// colorBin is a color found in the image with the number of pixels using it
+type colorBin struct {
+	color color.NRGBA
+	lab   Lab
+	count int
+}
+
+// cluster is a group of color bins represented by their weighted mean
+type cluster struct {
+	bins   []colorBin
+	center Lab
+	count  int
+}
+
+// Quantize returns at most n colors representing the pixels of img, most
+// used first. Colors are compared in OKLab so the result follows how the
+// image looks. Fully transparent pixels are ignored and alpha is dropped.
+// Images with at most n distinct colors return exactly those colors.
+func Quantize(img image.Image, n int, method Method) ([]color.NRGBA, error) {
+	if img == nil {
+		return nil, fmt.Errorf("image cannot be nil")
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("color count must be positive, got %d", n)
+	}
+	if !method.IsValid() {
+		return nil, fmt.Errorf("invalid quantization method: %d", method)
+	}
+
+	bins := histogram(img)
+	if len(bins) == 0 {
+		return nil, ErrNoOpaquePixels
+	}
+
+	var clusters []cluster
+	if len(bins) <= n {
+		clusters = make([]cluster, len(bins))
+		for i, bin := range bins {
+			clusters[i] = cluster{bins: bins[i : i+1], center: bin.lab, count: bin.count}
+		}
+	} else {
+		clusters = medianCut(bins, n)
+		if method == MethodKMeans {
+			clusters = kMeans(bins, clusters)
+		}
+	}
+
+	// Most used colors first; clusters that round to the same color are merged
+	sort.SliceStable(clusters, func(i, j int) bool {
+		return clusters[i].count > clusters[j].count
+	})
+	colors := make([]color.NRGBA, 0, len(clusters))
+	seen := make(map[color.NRGBA]bool)
+	for _, c := range clusters {
+		rgb := FromOKLab(c.center)
+		if len(c.bins) == 1 {
+			rgb = c.bins[0].color
+		}
+		if !seen[rgb] {
+			seen[rgb] = true
+			colors = append(colors, rgb)
+		}
+	}
+	return colors, nil
+}
+
+// histogram counts the opaque colors of an image, most used first. Images
+// with very many colors have similar colors binned together and averaged.
+func histogram(img image.Image) []colorBin {
+	counts := make(map[color.NRGBA]int)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			c.A = 255
+			counts[c]++
+		}
+	}
+
+	if len(counts) > histogramLimit {
+		counts = binColors(counts)
+	}
+
+	bins := make([]colorBin, 0, len(counts))
+	for c, count := range counts {
+		bins = append(bins, colorBin{color: c, lab: ToOKLab(c), count: count})
+	}
+	sort.Slice(bins, func(i, j int) bool {
+		a, b := bins[i], bins[j]
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		return uint32(a.color.R)<<16|uint32(a.color.G)<<8|uint32(a.color.B) <
+			uint32(b.color.R)<<16|uint32(b.color.G)<<8|uint32(b.color.B)
+	})
+	return bins
+}
+
+// binColors merges colors that agree in the top histogramBinBits of every
+// channel, replacing each group by its pixel-weighted average color
+func binColors(counts map[color.NRGBA]int) map[color.NRGBA]int {
+	type sum struct{ r, g, b, count int }
+	mask := uint8(0xFF << (8 - histogramBinBits) & 0xFF)
+
+	sums := make(map[color.NRGBA]*sum)
+	for c, count := range counts {
+		key := color.NRGBA{R: c.R & mask, G: c.G & mask, B: c.B & mask, A: 255}
+		s, ok := sums[key]
+		if !ok {
+			s = &sum{}
+			sums[key] = s
+		}
+		s.r += int(c.R) * count
+		s.g += int(c.G) * count
+		s.b += int(c.B) * count
+		s.count += count
+	}
+
+	binned := make(map[color.NRGBA]int, len(sums))
+	for _, s := range sums {
+		c := color.NRGBA{
+			R: uint8(s.r / s.count),
+			G: uint8(s.g / s.count),
+			B: uint8(s.b / s.count),
+			A: 255,
+		}
+		binned[c] += s.count
+	}
+	return binned
+}
+
+// medianCut splits the bins into at most n clusters. The cluster with the
+// widest spread along any OKLab axis is split at its pixel-weighted median
+// along that axis until there are n clusters or none can be split.
+func medianCut(bins []colorBin, n int) []cluster {
+	clusters := []cluster{newCluster(bins)}
+	for len(clusters) < n {
+		best, bestAxis, bestExtent := -1, 0, 0.0
+		for i, c := range clusters {
+			if len(c.bins) < 2 {
+				continue
+			}
+			if axis, extent := c.widestAxis(); extent > bestExtent {
+				best, bestAxis, bestExtent = i, axis, extent
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		lower, upper := clusters[best].split(bestAxis)
+		clusters[best] = lower
+		clusters = append(clusters, upper)
+	}
+	return clusters
+}
+
+// kMeans refines clusters by repeatedly assigning every bin to its nearest
+// center and moving each center to the weighted mean of its bins
+func kMeans(bins []colorBin, clusters []cluster) []cluster {
+	centers := make([]Lab, len(clusters))
+	for i, c := range clusters {
+		centers[i] = c.center
+	}
+
+	assignment := make([]int, len(bins))
+	for i := range assignment {
+		assignment[i] = -1
+	}
+
+	for iteration := 0; iteration < MaxKMeansIterations; iteration++ {
+		changed := false
+		for i, bin := range bins {
+			nearest, nearestDistance := 0, math.Inf(1)
+			for j, center := range centers {
+				if d := labDistance(bin.lab, center); d < nearestDistance {
+					nearest, nearestDistance = j, d
+				}
+			}
+			if assignment[i] != nearest {
+				assignment[i] = nearest
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		// Empty clusters keep their previous center
+		groups := make([][]colorBin, len(centers))
+		for i, bin := range bins {
+			groups[assignment[i]] = append(groups[assignment[i]], bin)
+		}
+		for j, group := range groups {
+			if len(group) > 0 {
+				centers[j] = newCluster(group).center
+			}
+		}
+	}
+
+	groups := make([][]colorBin, len(centers))
+	for i, bin := range bins {
+		groups[assignment[i]] = append(groups[assignment[i]], bin)
+	}
+	refined := make([]cluster, 0, len(groups))
+	for _, group := range groups {
+		if len(group) > 0 {
+			refined = append(refined, newCluster(group))
+		}
+	}
+	return refined
+}
+
+// newCluster groups bins and computes their pixel-weighted mean
+func newCluster(bins []colorBin) cluster {
+	c := cluster{bins: bins}
+	for _, bin := range bins {
+		w := float64(bin.count)
+		c.center.L += bin.lab.L * w
+		c.center.A += bin.lab.A * w
+		c.center.B += bin.lab.B * w
+		c.count += bin.count
+	}
+	if c.count > 0 {
+		c.center.L /= float64(c.count)
+		c.center.A /= float64(c.count)
+		c.center.B /= float64(c.count)
+	}
+	return c
+}
+
+// widestAxis returns the OKLab axis (0 for L, 1 for A, 2 for B) along which
+// the cluster's colors spread the most, and the size of that spread
+func (c cluster) widestAxis() (int, float64) {
+	lo := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	hi := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, bin := range c.bins {
+		for axis, v := range labAxes(bin.lab) {
+			lo[axis] = min(lo[axis], v)
+			hi[axis] = max(hi[axis], v)
+		}
+	}
+
+	widest := 0
+	for axis := 1; axis < 3; axis++ {
+		if hi[axis]-lo[axis] > hi[widest]-lo[widest] {
+			widest = axis
+		}
+	}
+	return widest, hi[widest] - lo[widest]
+}
+
+// split divides the cluster at the pixel-weighted median along an axis.
+// Both halves always hold at least one bin.
+func (c cluster) split(axis int) (cluster, cluster) {
+	bins := append([]colorBin(nil), c.bins...)
+	sort.SliceStable(bins, func(i, j int) bool {
+		return labAxes(bins[i].lab)[axis] < labAxes(bins[j].lab)[axis]
+	})
+
+	cut, seen := 1, 0
+	for i, bin := range bins[:len(bins)-1] {
+		seen += bin.count
+		cut = i + 1
+		if seen*2 >= c.count {
+			break
+		}
+	}
+	return newCluster(bins[:cut]), newCluster(bins[cut:])
+}
+
+// labAxes returns the coordinates of a color as an array indexed by axis
+func labAxes(lab Lab) [3]float64 {
+	return [3]float64{lab.L, lab.A, lab.B}
+}
+
+// labDistance returns the squared Euclidean distance between two colors
+func labDistance(a, b Lab) float64 {
+	dl, da, db := a.L-b.L, a.A-b.A, a.B-b.B
+	return dl*dl + da*da + db*db
+}
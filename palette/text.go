@@ -0,0 +1,184 @@
+// Package palette provides the text palette formats: GIMP .gpl, JASC .pal
+// and .hex lists.
+package palette
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Text format constants
+const (
+	gplHeader   = "GIMP Palette"
+	gplName     = "Name:"
+	gplColumns  = "Columns:"
+	gplComment  = "#"
+	jascHeader  = "JASC-PAL"
+	jascVersion = "0100"
+)
+
+// decodeGPL reads a GIMP palette. Colors are opaque; the optional name after
+// each color is ignored.
+func decodeGPL(r io.Reader) (*Palette, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != gplHeader {
+		return nil, fmt.Errorf("missing %q header", gplHeader)
+	}
+
+	p := &Palette{}
+	for line := 2; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, gplComment):
+			continue
+		case strings.HasPrefix(text, gplName):
+			p.Name = strings.TrimSpace(strings.TrimPrefix(text, gplName))
+			continue
+		case strings.HasPrefix(text, gplColumns):
+			continue
+		}
+
+		c, err := parseRGB(strings.Fields(text))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		p.Colors = append(p.Colors, c)
+	}
+	return p, scanner.Err()
+}
+
+// encodeGPL writes a GIMP palette, naming each color by its hex value
+func encodeGPL(w io.Writer, p *Palette) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, gplHeader)
+	if p.Name != "" {
+		fmt.Fprintln(bw, gplName, p.Name)
+	}
+	fmt.Fprintln(bw, gplComment)
+	for _, c := range p.Colors {
+		fmt.Fprintf(bw, "%3d %3d %3d\t%02x%02x%02x\n", c.R, c.G, c.B, c.R, c.G, c.B)
+	}
+	return bw.Flush()
+}
+
+// decodeJASC reads a JASC palette: a header, a version, the color count and
+// one color per line
+func decodeJASC(r io.Reader) (*Palette, error) {
+	scanner := bufio.NewScanner(r)
+	next := func() (string, bool) {
+		for scanner.Scan() {
+			if text := strings.TrimSpace(scanner.Text()); text != "" {
+				return text, true
+			}
+		}
+		return "", false
+	}
+
+	if header, _ := next(); header != jascHeader {
+		return nil, fmt.Errorf("missing %q header", jascHeader)
+	}
+	if _, ok := next(); !ok {
+		return nil, fmt.Errorf("missing version")
+	}
+	countText, _ := next()
+	count, err := strconv.Atoi(countText)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid color count: %q", countText)
+	}
+
+	p := &Palette{Colors: make([]color.NRGBA, 0, min(count, maxACTColors))}
+	for i := 0; i < count; i++ {
+		text, ok := next()
+		if !ok {
+			return nil, fmt.Errorf("expected %d colors, found %d", count, i)
+		}
+		c, err := parseRGB(strings.Fields(text))
+		if err != nil {
+			return nil, fmt.Errorf("color %d: %w", i, err)
+		}
+		p.Colors = append(p.Colors, c)
+	}
+	return p, scanner.Err()
+}
+
+// encodeJASC writes a JASC palette
+func encodeJASC(w io.Writer, p *Palette) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\r\n%s\r\n%d\r\n", jascHeader, jascVersion, len(p.Colors))
+	for _, c := range p.Colors {
+		fmt.Fprintf(bw, "%d %d %d\r\n", c.R, c.G, c.B)
+	}
+	return bw.Flush()
+}
+
+// decodeHex reads one RRGGBB or RRGGBBAA color per line, with or without a
+// leading '#'. Blank lines and lines starting with ';' or "//" are ignored.
+func decodeHex(r io.Reader) (*Palette, error) {
+	scanner := bufio.NewScanner(r)
+	p := &Palette{}
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, ";") || strings.HasPrefix(text, "//") {
+			continue
+		}
+
+		c, err := parseHex(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		p.Colors = append(p.Colors, c)
+	}
+	return p, scanner.Err()
+}
+
+// encodeHex writes one lowercase RRGGBB color per line, adding the alpha
+// only for colors that are not opaque
+func encodeHex(w io.Writer, p *Palette) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range p.Colors {
+		if c.A == 255 {
+			fmt.Fprintf(bw, "%02x%02x%02x\n", c.R, c.G, c.B)
+		} else {
+			fmt.Fprintf(bw, "%02x%02x%02x%02x\n", c.R, c.G, c.B, c.A)
+		}
+	}
+	return bw.Flush()
+}
+
+// parseRGB reads an opaque color from the first three fields, each 0-255
+func parseRGB(fields []string) (color.NRGBA, error) {
+	if len(fields) < 3 {
+		return color.NRGBA{}, fmt.Errorf("expected red, green and blue values")
+	}
+
+	var rgb [3]uint8
+	for i := range rgb {
+		v, err := strconv.ParseUint(fields[i], 10, 8)
+		if err != nil {
+			return color.NRGBA{}, fmt.Errorf("invalid color component %q", fields[i])
+		}
+		rgb[i] = uint8(v)
+	}
+	return color.NRGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}, nil
+}
+
+// parseHex reads an RRGGBB or RRGGBBAA color, with or without a leading '#'
+func parseHex(text string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(text, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid hex color %q", text)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid hex color %q", text)
+	}
+
+	if len(hex) == 6 {
+		v = v<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
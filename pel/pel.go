@@ -38,6 +38,19 @@ var (
 	DefaultBrushType  = apptype.BrushTypePencil                     // Pencil tool
 )
 
+// Default fill tool options: contiguous 4-way fill of exact color matches
+var DefaultFillOptions = apptype.FillOptions{
+	Connectivity: apptype.FillConnectivity4,
+	Tolerance:    apptype.MinFillTolerance,
+	Global:       false,
+}
+
+// Default shape tool options: one pixel wide outlines
+var DefaultShapeOptions = apptype.ShapeOptions{
+	Filled:      false,
+	StrokeWidth: apptype.MinStrokeWidth,
+}
+
 func main() {
 	// Initialize logger
 	log.SetPrefix(fmt.Sprintf("[%s v%s] ", AppName, AppVersion))
@@ -137,6 +150,10 @@ func initializeState() (apptype.State, error) {
 		BrushType:      DefaultBrushType,
 		SwatchSelected: 0,
 		FilePath:       "", // Empty for new project
+		FillOptions:    DefaultFillOptions,
+		ShapeOptions:   DefaultShapeOptions,
+		OnionSkin:      apptype.DefaultOnionSkin,
+		WandOptions:    apptype.DefaultWandOptions,
 	}
 
 	// Validate state using built-in validation method
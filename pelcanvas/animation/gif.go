@@ -0,0 +1,242 @@
+// Package animation provides animated GIF encoding and decoding for timelines.
+package animation
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"github.com/carlomunguia/pel/palette"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// GIF encoding constants
+const (
+	GIFAlphaThreshold = 128 // Pixels with lower alpha are written as transparent
+	GIFLoopForever    = 0   // GIFOptions.Loops value that repeats the animation endlessly
+
+	gifMaxColors        = 256 // Palette entries available in a GIF frame
+	gifTransparentIndex = 0   // Palette index reserved for transparent pixels
+	gifDelayUnit        = 10  // Milliseconds per GIF delay unit
+)
+
+// GIFOptions configures GIF export
+type GIFOptions struct {
+	Loops int // Number of times the animation plays, or GIFLoopForever
+}
+
+// EncodeGIF writes every frame of the timeline to w as an animated GIF.
+// Each frame is flattened and shown for its duration. Pixels with alpha below
+// GIFAlphaThreshold use a transparent palette index. When the frames use more
+// than 255 distinct colors, each frame gets its own palette, quantized to 255
+// colors with k-means if the frame alone has more.
+func EncodeGIF(w io.Writer, timeline *Timeline, opts GIFOptions) error {
+	if timeline == nil {
+		return fmt.Errorf("timeline cannot be nil")
+	}
+	if opts.Loops < 0 {
+		return fmt.Errorf("loop count cannot be negative: %d", opts.Loops)
+	}
+
+	images := make([]*image.NRGBA, timeline.Len())
+	for i, f := range timeline.Frames() {
+		images[i] = f.Layers.Flatten()
+	}
+
+	// Share one palette across frames when the colors fit, otherwise give
+	// each frame its own
+	shared, sharing := gifPalette(images...)
+
+	anim := &gif.GIF{
+		Image:     make([]*image.Paletted, 0, len(images)),
+		Delay:     make([]int, 0, len(images)),
+		Disposal:  make([]byte, 0, len(images)),
+		LoopCount: gifLoopCount(opts.Loops),
+	}
+	for i, img := range images {
+		pal := shared
+		if !sharing {
+			framePal, fits := gifPalette(img)
+			if !fits {
+				framePal = quantizedPalette(img)
+			}
+			pal = framePal
+		}
+
+		anim.Image = append(anim.Image, toPaletted(img, pal))
+		anim.Delay = append(anim.Delay, gifDelay(timeline.Frame(i).Duration))
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+
+	if err := gif.EncodeAll(w, anim); err != nil {
+		return fmt.Errorf("failed to encode GIF: %w", err)
+	}
+	return nil
+}
+
+// DecodeGIF reads an animated GIF and returns a timeline with one single-layer
+// frame per GIF frame. Frame disposal is applied, so every frame holds the
+// complete image shown at that point of the animation.
+func DecodeGIF(r io.Reader) (*Timeline, error) {
+	anim, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GIF: %w", err)
+	}
+	if len(anim.Image) == 0 {
+		return nil, fmt.Errorf("GIF has no frames")
+	}
+
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if bounds.Empty() {
+		bounds = anim.Image[0].Bounds()
+	}
+
+	// The screen the GIF frames are drawn onto, starting transparent
+	screen := image.NewNRGBA(bounds)
+	frames := make([]*Frame, 0, len(anim.Image))
+
+	for i, img := range anim.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(anim.Disposal) {
+			disposal = anim.Disposal[i]
+		}
+
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneNRGBA(screen)
+		}
+
+		draw.Draw(screen, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		stack, err := layer.NewStackFromImage(cloneNRGBA(screen))
+		if err != nil {
+			return nil, err
+		}
+		delay := 0
+		if i < len(anim.Delay) {
+			delay = anim.Delay[i]
+		}
+		frames = append(frames, &Frame{Layers: stack, Duration: gifDuration(delay)})
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(screen, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			screen = previous
+		}
+	}
+
+	return NewTimelineFromFrames(frames, 0)
+}
+
+// gifPalette builds a palette holding a transparent entry followed by every
+// opaque color used by the images. Returns nil and false if the colors do
+// not fit.
+func gifPalette(images ...*image.NRGBA) (color.Palette, bool) {
+	pal := color.Palette{color.NRGBA{}}
+	seen := make(map[color.NRGBA]bool)
+
+	for _, img := range images {
+		for i := 0; i < len(img.Pix); i += 4 {
+			c := color.NRGBA{R: img.Pix[i], G: img.Pix[i+1], B: img.Pix[i+2], A: 255}
+			if img.Pix[i+3] < GIFAlphaThreshold || seen[c] {
+				continue
+			}
+			if len(pal) == gifMaxColors {
+				return nil, false
+			}
+			seen[c] = true
+			pal = append(pal, c)
+		}
+	}
+	return pal, true
+}
+
+// quantizedPalette builds a palette holding a transparent entry followed by
+// at most 255 colors chosen by k-means to represent the opaque pixels of an
+// image with too many colors
+func quantizedPalette(img *image.NRGBA) color.Palette {
+	// Pixels written as transparent do not count towards the palette
+	opaque := image.NewNRGBA(img.Rect)
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i+3] >= GIFAlphaThreshold {
+			copy(opaque.Pix[i:i+3], img.Pix[i:i+3])
+			opaque.Pix[i+3] = 255
+		}
+	}
+
+	pal := color.Palette{color.NRGBA{}}
+	colors, err := palette.Quantize(opaque, gifMaxColors-1, palette.MethodKMeans)
+	if err != nil || len(colors) == 0 {
+		// Only reached for images without opaque pixels, which need no colors
+		return append(pal, color.NRGBA{A: 255})
+	}
+	for _, c := range colors {
+		pal = append(pal, c)
+	}
+	return pal
+}
+
+// toPaletted converts an image to the palette, writing pixels below the alpha
+// threshold as the transparent index and others as the closest opaque entry
+func toPaletted(img *image.NRGBA, pal color.Palette) *image.Paletted {
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(bounds, pal)
+	opaque := pal[gifTransparentIndex+1:]
+	cache := make(map[color.NRGBA]uint8)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			if c.A < GIFAlphaThreshold {
+				paletted.SetColorIndex(x, y, gifTransparentIndex)
+				continue
+			}
+
+			c.A = 255
+			index, ok := cache[c]
+			if !ok {
+				index = uint8(opaque.Index(c) + gifTransparentIndex + 1)
+				cache[c] = index
+			}
+			paletted.SetColorIndex(x, y, index)
+		}
+	}
+	return paletted
+}
+
+// gifLoopCount converts a number of plays to the GIF loop count, which counts
+// repeats after the first play and uses -1 for no repeat
+func gifLoopCount(loops int) int {
+	switch loops {
+	case GIFLoopForever:
+		return 0
+	case 1:
+		return -1
+	default:
+		return loops - 1
+	}
+}
+
+// gifDelay converts a frame duration in milliseconds to GIF delay units
+func gifDelay(duration int) int {
+	return max((duration+gifDelayUnit/2)/gifDelayUnit, 1)
+}
+
+// gifDuration converts a GIF delay to a valid frame duration in milliseconds.
+// Frames without a delay get the default duration, as browsers do.
+func gifDuration(delay int) int {
+	if delay <= 0 {
+		return DefaultDuration
+	}
+	return min(max(delay*gifDelayUnit, MinDuration), MaxDuration)
+}
+
+// cloneNRGBA returns a copy of an image
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	clone := image.NewNRGBA(img.Bounds())
+	copy(clone.Pix, img.Pix)
+	return clone
+}
@@ -0,0 +1,79 @@
+package animation
+
+import (
+	"bytes"
+	"image/color"
+	"image/gif"
+	"testing"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// colorTimeline returns a timeline of 16x16 frames where frame i uses
+// counts[i] distinct opaque colors, none shared with another frame
+func colorTimeline(t *testing.T, counts ...int) *Timeline {
+	t.Helper()
+	frames := make([]*Frame, len(counts))
+	for i, count := range counts {
+		l := layer.New(layer.BackgroundName, 16, 16)
+		for p := 0; p < 16*16; p++ {
+			l.Image.SetNRGBA(p%16, p/16, color.NRGBA{R: uint8(p % count), G: uint8(i), B: 50, A: 255})
+		}
+		stack, err := layer.NewStackFromLayers([]*layer.Layer{l}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames[i] = NewFrame(stack)
+	}
+	timeline, err := NewTimelineFromFrames(frames, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return timeline
+}
+
+func TestEncodeGIFPalettes(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts []int
+		shared bool // Every frame uses the same palette
+		exact  bool // Every pixel keeps its color
+	}{
+		{"shared palette", []int{100, 100}, true, true},
+		{"palette per frame", []int{200, 200, 200}, false, true},
+		{"quantized frame between fitting frames", []int{200, 256, 200}, false, false},
+	}
+	for _, tt := range tests {
+		timeline := colorTimeline(t, tt.counts...)
+		var buf bytes.Buffer
+		if err := EncodeGIF(&buf, timeline, GIFOptions{Loops: GIFLoopForever}); err != nil {
+			t.Fatalf("%s: EncodeGIF() error = %v", tt.name, err)
+		}
+		anim, err := gif.DecodeAll(&buf)
+		if err != nil {
+			t.Fatalf("%s: DecodeAll() error = %v", tt.name, err)
+		}
+		if len(anim.Image) != len(tt.counts) {
+			t.Fatalf("%s: got %d frames, want %d", tt.name, len(anim.Image), len(tt.counts))
+		}
+
+		for i, img := range anim.Image {
+			if len(img.Palette) > gifMaxColors {
+				t.Errorf("%s: frame %d has %d colors", tt.name, i, len(img.Palette))
+			}
+			if tt.shared && len(img.Palette) != len(anim.Image[0].Palette) {
+				t.Errorf("%s: frame %d does not share the palette", tt.name, i)
+			}
+			if !tt.exact {
+				continue
+			}
+			src := timeline.Frame(i).Layers.Layer(0).Image
+			for p := 0; p < 16*16; p++ {
+				want := src.NRGBAAt(p%16, p/16)
+				if got := color.NRGBAModel.Convert(img.At(p%16, p/16)); got != want {
+					t.Errorf("%s: frame %d pixel %d = %v, want %v", tt.name, i, p, got, want)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package animation provides named frame ranges (tags) for timelines.
+package animation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Direction is the order in which the frames of a tag are played
+type Direction int
+
+// Direction constants
+const (
+	DirectionForward  Direction = iota // First to last frame
+	DirectionReverse                   // Last to first frame
+	DirectionPingPong                  // First to last, then back
+)
+
+// Directions lists every direction in menu order
+var Directions = []Direction{DirectionForward, DirectionReverse, DirectionPingPong}
+
+// String returns the name of the direction as used by Aseprite
+func (d Direction) String() string {
+	switch d {
+	case DirectionForward:
+		return "forward"
+	case DirectionReverse:
+		return "reverse"
+	case DirectionPingPong:
+		return "pingpong"
+	default:
+		return "unknown"
+	}
+}
+
+// IsValid checks if the direction is valid
+func (d Direction) IsValid() bool {
+	return d >= DirectionForward && d <= DirectionPingPong
+}
+
+// ParseDirection returns the direction with the given name
+func ParseDirection(name string) (Direction, bool) {
+	for _, d := range Directions {
+		if d.String() == name {
+			return d, true
+		}
+	}
+	return DirectionForward, false
+}
+
+// Tag errors
+var (
+	ErrEmptyTagName = errors.New("tag name cannot be empty")
+	ErrDuplicateTag = errors.New("a tag with this name already exists")
+	ErrUnknownTag   = errors.New("no tag with this name")
+)
+
+// Tag names an inclusive range of frames, such as a walk cycle
+type Tag struct {
+	Name      string
+	From      int // Index of the first frame
+	To        int // Index of the last frame
+	Direction Direction
+}
+
+// Tags returns the tags of the timeline in the order they were added
+func (timeline *Timeline) Tags() []Tag {
+	tags := make([]Tag, len(timeline.tags))
+	copy(tags, timeline.tags)
+	return tags
+}
+
+// AddTag names a range of frames. Tag names are unique.
+func (timeline *Timeline) AddTag(tag Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return ErrEmptyTagName
+	}
+	if timeline.tagIndex(tag.Name) >= 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateTag, tag.Name)
+	}
+	if err := timeline.checkIndex(tag.From); err != nil {
+		return err
+	}
+	if err := timeline.checkIndex(tag.To); err != nil {
+		return err
+	}
+	if tag.From > tag.To {
+		return fmt.Errorf("tag %s starts after it ends: %d > %d", tag.Name, tag.From, tag.To)
+	}
+	if !tag.Direction.IsValid() {
+		return fmt.Errorf("invalid tag direction: %d", tag.Direction)
+	}
+
+	timeline.tags = append(timeline.tags, tag)
+	return nil
+}
+
+// RemoveTag removes the tag with the given name
+func (timeline *Timeline) RemoveTag(name string) error {
+	i := timeline.tagIndex(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownTag, name)
+	}
+	timeline.tags = append(timeline.tags[:i], timeline.tags[i+1:]...)
+	return nil
+}
+
+// tagIndex returns the index of the tag with the given name, or -1 if absent
+func (timeline *Timeline) tagIndex(name string) int {
+	for i, tag := range timeline.tags {
+		if tag.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// shiftTagsForInsert keeps tags on the same frames when a frame is inserted
+// at index i. Frames inserted inside a tag extend it.
+func (timeline *Timeline) shiftTagsForInsert(i int) {
+	for t := range timeline.tags {
+		tag := &timeline.tags[t]
+		if tag.From >= i {
+			tag.From++
+		}
+		if tag.To >= i {
+			tag.To++
+		}
+	}
+}
+
+// shiftTagsForDelete keeps tags on the same frames when the frame at index i
+// is removed. Tags left without frames are removed.
+func (timeline *Timeline) shiftTagsForDelete(i int) {
+	tags := timeline.tags[:0]
+	for _, tag := range timeline.tags {
+		if tag.From > i {
+			tag.From--
+		}
+		if tag.To >= i {
+			tag.To--
+		}
+		if tag.From <= tag.To {
+			tags = append(tags, tag)
+		}
+	}
+	timeline.tags = tags
+}
@@ -0,0 +1,362 @@
+// Package animation provides the frame timeline behind an animated drawing.
+// Each frame holds its own layer stack and a display duration.
+package animation
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// Frame duration limits in milliseconds
+const (
+	DefaultDuration = 100
+	MinDuration     = 10
+	MaxDuration     = 65535
+)
+
+// Timeline errors
+var (
+	ErrInvalidIndex    = errors.New("frame index out of range")
+	ErrLastFrame       = errors.New("cannot remove the last frame")
+	ErrInvalidDuration = fmt.Errorf("frame duration must be between %d and %d ms", MinDuration, MaxDuration)
+)
+
+// Frame is a single image of an animation
+type Frame struct {
+	Layers   *layer.Stack // Layers drawn for this frame
+	Duration int          // How long the frame is shown, in milliseconds
+}
+
+// NewFrame creates a frame showing the given layers for DefaultDuration
+func NewFrame(layers *layer.Stack) *Frame {
+	return &Frame{Layers: layers, Duration: DefaultDuration}
+}
+
+// Timeline is an ordered list of equally sized frames with one current
+// frame that is shown and edited
+type Timeline struct {
+	frames     []*Frame
+	tags       []Tag
+	current    int
+	cols, rows int
+}
+
+// Snapshot captures the structure of a timeline: which frames it holds, in
+// which order, with which durations and tags, and which one is current.
+// Frame layers are shared, not copied.
+type Snapshot struct {
+	frames    []*Frame
+	durations []int
+	tags      []Tag
+	current   int
+}
+
+// NewTimeline creates a timeline with a single frame
+func NewTimeline(first *Frame) (*Timeline, error) {
+	if first == nil || first.Layers == nil {
+		return nil, fmt.Errorf("frame cannot be nil")
+	}
+
+	cols, rows := first.Layers.Size()
+	return &Timeline{
+		frames: []*Frame{first},
+		cols:   cols,
+		rows:   rows,
+	}, nil
+}
+
+// NewTimelineFromFrames creates a timeline from existing frames.
+// Every frame must have the same dimensions.
+func NewTimelineFromFrames(frames []*Frame, current int) (*Timeline, error) {
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("timeline needs at least one frame")
+	}
+
+	timeline, err := NewTimeline(frames[0])
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range frames[1:] {
+		if err := timeline.Insert(i+1, f); err != nil {
+			return nil, err
+		}
+	}
+	if err := timeline.SetCurrent(current); err != nil {
+		return nil, err
+	}
+	return timeline, nil
+}
+
+// Size returns the dimensions shared by every frame
+func (timeline *Timeline) Size() (cols, rows int) {
+	return timeline.cols, timeline.rows
+}
+
+// Bounds returns the rectangle covered by every frame
+func (timeline *Timeline) Bounds() image.Rectangle {
+	return image.Rect(0, 0, timeline.cols, timeline.rows)
+}
+
+// Len returns the number of frames
+func (timeline *Timeline) Len() int {
+	return len(timeline.frames)
+}
+
+// Frame returns the frame at index i, or nil if out of range
+func (timeline *Timeline) Frame(i int) *Frame {
+	if i < 0 || i >= len(timeline.frames) {
+		return nil
+	}
+	return timeline.frames[i]
+}
+
+// Frames returns the frames in playback order
+func (timeline *Timeline) Frames() []*Frame {
+	frames := make([]*Frame, len(timeline.frames))
+	copy(frames, timeline.frames)
+	return frames
+}
+
+// Current returns the frame that is shown and edited
+func (timeline *Timeline) Current() *Frame {
+	return timeline.frames[timeline.current]
+}
+
+// CurrentIndex returns the index of the current frame
+func (timeline *Timeline) CurrentIndex() int {
+	return timeline.current
+}
+
+// SetCurrent makes the frame at index i the current frame
+func (timeline *Timeline) SetCurrent(i int) error {
+	if err := timeline.checkIndex(i); err != nil {
+		return err
+	}
+	timeline.current = i
+	return nil
+}
+
+// IndexOf returns the index of the frame holding the given layer stack, or -1 if absent
+func (timeline *Timeline) IndexOf(layers *layer.Stack) int {
+	for i, f := range timeline.frames {
+		if f.Layers == layers {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindLayer returns the index of the frame holding the given layer, or -1 if absent
+func (timeline *Timeline) FindLayer(l *layer.Layer) int {
+	for i, f := range timeline.frames {
+		for _, candidate := range f.Layers.Layers() {
+			if candidate == l {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Add inserts an empty frame after the current frame and makes it current.
+// The new frame has the same layers as the current frame, without pixels.
+func (timeline *Timeline) Add() (*Frame, error) {
+	current := timeline.Current()
+
+	layers := make([]*layer.Layer, 0, current.Layers.Len())
+	for _, l := range current.Layers.Layers() {
+		empty := layer.New(l.Name, timeline.cols, timeline.rows)
+		empty.Properties = l.Properties
+		layers = append(layers, empty)
+	}
+
+	stack, err := layer.NewStackFromLayers(layers, current.Layers.ActiveIndex())
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Frame{Layers: stack, Duration: current.Duration}
+	timeline.insert(timeline.current+1, f)
+	timeline.current++
+	return f, nil
+}
+
+// Insert adds an existing frame at index i and makes it current.
+// The frame must have the same dimensions as the timeline.
+func (timeline *Timeline) Insert(i int, f *Frame) error {
+	if i < 0 || i > len(timeline.frames) {
+		return ErrInvalidIndex
+	}
+	if f == nil || f.Layers == nil {
+		return fmt.Errorf("frame cannot be nil")
+	}
+	if cols, rows := f.Layers.Size(); cols != timeline.cols || rows != timeline.rows {
+		return fmt.Errorf("frame size %dx%d does not match canvas size %dx%d",
+			cols, rows, timeline.cols, timeline.rows)
+	}
+	if f.Duration < MinDuration || f.Duration > MaxDuration {
+		return ErrInvalidDuration
+	}
+
+	timeline.insert(i, f)
+	timeline.current = i
+	return nil
+}
+
+// Duplicate inserts a copy of the frame at index i directly after it and
+// makes the copy current
+func (timeline *Timeline) Duplicate(i int) (*Frame, error) {
+	if err := timeline.checkIndex(i); err != nil {
+		return nil, err
+	}
+
+	source := timeline.frames[i]
+	layers := make([]*layer.Layer, 0, source.Layers.Len())
+	for _, l := range source.Layers.Layers() {
+		layers = append(layers, l.Clone())
+	}
+
+	stack, err := layer.NewStackFromLayers(layers, source.Layers.ActiveIndex())
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Frame{Layers: stack, Duration: source.Duration}
+	timeline.insert(i+1, f)
+	timeline.current = i + 1
+	return f, nil
+}
+
+// Delete removes the frame at index i. The last remaining frame cannot be removed.
+func (timeline *Timeline) Delete(i int) error {
+	if err := timeline.checkIndex(i); err != nil {
+		return err
+	}
+	if len(timeline.frames) == 1 {
+		return ErrLastFrame
+	}
+
+	timeline.frames = append(timeline.frames[:i], timeline.frames[i+1:]...)
+	timeline.shiftTagsForDelete(i)
+	if timeline.current > i || timeline.current == len(timeline.frames) {
+		timeline.current--
+	}
+	return nil
+}
+
+// Move moves the frame at index from to index to, shifting the frames in between.
+// The current frame stays the same frame. Tags keep their frame indices.
+func (timeline *Timeline) Move(from, to int) error {
+	if err := timeline.checkIndex(from); err != nil {
+		return err
+	}
+	if err := timeline.checkIndex(to); err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+
+	current := timeline.Current()
+	f := timeline.frames[from]
+	timeline.frames = append(timeline.frames[:from], timeline.frames[from+1:]...)
+	timeline.frames = append(timeline.frames, nil)
+	copy(timeline.frames[to+1:], timeline.frames[to:])
+	timeline.frames[to] = f
+	for i, candidate := range timeline.frames {
+		if candidate == current {
+			timeline.current = i
+		}
+	}
+	return nil
+}
+
+// SetDuration sets how long the frame at index i is shown, in milliseconds
+func (timeline *Timeline) SetDuration(i, duration int) error {
+	if err := timeline.checkIndex(i); err != nil {
+		return err
+	}
+	if duration < MinDuration || duration > MaxDuration {
+		return ErrInvalidDuration
+	}
+	timeline.frames[i].Duration = duration
+	return nil
+}
+
+// TotalDuration returns the length of one loop of the animation in milliseconds
+func (timeline *Timeline) TotalDuration() int {
+	total := 0
+	for _, f := range timeline.frames {
+		total += f.Duration
+	}
+	return total
+}
+
+// Bytes returns the approximate memory used by every frame's layers
+func (timeline *Timeline) Bytes() int {
+	total := 0
+	for _, f := range timeline.frames {
+		total += f.Layers.Bytes()
+	}
+	return total
+}
+
+// Snapshot captures the current structure of the timeline
+func (timeline *Timeline) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		frames:    timeline.Frames(),
+		durations: make([]int, len(timeline.frames)),
+		tags:      timeline.Tags(),
+		current:   timeline.current,
+	}
+	for i, f := range timeline.frames {
+		snapshot.durations[i] = f.Duration
+	}
+	return snapshot
+}
+
+// Restore returns the timeline to a previously captured structure
+func (timeline *Timeline) Restore(snapshot Snapshot) {
+	timeline.frames = make([]*Frame, len(snapshot.frames))
+	copy(timeline.frames, snapshot.frames)
+	for i, f := range timeline.frames {
+		f.Duration = snapshot.durations[i]
+	}
+	timeline.tags = make([]Tag, len(snapshot.tags))
+	copy(timeline.tags, snapshot.tags)
+	timeline.current = snapshot.current
+}
+
+// Contains returns true if the snapshot references the frame
+func (snapshot Snapshot) Contains(f *Frame) bool {
+	for _, candidate := range snapshot.frames {
+		if candidate == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Frames returns the frames referenced by the snapshot in playback order
+func (snapshot Snapshot) Frames() []*Frame {
+	return snapshot.frames
+}
+
+// insert places a frame at index i without changing the current frame,
+// extending tags that span the insertion point
+func (timeline *Timeline) insert(i int, f *Frame) {
+	timeline.frames = append(timeline.frames, nil)
+	copy(timeline.frames[i+1:], timeline.frames[i:])
+	timeline.frames[i] = f
+	timeline.shiftTagsForInsert(i)
+}
+
+// checkIndex returns ErrInvalidIndex if i does not refer to a frame
+func (timeline *Timeline) checkIndex(i int) error {
+	if i < 0 || i >= len(timeline.frames) {
+		return fmt.Errorf("%w: %d", ErrInvalidIndex, i)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@
 package brush
 
 import (
+	"image"
 	"image/color"
 	"github.com/carlomunguia/pel/apptype"
 
@@ -13,6 +14,7 @@ import (
 // Cursor configuration constants
 const (
 	DefaultCursorStrokeWidth = 3
+	GhostAlpha               = 160 // Alpha applied to the brush color for shape previews
 )
 
 // Default cursor color (medium gray)
@@ -20,22 +22,30 @@ var (
 	DefaultCursorColor = color.NRGBA{R: 80, G: 80, B: 80, A: 255}
 )
 
+// EraserColor is the color painted by the eraser (fully transparent)
+var EraserColor = color.NRGBA{R: 0, G: 0, B: 0, A: 0}
+
 // Cursor renders the brush cursor at the specified canvas coordinates.
+// While a shape tool is being dragged, drag describes the shape to preview; otherwise it is nil.
 // Returns a slice of canvas objects representing the cursor visualization.
-func Cursor(config apptype.PelCanvasConfig, brushType apptype.BrushType, ev *desktop.MouseEvent, x int, y int) []fyne.CanvasObject {
+func Cursor(config apptype.PelCanvasConfig, appState *apptype.State, ev *desktop.MouseEvent, x int, y int, drag *ShapeDrag) []fyne.CanvasObject {
+	if appState == nil {
+		return renderPixelCursor(config, x, y)
+	}
+
 	var objects []fyne.CanvasObject
 
-	switch brushType {
+	switch appState.BrushType {
 	case apptype.BrushTypePencil, apptype.BrushTypeEraser:
 		objects = renderPixelCursor(config, x, y)
 	case apptype.BrushTypeFill:
 		objects = renderFillCursor(config, x, y)
 	case apptype.BrushTypeLine:
-		objects = renderLineCursor(config, x, y)
+		objects = renderLineCursor(config, appState, x, y, drag)
 	case apptype.BrushTypeRectangle:
-		objects = renderRectangleCursor(config, x, y)
+		objects = renderRectangleCursor(config, appState, x, y, drag)
 	case apptype.BrushTypeCircle:
-		objects = renderCircleCursor(config, x, y)
+		objects = renderCircleCursor(config, appState, x, y, drag)
 	default:
 		objects = renderPixelCursor(config, x, y)
 	}
@@ -87,24 +97,71 @@ func renderFillCursor(config apptype.PelCanvasConfig, x, y int) []fyne.CanvasObj
 }
 
 // renderLineCursor creates a cursor for the line tool
-func renderLineCursor(config apptype.PelCanvasConfig, x, y int) []fyne.CanvasObject {
-	// For now, use pixel cursor
-	// TODO: Implement line tool with start/end point visualization
-	return renderPixelCursor(config, x, y)
+// While dragging, a ghost of the line is drawn from the anchor to the mouse
+func renderLineCursor(config apptype.PelCanvasConfig, appState *apptype.State, x, y int, drag *ShapeDrag) []fyne.CanvasObject {
+	if drag == nil {
+		return renderPixelCursor(config, x, y)
+	}
+	return renderGhostSpans(config, ShapeSpans(appState, *drag), ghostColor(appState.BrushColor))
 }
 
 // renderRectangleCursor creates a cursor for the rectangle tool
-func renderRectangleCursor(config apptype.PelCanvasConfig, x, y int) []fyne.CanvasObject {
-	// For now, use pixel cursor
-	// TODO: Implement rectangle preview
-	return renderPixelCursor(config, x, y)
+// While dragging, a ghost of the rectangle is drawn between the anchor and the mouse
+func renderRectangleCursor(config apptype.PelCanvasConfig, appState *apptype.State, x, y int, drag *ShapeDrag) []fyne.CanvasObject {
+	if drag == nil {
+		return renderPixelCursor(config, x, y)
+	}
+	return renderGhostSpans(config, ShapeSpans(appState, *drag), ghostColor(appState.BrushColor))
 }
 
 // renderCircleCursor creates a cursor for the circle tool
-func renderCircleCursor(config apptype.PelCanvasConfig, x, y int) []fyne.CanvasObject {
-	// For now, use pixel cursor
-	// TODO: Implement circle preview
-	return renderPixelCursor(config, x, y)
+// While dragging, a ghost of the ellipse is drawn before it is committed
+func renderCircleCursor(config apptype.PelCanvasConfig, appState *apptype.State, x, y int, drag *ShapeDrag) []fyne.CanvasObject {
+	if drag == nil {
+		return renderPixelCursor(config, x, y)
+	}
+	return renderGhostSpans(config, ShapeSpans(appState, *drag), ghostColor(appState.BrushColor))
+}
+
+// renderGhostSpans draws a translucent preview of the given pixel spans,
+// clipped to the canvas. Each span becomes a single rectangle to keep the
+// number of canvas objects low for large shapes.
+func renderGhostSpans(config apptype.PelCanvasConfig, spans []Span, c color.Color) []fyne.CanvasObject {
+	pxSize := float32(config.PxSize)
+	objects := make([]fyne.CanvasObject, 0, len(spans))
+
+	for _, span := range spans {
+		if span.Y < 0 || span.Y >= config.PxRows {
+			continue
+		}
+		x0 := max(span.X0, 0)
+		x1 := min(span.X1, config.PxCols-1)
+		if x0 > x1 {
+			continue
+		}
+
+		run := canvas.NewRectangle(c)
+		run.Move(fyne.NewPos(
+			float32(x0)*pxSize+config.CanvasOffset.X,
+			float32(span.Y)*pxSize+config.CanvasOffset.Y,
+		))
+		run.Resize(fyne.NewSize(float32(x1-x0+1)*pxSize, pxSize))
+		objects = append(objects, run)
+	}
+
+	return objects
+}
+
+// ghostColor returns a translucent version of c for shape previews
+func ghostColor(c color.Color) color.Color {
+	if c == nil {
+		return DefaultCursorColor
+	}
+	ghost := toNRGBA(c)
+	if ghost.A > GhostAlpha {
+		ghost.A = GhostAlpha
+	}
+	return ghost
 }
 
 // createCursorLine creates a styled line for cursor rendering
@@ -123,6 +180,11 @@ func TryBrush(appState *apptype.State, brushable apptype.Brushable, ev *desktop.
 		return false
 	}
 
+	// Shape tools are committed through CommitShape when the drag ends
+	if appState.BrushType.IsShape() {
+		return false
+	}
+
 	switch appState.BrushType {
 	case apptype.BrushTypePencil:
 		return tryPaintPixel(appState, brushable, ev)
@@ -130,17 +192,41 @@ func TryBrush(appState *apptype.State, brushable apptype.Brushable, ev *desktop.
 		return tryErasePixel(appState, brushable, ev)
 	case apptype.BrushTypeFill:
 		return tryFillArea(appState, brushable, ev)
-	case apptype.BrushTypeLine:
-		return tryDrawLine(appState, brushable, ev)
-	case apptype.BrushTypeRectangle:
-		return tryDrawRectangle(appState, brushable, ev)
-	case apptype.BrushTypeCircle:
-		return tryDrawCircle(appState, brushable, ev)
 	default:
 		return false
 	}
 }
 
+// TryStroke continues a freehand stroke from the previous canvas pixel to the
+// current one, painting every pixel in between so fast mouse movement leaves
+// no gaps. Pixels outside the canvas are skipped.
+// Returns true if any pixel was painted.
+func TryStroke(appState *apptype.State, brushable apptype.Brushable, from, to image.Point) bool {
+	if appState == nil || brushable == nil || !appState.BrushType.IsFreehand() {
+		return false
+	}
+
+	c := appState.BrushColor
+	if appState.BrushType == apptype.BrushTypeEraser {
+		c = EraserColor
+	}
+
+	cols, rows := brushable.GetCanvasSize()
+	painted := false
+
+	for _, p := range Line(from, to) {
+		if p.X < 0 || p.X >= cols || p.Y < 0 || p.Y >= rows {
+			continue
+		}
+		if err := brushable.SetColor(c, p.X, p.Y); err != nil {
+			continue
+		}
+		painted = true
+	}
+
+	return painted
+}
+
 // tryPaintPixel paints a single pixel with the current brush color
 func tryPaintPixel(appState *apptype.State, brushable apptype.Brushable, ev *desktop.MouseEvent) bool {
 	x, y := brushable.MouseToCanvasXY(ev)
@@ -158,8 +244,7 @@ func tryPaintPixel(appState *apptype.State, brushable apptype.Brushable, ev *des
 func tryErasePixel(appState *apptype.State, brushable apptype.Brushable, ev *desktop.MouseEvent) bool {
 	x, y := brushable.MouseToCanvasXY(ev)
 	if x != nil && y != nil && ev.Button == desktop.MouseButtonPrimary {
-		transparentColor := color.NRGBA{R: 0, G: 0, B: 0, A: 0}
-		if err := brushable.SetColor(transparentColor, *x, *y); err != nil {
+		if err := brushable.SetColor(EraserColor, *x, *y); err != nil {
 			return false
 		}
 		return true
@@ -169,32 +254,13 @@ func tryErasePixel(appState *apptype.State, brushable apptype.Brushable, ev *des
 
 // tryFillArea fills an area with the current brush color (flood fill)
 func tryFillArea(appState *apptype.State, brushable apptype.Brushable, ev *desktop.MouseEvent) bool {
-	// TODO: Implement flood fill algorithm
 	x, y := brushable.MouseToCanvasXY(ev)
 	if x != nil && y != nil && ev.Button == desktop.MouseButtonPrimary {
-		// Placeholder: just paint single pixel for now
-		if err := brushable.SetColor(appState.BrushColor, *x, *y); err != nil {
+		filled, err := FloodFill(brushable, appState.BrushColor, *x, *y, appState.FillOptions)
+		if err != nil {
 			return false
 		}
-		return true
+		return filled > 0
 	}
 	return false
 }
-
-// tryDrawLine draws a line between two points
-func tryDrawLine(appState *apptype.State, brushable apptype.Brushable, ev *desktop.MouseEvent) bool {
-	// TODO: Implement line drawing with start/end point tracking
-	return tryPaintPixel(appState, brushable, ev)
-}
-
-// tryDrawRectangle draws a rectangle
-func tryDrawRectangle(appState *apptype.State, brushable apptype.Brushable, ev *desktop.MouseEvent) bool {
-	// TODO: Implement rectangle drawing
-	return tryPaintPixel(appState, brushable, ev)
-}
-
-// tryDrawCircle draws a circle
-func tryDrawCircle(appState *apptype.State, brushable apptype.Brushable, ev *desktop.MouseEvent) bool {
-	// TODO: Implement circle drawing
-	return tryPaintPixel(appState, brushable, ev)
-}
@@ -0,0 +1,223 @@
+// Package brush provides the flood fill algorithm used by the fill tool.
+package brush
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"github.com/carlomunguia/pel/apptype"
+)
+
+// Pixel classification states used while filling
+const (
+	pixelUnknown uint8 = iota // Pixel has not been read yet
+	pixelMatch                // Pixel matches the target color
+	pixelNoMatch              // Pixel does not match the target color
+	pixelFilled               // Pixel is already part of the filled region
+)
+
+// fillRegion caches pixel classifications so every pixel is read at most once
+type fillRegion struct {
+	brushable  apptype.Brushable
+	cols, rows int
+	target     color.NRGBA
+	tolerance  int
+	states     []uint8
+}
+
+// FloodFill replaces pixels matching the color at (x, y) with c.
+// In contiguous mode only the region connected to (x, y) is filled, using a
+// scanline algorithm so large canvases never recurse. In global mode every
+// matching pixel on the canvas is replaced.
+// Returns the number of pixels changed.
+func FloodFill(brushable apptype.Brushable, c color.Color, x, y int, opts apptype.FillOptions) (int, error) {
+	if brushable == nil {
+		return 0, fmt.Errorf("brushable cannot be nil")
+	}
+	if c == nil {
+		return 0, fmt.Errorf("color cannot be nil")
+	}
+	if err := opts.Validate(); err != nil {
+		return 0, fmt.Errorf("invalid fill options: %w", err)
+	}
+
+	cols, rows := brushable.GetCanvasSize()
+	if x < 0 || x >= cols || y < 0 || y >= rows {
+		return 0, fmt.Errorf("coordinates out of bounds: (%d, %d)", x, y)
+	}
+
+	seed, err := brushable.GetPixelColor(x, y)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read seed pixel: %w", err)
+	}
+
+	target := toNRGBA(seed)
+	replacement := toNRGBA(c)
+
+	// Filling a region with its own color is a no-op
+	if opts.Tolerance == apptype.MinFillTolerance && colorsWithinTolerance(target, replacement, 0) {
+		return 0, nil
+	}
+
+	region := &fillRegion{
+		brushable: brushable,
+		cols:      cols,
+		rows:      rows,
+		target:    target,
+		tolerance: opts.Tolerance,
+		states:    make([]uint8, cols*rows),
+	}
+
+	var spans []Span
+	if opts.Global {
+		spans = region.matchingSpans()
+	} else {
+		spans = region.connectedSpans(x, y, opts.Connectivity)
+	}
+
+	// Paint the collected spans
+	filled := 0
+	for _, span := range spans {
+		for px := span.X0; px <= span.X1; px++ {
+			if err := brushable.SetColor(replacement, px, span.Y); err != nil {
+				return filled, fmt.Errorf("failed to fill pixel (%d, %d): %w", px, span.Y, err)
+			}
+			filled++
+		}
+	}
+
+	return filled, nil
+}
+
+// connectedSpans collects the spans connected to the seed pixel using a scanline fill
+func (region *fillRegion) connectedSpans(x, y int, connectivity apptype.FillConnectivity) []Span {
+	var spans []Span
+	stack := []image.Point{{X: x, Y: y}}
+
+	for len(stack) > 0 {
+		seed := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if !region.matches(seed.X, seed.Y) {
+			continue
+		}
+
+		// Extend the run to the left and right
+		left, right := seed.X, seed.X
+		for left > 0 && region.matches(left-1, seed.Y) {
+			left--
+		}
+		for right < region.cols-1 && region.matches(right+1, seed.Y) {
+			right++
+		}
+
+		region.markFilled(left, right, seed.Y)
+		spans = append(spans, Span{X0: left, X1: right, Y: seed.Y})
+
+		// Diagonal neighbours extend the scan range by one pixel on each side
+		scanFrom, scanTo := left, right
+		if connectivity == apptype.FillConnectivity8 {
+			scanFrom = max(left-1, 0)
+			scanTo = min(right+1, region.cols-1)
+		}
+
+		// Push one seed for every matching run in the rows above and below
+		for _, ny := range [2]int{seed.Y - 1, seed.Y + 1} {
+			if ny < 0 || ny >= region.rows {
+				continue
+			}
+
+			inRun := false
+			for nx := scanFrom; nx <= scanTo; nx++ {
+				if region.matches(nx, ny) {
+					if !inRun {
+						stack = append(stack, image.Point{X: nx, Y: ny})
+						inRun = true
+					}
+				} else {
+					inRun = false
+				}
+			}
+		}
+	}
+
+	return spans
+}
+
+// matchingSpans collects every run of matching pixels on the canvas
+func (region *fillRegion) matchingSpans() []Span {
+	var spans []Span
+
+	for y := 0; y < region.rows; y++ {
+		for x := 0; x < region.cols; x++ {
+			if !region.matches(x, y) {
+				continue
+			}
+
+			start := x
+			for x+1 < region.cols && region.matches(x+1, y) {
+				x++
+			}
+
+			region.markFilled(start, x, y)
+			spans = append(spans, Span{X0: start, X1: x, Y: y})
+		}
+	}
+
+	return spans
+}
+
+// matches reports whether the pixel matches the target color and is not yet filled
+func (region *fillRegion) matches(x, y int) bool {
+	index := y*region.cols + x
+
+	switch region.states[index] {
+	case pixelMatch:
+		return true
+	case pixelNoMatch, pixelFilled:
+		return false
+	}
+
+	c, err := region.brushable.GetPixelColor(x, y)
+	if err == nil && colorsWithinTolerance(region.target, toNRGBA(c), region.tolerance) {
+		region.states[index] = pixelMatch
+		return true
+	}
+
+	region.states[index] = pixelNoMatch
+	return false
+}
+
+// markFilled marks a horizontal run of pixels as part of the filled region
+func (region *fillRegion) markFilled(x0, x1, y int) {
+	row := y * region.cols
+	for x := x0; x <= x1; x++ {
+		region.states[row+x] = pixelFilled
+	}
+}
+
+// colorsWithinTolerance reports whether every channel of a and b differs by at most tolerance.
+// Fully transparent colors always match each other regardless of their RGB values.
+func colorsWithinTolerance(a, b color.NRGBA, tolerance int) bool {
+	if a.A == 0 && b.A == 0 {
+		return true
+	}
+
+	return channelDiff(a.R, b.R) <= tolerance &&
+		channelDiff(a.G, b.G) <= tolerance &&
+		channelDiff(a.B, b.B) <= tolerance &&
+		channelDiff(a.A, b.A) <= tolerance
+}
+
+// channelDiff returns the absolute difference between two color channels
+func channelDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// toNRGBA converts any color to non-premultiplied 8-bit RGBA
+func toNRGBA(c color.Color) color.NRGBA {
+	return color.NRGBAModel.Convert(c).(color.NRGBA)
+}
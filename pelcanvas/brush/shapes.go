@@ -0,0 +1,438 @@
+// Package brush provides shape rasterization for the two-point drawing tools.
+package brush
+
+import (
+	"image"
+	"math"
+	"sort"
+	"github.com/carlomunguia/pel/apptype"
+
+	"fyne.io/fyne/v2"
+)
+
+// snapDirections are the pixel-art friendly slopes a constrained line snaps to.
+// Only the first octant is listed; the signs of the drag are applied afterwards.
+var snapDirections = []image.Point{
+	{X: 1, Y: 0}, // 0 degrees
+	{X: 2, Y: 1}, // 1:2 slope
+	{X: 1, Y: 1}, // 45 degrees
+	{X: 1, Y: 2}, // 2:1 slope
+	{X: 0, Y: 1}, // 90 degrees
+}
+
+// Span is a horizontal run of pixels [X0, X1] on row Y
+type Span struct {
+	X0, X1, Y int
+}
+
+// ShapeDrag describes an in-progress drag of a shape tool
+type ShapeDrag struct {
+	Start     image.Point      // Canvas pixel where the drag began
+	End       image.Point      // Canvas pixel currently under the mouse
+	Modifiers fyne.KeyModifier // Keyboard modifiers held during the drag
+}
+
+// Constrained reports whether the shape should be constrained (Shift held)
+func (drag ShapeDrag) Constrained() bool {
+	return drag.Modifiers&fyne.KeyModifierShift != 0
+}
+
+// FromCenter reports whether the shape should be drawn outwards from the anchor (Alt held)
+func (drag ShapeDrag) FromCenter() bool {
+	return drag.Modifiers&fyne.KeyModifierAlt != 0
+}
+
+// ShapeSpans returns the canvas pixels covered by the shape for the given tool.
+// The spans never overlap, so they can be drawn with a translucent preview.
+// Spans may lie outside the canvas; callers are responsible for clipping.
+func ShapeSpans(appState *apptype.State, drag ShapeDrag) []Span {
+	if appState == nil {
+		return nil
+	}
+
+	switch appState.BrushType {
+	case apptype.BrushTypeLine:
+		end := drag.End
+		if drag.Constrained() {
+			end = SnapLineEnd(drag.Start, drag.End)
+		}
+		return pointsToSpans(Line(drag.Start, end))
+	case apptype.BrushTypeRectangle:
+		end := drag.End
+		if drag.Constrained() {
+			end = squareEnd(drag.Start, drag.End)
+		}
+		return Rectangle(image.Rectangle{Min: drag.Start, Max: end}.Canon(), appState.ShapeOptions)
+	case apptype.BrushTypeCircle:
+		return Ellipse(ellipseBounds(drag), appState.ShapeOptions)
+	default:
+		return nil
+	}
+}
+
+// CommitShape paints the shape described by drag onto the brushable surface.
+// Returns true if any pixel was painted.
+func CommitShape(appState *apptype.State, brushable apptype.Brushable, drag ShapeDrag) bool {
+	if appState == nil || brushable == nil {
+		return false
+	}
+
+	cols, rows := brushable.GetCanvasSize()
+	painted := false
+
+	for _, span := range ShapeSpans(appState, drag) {
+		if span.Y < 0 || span.Y >= rows {
+			continue
+		}
+		for x := max(span.X0, 0); x <= min(span.X1, cols-1); x++ {
+			if err := brushable.SetColor(appState.BrushColor, x, span.Y); err != nil {
+				continue
+			}
+			painted = true
+		}
+	}
+
+	return painted
+}
+
+// Line rasterizes a line between two points using Bresenham's algorithm.
+// Both end points are included.
+func Line(start, end image.Point) []image.Point {
+	dx := absInt(end.X - start.X)
+	dy := -absInt(end.Y - start.Y)
+	sx := signInt(end.X - start.X)
+	sy := signInt(end.Y - start.Y)
+
+	points := make([]image.Point, 0, max(dx, -dy)+1)
+	x, y := start.X, start.Y
+	err := dx + dy
+
+	for {
+		points = append(points, image.Point{X: x, Y: y})
+		if x == end.X && y == end.Y {
+			break
+		}
+
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y += sy
+		}
+	}
+
+	return points
+}
+
+// Rectangle rasterizes a rectangle whose corners are the inclusive pixel
+// coordinates rect.Min and rect.Max. Outlines are drawn inwards with the
+// configured stroke width; filled rectangles cover every pixel.
+func Rectangle(rect image.Rectangle, opts apptype.ShapeOptions) []Span {
+	width := max(opts.StrokeWidth, apptype.MinStrokeWidth)
+	spans := make([]Span, 0, rect.Dy()+1)
+
+	for y := rect.Min.Y; y <= rect.Max.Y; y++ {
+		// Filled shapes, the top/bottom bands, and outlines thicker than the
+		// rectangle itself cover the whole row
+		innerLeft := rect.Min.X + width
+		innerRight := rect.Max.X - width
+		if opts.Filled || y < rect.Min.Y+width || y > rect.Max.Y-width || innerLeft > innerRight {
+			spans = append(spans, Span{X0: rect.Min.X, X1: rect.Max.X, Y: y})
+			continue
+		}
+
+		spans = append(spans,
+			Span{X0: rect.Min.X, X1: innerLeft - 1, Y: y},
+			Span{X0: innerRight + 1, X1: rect.Max.X, Y: y},
+		)
+	}
+
+	return spans
+}
+
+// Ellipse rasterizes the ellipse inscribed in the inclusive pixel rectangle
+// rect.Min..rect.Max. Both odd and even diameters produce symmetric shapes.
+// Outlines thicker than one pixel are the difference between the ellipse and
+// a second ellipse inset by the stroke width.
+func Ellipse(rect image.Rectangle, opts apptype.ShapeOptions) []Span {
+	width := max(opts.StrokeWidth, apptype.MinStrokeWidth)
+	points := ellipsePoints(rect)
+
+	if !opts.Filled && width == apptype.MinStrokeWidth {
+		return outlineSpans(points)
+	}
+
+	outer := filledSpans(points)
+	if opts.Filled {
+		return outer
+	}
+
+	inset := image.Rectangle{
+		Min: rect.Min.Add(image.Point{X: width, Y: width}),
+		Max: rect.Max.Sub(image.Point{X: width, Y: width}),
+	}
+	if inset.Min.X > inset.Max.X || inset.Min.Y > inset.Max.Y {
+		return outer
+	}
+
+	inner := make(map[int]Span)
+	for _, span := range filledSpans(ellipsePoints(inset)) {
+		inner[span.Y] = span
+	}
+
+	// Subtract the inner ellipse from each row of the outer one
+	spans := make([]Span, 0, 2*len(outer))
+	for _, span := range outer {
+		hole, ok := inner[span.Y]
+		if !ok {
+			spans = append(spans, span)
+			continue
+		}
+		if hole.X0 > span.X0 {
+			spans = append(spans, Span{X0: span.X0, X1: hole.X0 - 1, Y: span.Y})
+		}
+		if hole.X1 < span.X1 {
+			spans = append(spans, Span{X0: hole.X1 + 1, X1: span.X1, Y: span.Y})
+		}
+	}
+
+	return spans
+}
+
+// ellipseBounds returns the inclusive bounding rectangle of an ellipse drag.
+// Shift forces a circle and Alt treats the anchor as the center.
+func ellipseBounds(drag ShapeDrag) image.Rectangle {
+	dx, dy := drag.End.X-drag.Start.X, drag.End.Y-drag.Start.Y
+
+	if drag.Constrained() {
+		side := max(absInt(dx), absInt(dy))
+		dx = side * signOrOne(dx)
+		dy = side * signOrOne(dy)
+	}
+
+	if drag.FromCenter() {
+		radius := image.Point{X: absInt(dx), Y: absInt(dy)}
+		return image.Rectangle{Min: drag.Start.Sub(radius), Max: drag.Start.Add(radius)}
+	}
+
+	return image.Rectangle{Min: drag.Start, Max: drag.Start.Add(image.Point{X: dx, Y: dy})}.Canon()
+}
+
+// ellipsePoints returns the outline pixels of the ellipse inscribed in the
+// inclusive rectangle using the midpoint algorithm by Alois Zingl, which
+// handles even diameters by splitting the center across two pixels
+func ellipsePoints(rect image.Rectangle) []image.Point {
+	x0, y0, x1, y1 := rect.Min.X, rect.Min.Y, rect.Max.X, rect.Max.Y
+
+	// A zero-width or zero-height ellipse is a straight line
+	if x0 == x1 || y0 == y1 {
+		return Line(rect.Min, rect.Max)
+	}
+
+	a := int64(x1 - x0)
+	b := int64(y1 - y0)
+	b1 := b & 1
+
+	// Error increments and error of the first step
+	dx := 4 * (1 - a) * b * b
+	dy := 4 * (b1 + 1) * a * a
+	err := dx + dy + b1*a*a
+
+	// Start at the middle rows
+	y0 += int((b + 1) / 2)
+	y1 = y0 - int(b1)
+	a8 := 8 * a * a
+	b8 := 8 * b * b
+
+	points := make([]image.Point, 0, 4*int(a+b+1))
+	for {
+		points = append(points,
+			image.Point{X: x1, Y: y0},
+			image.Point{X: x0, Y: y0},
+			image.Point{X: x0, Y: y1},
+			image.Point{X: x1, Y: y1},
+		)
+
+		e2 := 2 * err
+		if e2 <= dy {
+			y0++
+			y1--
+			dy += a8
+			err += dy
+		}
+		if e2 >= dx || 2*err > dy {
+			x0++
+			x1--
+			dx += b8
+			err += dx
+		}
+		if x0 > x1 {
+			break
+		}
+	}
+
+	// Flat ellipses stop early; finish their tips
+	for int64(y0-y1) <= b {
+		points = append(points,
+			image.Point{X: x0 - 1, Y: y0},
+			image.Point{X: x1 + 1, Y: y0},
+			image.Point{X: x0 - 1, Y: y1},
+			image.Point{X: x1 + 1, Y: y1},
+		)
+		y0++
+		y1--
+	}
+
+	return points
+}
+
+// outlineSpans groups arbitrary points into non-overlapping spans, row by row
+func outlineSpans(points []image.Point) []Span {
+	rows := make(map[int][]int)
+	for _, p := range points {
+		rows[p.Y] = append(rows[p.Y], p.X)
+	}
+
+	spans := make([]Span, 0, len(points))
+	for y, xs := range rows {
+		sort.Ints(xs)
+		current := Span{X0: xs[0], X1: xs[0], Y: y}
+		for _, x := range xs[1:] {
+			if x <= current.X1+1 {
+				current.X1 = max(current.X1, x)
+				continue
+			}
+			spans = append(spans, current)
+			current = Span{X0: x, X1: x, Y: y}
+		}
+		spans = append(spans, current)
+	}
+
+	return spans
+}
+
+// filledSpans returns one span per row covering the extent of the points on that row
+func filledSpans(points []image.Point) []Span {
+	rows := make(map[int]*Span)
+	for _, p := range points {
+		if span, ok := rows[p.Y]; ok {
+			span.X0 = min(span.X0, p.X)
+			span.X1 = max(span.X1, p.X)
+			continue
+		}
+		rows[p.Y] = &Span{X0: p.X, X1: p.X, Y: p.Y}
+	}
+
+	spans := make([]Span, 0, len(rows))
+	for _, span := range rows {
+		spans = append(spans, *span)
+	}
+	return spans
+}
+
+// pointsToSpans merges consecutive points on the same row into spans.
+// Points are expected in drawing order, as produced by Line.
+func pointsToSpans(points []image.Point) []Span {
+	spans := make([]Span, 0, len(points))
+
+	for _, p := range points {
+		if n := len(spans); n > 0 && spans[n-1].Y == p.Y {
+			last := &spans[n-1]
+			if p.X == last.X1+1 {
+				last.X1 = p.X
+				continue
+			}
+			if p.X == last.X0-1 {
+				last.X0 = p.X
+				continue
+			}
+		}
+		spans = append(spans, Span{X0: p.X, X1: p.X, Y: p.Y})
+	}
+
+	return spans
+}
+
+// squareEnd moves end so that the drag from start covers a square,
+// using the longer side of the drag
+func squareEnd(start, end image.Point) image.Point {
+	dx, dy := end.X-start.X, end.Y-start.Y
+	side := max(absInt(dx), absInt(dy))
+
+	return image.Point{X: start.X + signOrOne(dx)*side, Y: start.Y + signOrOne(dy)*side}
+}
+
+// SnapLineEnd constrains the end point of a line to the nearest snap direction.
+// The end point is chosen so the rasterized line repeats a clean step pattern
+// (for example exactly two pixels per step on a 1:2 slope).
+func SnapLineEnd(start, end image.Point) image.Point {
+	dx, dy := end.X-start.X, end.Y-start.Y
+	if dx == 0 && dy == 0 {
+		return end
+	}
+
+	sx, sy := 1, 1
+	if dx < 0 {
+		sx = -1
+	}
+	if dy < 0 {
+		sy = -1
+	}
+
+	// Pick the direction with the smallest angle to the drag
+	adx, ady := float64(absInt(dx)), float64(absInt(dy))
+	best := snapDirections[0]
+	bestCos := -1.0
+	for _, dir := range snapDirections {
+		length := math.Hypot(float64(dir.X), float64(dir.Y))
+		cos := (float64(dir.X)*adx + float64(dir.Y)*ady) / length
+		if cos > bestCos {
+			best, bestCos = dir, cos
+		}
+	}
+
+	// Measure the drag in pixels covered (inclusive of both ends) and
+	// round it to a whole number of steps along the chosen direction
+	spanX, spanY := adx+1, ady+1
+	lengthSq := float64(best.X*best.X + best.Y*best.Y)
+	steps := int(math.Round((float64(best.X)*spanX + float64(best.Y)*spanY) / lengthSq))
+	if steps < 1 {
+		steps = 1
+	}
+
+	return image.Point{
+		X: start.X + sx*(steps*best.X-min(best.X, 1)),
+		Y: start.Y + sy*(steps*best.Y-min(best.Y, 1)),
+	}
+}
+
+// absInt returns the absolute value of an integer
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// signOrOne returns -1 for negative values and 1 otherwise
+func signOrOne(v int) int {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
+
+// signInt returns -1, 0 or 1 depending on the sign of v
+func signInt(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	default:
+		return 0
+	}
+}
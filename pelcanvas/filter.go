@@ -0,0 +1,96 @@
+// Package pelcanvas provides image filters for the pixel canvas.
+package pelcanvas
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"github.com/carlomunguia/pel/dither"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// Filter names shown in the history
+const (
+	DitherFilterName = "Dither"
+)
+
+// Dither reduces the active layer of the current frame to the given colors
+// with a dithering pattern. Only selected pixels are changed, or the whole
+// layer if nothing is selected, and fully transparent pixels are left alone.
+// In RGB mode every pixel keeps its alpha. In indexed color mode the
+// document palette is used and colors is ignored.
+func (pelCanvas *PelCanvas) Dither(colors []color.Color, opts dither.Options) error {
+	// Floating pixels are dropped first so the copy dithered includes them
+	pelCanvas.finishGesture()
+
+	if pelCanvas.IsIndexed() {
+		colors = pelCanvas.palette[layer.TransparentIndex+1:]
+	}
+
+	target := pelCanvas.layers.Active()
+	if err := target.CanPaint(); err != nil {
+		return err
+	}
+
+	// Unselected pixels are made transparent so they pass no error on
+	src := cloneNRGBA(target.Image)
+	bounds := src.Rect
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !pelCanvas.selected(x, y) {
+				src.SetNRGBA(x, y, color.NRGBA{})
+			}
+		}
+	}
+	indices, err := dither.Apply(src, colors, opts)
+	if err != nil {
+		return err
+	}
+
+	err = pelCanvas.applyFilter(DitherFilterName, target, func(x, y int) color.Color {
+		c := src.NRGBAAt(x, y)
+		if c.A == 0 {
+			return nil
+		}
+		if target.IsIndexed() {
+			return colors[indices.ColorIndexAt(x, y)]
+		}
+		match := color.NRGBAModel.Convert(colors[indices.ColorIndexAt(x, y)]).(color.NRGBA)
+		match.A = c.A
+		return match
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Dithered %q to %d colors (%s, strength %.2f)", target.Name, len(colors), opts.Method, opts.Strength)
+	return nil
+}
+
+// applyFilter repaints every selected pixel of a layer with the color
+// returned by filter, skipping pixels for which it returns nil, and records
+// the changed pixels as a single history step
+func (pelCanvas *PelCanvas) applyFilter(name string, target *layer.Layer, filter func(x, y int) color.Color) error {
+	if target == nil {
+		return fmt.Errorf("no layer to filter")
+	}
+
+	pelCanvas.finishGesture()
+
+	stroke := NewStroke(pelCanvas.appState.BrushType, target)
+	bounds := target.Image.Rect
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !pelCanvas.selected(x, y) {
+				continue
+			}
+			if c := filter(x, y); c != nil {
+				pelCanvas.paintPixel(target, c, x, y, stroke)
+			}
+		}
+	}
+
+	pelCanvas.recordPixels(name, stroke, pelCanvas.selection)
+	pelCanvas.Refresh()
+	return nil
+}
@@ -0,0 +1,34 @@
+package pelcanvas
+
+import (
+	"image/color"
+	"testing"
+	"github.com/carlomunguia/pel/dither"
+)
+
+func TestDitherKeepsAlpha(t *testing.T) {
+	pelCanvas := newTestCanvas(t, 4, 1)
+	img := pelCanvas.layers.Active().Image
+	for x, a := range []uint8{255, 128, 1, 0} {
+		img.SetNRGBA(x, 0, color.NRGBA{R: 200, G: 10, B: 10, A: a})
+	}
+
+	red := color.NRGBA{R: 255, A: 255}
+	blue := color.NRGBA{B: 255, A: 255}
+	opts := dither.DefaultOptions()
+	opts.Method = dither.MethodNone
+	if err := pelCanvas.Dither([]color.Color{red, blue}, opts); err != nil {
+		t.Fatalf("Dither() error = %v", err)
+	}
+
+	for x, want := range []color.NRGBA{
+		{R: 255, A: 255},
+		{R: 255, A: 128},
+		{R: 255, A: 1},
+		{R: 200, G: 10, B: 10, A: 0},
+	} {
+		if got := img.NRGBAAt(x, 0); got != want {
+			t.Errorf("pixel (%d, 0) = %v, want %v", x, got, want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package pelcanvas provides animation frame management for the pixel canvas.
+package pelcanvas
+
+import (
+	"fmt"
+	"log"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// Approximate memory used by the structure of a frame in a snapshot,
+// excluding its layers
+const frameSnapshotBytes = 32
+
+// Timeline returns the animation frames of the drawing.
+// Use the PelCanvas frame methods to modify it so changes are undoable.
+func (pelCanvas *PelCanvas) Timeline() *animation.Timeline {
+	return pelCanvas.timeline
+}
+
+// CurrentFrame returns the index of the frame that is shown and edited
+func (pelCanvas *PelCanvas) CurrentFrame() int {
+	return pelCanvas.timeline.CurrentIndex()
+}
+
+// SetCurrentFrame shows the frame at index i for editing.
+// Changing frames is not recorded in the history.
+func (pelCanvas *PelCanvas) SetCurrentFrame(i int) error {
+	if i < 0 || i >= pelCanvas.timeline.Len() {
+		return fmt.Errorf("%w: %d", animation.ErrInvalidIndex, i)
+	}
+
+	pelCanvas.finishGesture()
+	pelCanvas.showFrame(i)
+	return nil
+}
+
+// AddFrame inserts an empty frame with the same layers after the current frame
+func (pelCanvas *PelCanvas) AddFrame() error {
+	return pelCanvas.changeFrames("Add Frame", func(timeline *animation.Timeline) error {
+		_, err := timeline.Add()
+		return err
+	})
+}
+
+// DuplicateFrame inserts a copy of the frame at index i after it
+func (pelCanvas *PelCanvas) DuplicateFrame(i int) error {
+	return pelCanvas.changeFrames("Duplicate Frame", func(timeline *animation.Timeline) error {
+		_, err := timeline.Duplicate(i)
+		return err
+	})
+}
+
+// DeleteFrame removes the frame at index i
+func (pelCanvas *PelCanvas) DeleteFrame(i int) error {
+	return pelCanvas.changeFrames("Delete Frame", func(timeline *animation.Timeline) error {
+		return timeline.Delete(i)
+	})
+}
+
+// MoveFrame moves the frame at index from to index to
+func (pelCanvas *PelCanvas) MoveFrame(from, to int) error {
+	return pelCanvas.changeFrames("Move Frame", func(timeline *animation.Timeline) error {
+		return timeline.Move(from, to)
+	})
+}
+
+// SetFrameDuration sets how long the frame at index i is shown, in milliseconds
+func (pelCanvas *PelCanvas) SetFrameDuration(i, duration int) error {
+	return pelCanvas.changeFrames("Frame Duration", func(timeline *animation.Timeline) error {
+		return timeline.SetDuration(i, duration)
+	})
+}
+
+// AddFrameTag names a range of frames
+func (pelCanvas *PelCanvas) AddFrameTag(tag animation.Tag) error {
+	return pelCanvas.changeFrames("Add Tag", func(timeline *animation.Timeline) error {
+		return timeline.AddTag(tag)
+	})
+}
+
+// RemoveFrameTag removes the tag with the given name
+func (pelCanvas *PelCanvas) RemoveFrameTag(name string) error {
+	return pelCanvas.changeFrames("Remove Tag", func(timeline *animation.Timeline) error {
+		return timeline.RemoveTag(name)
+	})
+}
+
+// SetPlaying marks whether the animation is being previewed.
+// Onion skins are hidden during playback.
+func (pelCanvas *PelCanvas) SetPlaying(playing bool) {
+	if playing == pelCanvas.playing {
+		return
+	}
+
+	pelCanvas.finishGesture()
+	pelCanvas.playing = playing
+	pelCanvas.onionDirty = true
+	pelCanvas.framesChanged()
+	pelCanvas.Refresh()
+}
+
+// IsPlaying returns true while the animation is being previewed
+func (pelCanvas *PelCanvas) IsPlaying() bool {
+	return pelCanvas.playing
+}
+
+// AddFrameListener registers a function called whenever the frames or the current frame change
+func (pelCanvas *PelCanvas) AddFrameListener(listener func()) {
+	if listener != nil {
+		pelCanvas.frameListeners = append(pelCanvas.frameListeners, listener)
+	}
+}
+
+// changeFrames applies a structural change to the timeline and records it in
+// the history under the given name
+func (pelCanvas *PelCanvas) changeFrames(name string, change func(timeline *animation.Timeline) error) error {
+	pelCanvas.finishGesture()
+
+	before := pelCanvas.timeline.Snapshot()
+	if err := change(pelCanvas.timeline); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	after := pelCanvas.timeline.Snapshot()
+
+	pelCanvas.restoreFrames(after)
+	pelCanvas.record(&frameCommand{name: name, before: before, after: after})
+
+	log.Printf("%s: %d frames, current frame %d", name, pelCanvas.timeline.Len(), pelCanvas.timeline.CurrentIndex())
+	return nil
+}
+
+// restoreFrames applies a timeline snapshot and shows its current frame
+func (pelCanvas *PelCanvas) restoreFrames(snapshot animation.Snapshot) {
+	pelCanvas.timeline.Restore(snapshot)
+	pelCanvas.syncPalette()
+	pelCanvas.layers = pelCanvas.timeline.Current().Layers
+	pelCanvas.invalidate(pelCanvas.timeline.Bounds())
+	pelCanvas.layersChanged()
+	pelCanvas.framesChanged()
+	pelCanvas.Refresh()
+}
+
+// showFrame makes the frame at index i current and recomposites the canvas
+func (pelCanvas *PelCanvas) showFrame(i int) {
+	if i == pelCanvas.timeline.CurrentIndex() {
+		return
+	}
+	if err := pelCanvas.timeline.SetCurrent(i); err != nil {
+		return
+	}
+
+	pelCanvas.layers = pelCanvas.timeline.Current().Layers
+	pelCanvas.invalidate(pelCanvas.timeline.Bounds())
+	pelCanvas.layersChanged()
+	pelCanvas.framesChanged()
+	pelCanvas.Refresh()
+}
+
+// revealLayer shows the frame holding the given layer so that undoing or
+// redoing an edit on another frame is visible
+func (pelCanvas *PelCanvas) revealLayer(l *layer.Layer) {
+	if i := pelCanvas.timeline.FindLayer(l); i >= 0 {
+		pelCanvas.showFrame(i)
+	}
+}
+
+// framesChanged notifies every frame listener and marks the onion skins out of date
+func (pelCanvas *PelCanvas) framesChanged() {
+	pelCanvas.onionDirty = true
+	for _, listener := range pelCanvas.frameListeners {
+		listener()
+	}
+}
+
+// frameCommand records a structural change to the timeline such as adding,
+// reordering or removing frames, or changing frame durations or tags
+type frameCommand struct {
+	name   string
+	before animation.Snapshot
+	after  animation.Snapshot
+}
+
+// Name returns the name of the operation
+func (cmd *frameCommand) Name() string {
+	return cmd.name
+}
+
+// Undo restores the timeline as it was before the change
+func (cmd *frameCommand) Undo(pelCanvas *PelCanvas) error {
+	pelCanvas.restoreFrames(cmd.before)
+	return nil
+}
+
+// Redo restores the timeline as it was after the change
+func (cmd *frameCommand) Redo(pelCanvas *PelCanvas) error {
+	pelCanvas.restoreFrames(cmd.after)
+	return nil
+}
+
+// Size returns the approximate memory used by the command in bytes.
+// Frames present in only one of the snapshots are kept alive by the command.
+func (cmd *frameCommand) Size() int {
+	total := (len(cmd.before.Frames()) + len(cmd.after.Frames())) * frameSnapshotBytes
+	for _, f := range cmd.before.Frames() {
+		if !cmd.after.Contains(f) {
+			total += f.Layers.Bytes()
+		}
+	}
+	for _, f := range cmd.after.Frames() {
+		if !cmd.before.Contains(f) {
+			total += f.Layers.Bytes()
+		}
+	}
+	return total
+}
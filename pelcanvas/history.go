@@ -0,0 +1,642 @@
+// Package pelcanvas provides undo/redo history for the pixel canvas.
+package pelcanvas
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"unsafe"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+)
+
+// History configuration constants
+const (
+	DefaultHistoryLimit = 64 << 20 // Default memory cap for the history (64 MiB)
+	MinHistoryLimit     = 1 << 20  // Smallest accepted memory cap (1 MiB)
+
+	// Approximate memory used by each recorded pixel: the change itself plus
+	// its entry in the stroke's position index
+	strokeBytesPerPixel = int(unsafe.Sizeof(PixelChange{})) + 48
+
+	HistoryThumbnailSize = 32      // Largest side of a history thumbnail in pixels
+	HistoryRootName      = "Start" // Name of the oldest state in a new history
+)
+
+// Command is a reversible canvas mutation recorded in the history
+type Command interface {
+	// Name returns a short, human-readable description of the mutation
+	Name() string
+
+	// Undo reverts the mutation on the canvas
+	Undo(pelCanvas *PelCanvas) error
+
+	// Redo reapplies the mutation on the canvas
+	Redo(pelCanvas *PelCanvas) error
+
+	// Size returns the approximate memory used by the command in bytes
+	Size() int
+}
+
+// HistoryNode is a single canvas state in the history tree.
+// Every node except the root holds the command that produced it from its parent.
+type HistoryNode struct {
+	name      string
+	cmd       Command      // Command leading from the parent to this state (nil for the root)
+	thumbnail *image.NRGBA // Small preview of the canvas in this state
+	parent    *HistoryNode
+	children  []*HistoryNode
+	active    *HistoryNode // Child followed by redo (the most recently visited branch)
+	seq       int          // Creation order, used to discard the oldest branches first
+}
+
+// Name returns the name of the action that produced this state
+func (node *HistoryNode) Name() string {
+	return node.name
+}
+
+// Thumbnail returns a small preview of the canvas in this state (may be nil)
+func (node *HistoryNode) Thumbnail() image.Image {
+	if node.thumbnail == nil {
+		return nil
+	}
+	return node.thumbnail
+}
+
+// Parent returns the previous state, or nil for the oldest state in the history
+func (node *HistoryNode) Parent() *HistoryNode {
+	return node.parent
+}
+
+// Children returns the states recorded after this one, oldest branch first
+func (node *HistoryNode) Children() []*HistoryNode {
+	return node.children
+}
+
+// size returns the approximate memory used by the node in bytes
+func (node *HistoryNode) size() int {
+	total := imageBytes(node.Thumbnail())
+	if node.cmd != nil {
+		total += node.cmd.Size()
+	}
+	return total
+}
+
+// HistoryEntryState describes how a history entry relates to the current state
+type HistoryEntryState int
+
+const (
+	HistoryEntryDone      HistoryEntryState = iota // Applied, leads to the current state
+	HistoryEntryCurrent                            // The current state
+	HistoryEntryUndone                             // Undone, restored by redo
+	HistoryEntryAlternate                          // On an alternate branch
+)
+
+// HistoryEntry is a history node flattened for display in a list
+type HistoryEntry struct {
+	Node  *HistoryNode
+	Depth int // Branch nesting level, 0 for the main line
+	State HistoryEntryState
+}
+
+// History is a tree of canvas states with a memory cap.
+// Undoing and then making a new change starts a new branch; the undone
+// states are kept as an alternate branch that can be jumped back to.
+// When the cap is exceeded, alternate branches are discarded first and then
+// the oldest states on the current line.
+type History struct {
+	root    *HistoryNode
+	current *HistoryNode
+	limit   int // Memory cap in bytes
+	used    int // Memory used by every node except the root in bytes
+	nextSeq int
+}
+
+// NewHistory creates an empty history with the given memory cap in bytes
+func NewHistory(limit int) *History {
+	if limit < MinHistoryLimit {
+		limit = MinHistoryLimit
+	}
+
+	root := &HistoryNode{name: HistoryRootName}
+	return &History{
+		root:    root,
+		current: root,
+		limit:   limit,
+		nextSeq: 1,
+	}
+}
+
+// Push records a new command as a child of the current state.
+// States that were undone are kept as an alternate branch.
+func (history *History) Push(cmd Command) *HistoryNode {
+	return history.push(cmd, nil)
+}
+
+// push records a new command with a thumbnail of the resulting canvas
+func (history *History) push(cmd Command, thumbnail *image.NRGBA) *HistoryNode {
+	if cmd == nil {
+		return nil
+	}
+
+	node := &HistoryNode{
+		name:      cmd.Name(),
+		cmd:       cmd,
+		thumbnail: thumbnail,
+		parent:    history.current,
+		seq:       history.nextSeq,
+	}
+	history.nextSeq++
+
+	history.current.children = append(history.current.children, node)
+	history.current.active = node
+	history.current = node
+	history.used += node.size()
+	history.trim()
+
+	return node
+}
+
+// Root returns the oldest state in the history
+func (history *History) Root() *HistoryNode {
+	return history.root
+}
+
+// Current returns the current state
+func (history *History) Current() *HistoryNode {
+	return history.current
+}
+
+// CanUndo returns true if there is a command to undo
+func (history *History) CanUndo() bool {
+	return history.current.parent != nil
+}
+
+// CanRedo returns true if there is a command to redo
+func (history *History) CanRedo() bool {
+	return history.current.active != nil
+}
+
+// UndoName returns the name of the command that would be undone, or "" if none
+func (history *History) UndoName() string {
+	if !history.CanUndo() {
+		return ""
+	}
+	return history.current.name
+}
+
+// RedoName returns the name of the command that would be redone, or "" if none
+func (history *History) RedoName() string {
+	if !history.CanRedo() {
+		return ""
+	}
+	return history.current.active.name
+}
+
+// Contains returns true if the node is still part of the history
+func (history *History) Contains(node *HistoryNode) bool {
+	for node != nil && node.parent != nil {
+		node = node.parent
+	}
+	return node != nil && node == history.root
+}
+
+// Entries returns every state in the history in display order.
+// Alternate branches are listed right after the state they branch from,
+// nested one level deeper, followed by the rest of their parent's line.
+func (history *History) Entries() []HistoryEntry {
+	done := make(map[*HistoryNode]bool)
+	for node := history.current.parent; node != nil; node = node.parent {
+		done[node] = true
+	}
+
+	undone := make(map[*HistoryNode]bool)
+	for node := history.current.active; node != nil; node = node.active {
+		undone[node] = true
+	}
+
+	entries := make([]HistoryEntry, 0)
+	var visit func(node *HistoryNode, depth int)
+	visit = func(node *HistoryNode, depth int) {
+		for node != nil {
+			state := HistoryEntryAlternate
+			switch {
+			case node == history.current:
+				state = HistoryEntryCurrent
+			case done[node]:
+				state = HistoryEntryDone
+			case undone[node]:
+				state = HistoryEntryUndone
+			}
+			entries = append(entries, HistoryEntry{Node: node, Depth: depth, State: state})
+
+			for _, child := range node.children {
+				if child != node.active {
+					visit(child, depth+1)
+				}
+			}
+			node = node.active
+		}
+	}
+	visit(history.root, 0)
+
+	return entries
+}
+
+// SetLimit updates the memory cap, discarding old states if needed
+func (history *History) SetLimit(limit int) {
+	if limit < MinHistoryLimit {
+		limit = MinHistoryLimit
+	}
+	history.limit = limit
+	history.trim()
+}
+
+// Used returns the approximate memory used by the history in bytes
+func (history *History) Used() int {
+	return history.used
+}
+
+// Clear discards every recorded state except the current one
+func (history *History) Clear() {
+	current := history.current
+	history.detach(history.root)
+
+	current.cmd = nil
+	current.parent = nil
+	current.children = nil
+	current.active = nil
+	history.root = current
+	history.used = 0
+}
+
+// trim discards states until the history fits its memory cap.
+// The current state and the one before it are always kept so the most
+// recent action can be undone.
+func (history *History) trim() {
+	dropped := 0
+	for history.used > history.limit {
+		if branch := history.oldestBranch(); branch != nil {
+			dropped += history.removeBranch(branch)
+			continue
+		}
+
+		if !history.dropRoot() {
+			break
+		}
+		dropped++
+	}
+
+	if dropped > 0 {
+		log.Printf("History limit reached: discarded %d oldest actions", dropped)
+	}
+}
+
+// oldestBranch returns the oldest node that is not on the path from the
+// root to the current state but whose parent is
+func (history *History) oldestBranch() *HistoryNode {
+	var oldest *HistoryNode
+	var next *HistoryNode
+	for node := history.current; node != nil; next, node = node, node.parent {
+		for _, child := range node.children {
+			if child == next {
+				continue
+			}
+			if oldest == nil || child.seq < oldest.seq {
+				oldest = child
+			}
+		}
+	}
+	return oldest
+}
+
+// removeBranch discards a node and all of its descendants.
+// Returns the number of states discarded.
+func (history *History) removeBranch(branch *HistoryNode) int {
+	parent := branch.parent
+	for i, child := range parent.children {
+		if child == branch {
+			parent.children = append(parent.children[:i], parent.children[i+1:]...)
+			break
+		}
+	}
+	if parent.active == branch {
+		parent.active = nil
+	}
+
+	return history.detach(branch)
+}
+
+// detach unlinks a node and its descendants so they no longer belong to the
+// history and subtracts their memory. Returns the number of nodes detached.
+func (history *History) detach(node *HistoryNode) int {
+	count := 0
+	stack := []*HistoryNode{node}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		stack = append(stack, n.children...)
+
+		if n.parent != nil {
+			history.used -= n.size()
+		}
+		n.parent = nil
+		n.children = nil
+		n.active = nil
+		count++
+	}
+	return count
+}
+
+// dropRoot makes the second oldest state the new root.
+// Returns false if that would discard the last undoable action.
+func (history *History) dropRoot() bool {
+	root := history.root
+	next := root.active
+	if root == history.current || next == nil || next == history.current {
+		return false
+	}
+
+	// The new root's command can no longer be undone
+	history.used -= next.size()
+	next.cmd = nil
+	next.parent = nil
+	history.used += next.size()
+
+	root.children = nil
+	root.active = nil
+	history.root = next
+	return true
+}
+
+// undo reverts the current state's command and moves to its parent
+func (history *History) undo(pelCanvas *PelCanvas) error {
+	node := history.current
+	if node.parent == nil {
+		return fmt.Errorf("nothing to undo")
+	}
+
+	if err := node.cmd.Undo(pelCanvas); err != nil {
+		return fmt.Errorf("failed to undo %s: %w", node.name, err)
+	}
+
+	node.parent.active = node
+	history.current = node.parent
+	return nil
+}
+
+// redo reapplies a child's command and moves to it
+func (history *History) redo(pelCanvas *PelCanvas, child *HistoryNode) error {
+	if child == nil || child.parent != history.current {
+		return fmt.Errorf("nothing to redo")
+	}
+
+	if err := child.cmd.Redo(pelCanvas); err != nil {
+		return fmt.Errorf("failed to redo %s: %w", child.name, err)
+	}
+
+	history.current.active = child
+	history.current = child
+	return nil
+}
+
+// Undo reverts the most recent command on the canvas
+func (pelCanvas *PelCanvas) Undo() error {
+	// Finish any gesture in progress so it can be undone as a whole
+	pelCanvas.finishGesture()
+
+	name := pelCanvas.history.UndoName()
+	if err := pelCanvas.history.undo(pelCanvas); err != nil {
+		return err
+	}
+
+	log.Printf("Undid: %s", name)
+	pelCanvas.historyChanged()
+	pelCanvas.Refresh()
+	return nil
+}
+
+// Redo reapplies the most recently undone command on the canvas
+func (pelCanvas *PelCanvas) Redo() error {
+	pelCanvas.finishGesture()
+
+	history := pelCanvas.history
+	name := history.RedoName()
+	if err := history.redo(pelCanvas, history.current.active); err != nil {
+		return err
+	}
+
+	log.Printf("Redid: %s", name)
+	pelCanvas.historyChanged()
+	pelCanvas.Refresh()
+	return nil
+}
+
+// JumpTo moves the canvas to any state in the history, including states on
+// alternate branches. Commands are undone back to the closest state shared
+// with the target and then redone along the target's branch.
+func (pelCanvas *PelCanvas) JumpTo(target *HistoryNode) error {
+	pelCanvas.finishGesture()
+
+	history := pelCanvas.history
+	if !history.Contains(target) {
+		return fmt.Errorf("state is no longer in the history")
+	}
+	if target == history.current {
+		return nil
+	}
+
+	// Find the closest state shared by the current state and the target
+	ancestors := make(map[*HistoryNode]bool)
+	for node := history.current; node != nil; node = node.parent {
+		ancestors[node] = true
+	}
+	path := make([]*HistoryNode, 0)
+	common := target
+	for !ancestors[common] {
+		path = append(path, common)
+		common = common.parent
+	}
+
+	// Always notify listeners, even if a command fails part way
+	defer func() {
+		pelCanvas.historyChanged()
+		pelCanvas.Refresh()
+	}()
+
+	for history.current != common {
+		if err := history.undo(pelCanvas); err != nil {
+			return err
+		}
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		if err := history.redo(pelCanvas, path[i]); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Jumped to history state: %s", target.name)
+	return nil
+}
+
+// History returns the canvas undo/redo history
+func (pelCanvas *PelCanvas) History() *History {
+	return pelCanvas.history
+}
+
+// SetHistoryLimit updates the memory cap of the undo history in bytes
+func (pelCanvas *PelCanvas) SetHistoryLimit(limit int) {
+	pelCanvas.history.SetLimit(limit)
+	pelCanvas.historyChanged()
+}
+
+// AddHistoryListener registers a function called whenever the history changes
+func (pelCanvas *PelCanvas) AddHistoryListener(listener func()) {
+	if listener != nil {
+		pelCanvas.historyListeners = append(pelCanvas.historyListeners, listener)
+	}
+}
+
+// record pushes a command onto the history and notifies listeners.
+// The command must already have been applied to the canvas.
+func (pelCanvas *PelCanvas) record(cmd Command) {
+	pelCanvas.history.push(cmd, Thumbnail(pelCanvas.Flatten(), HistoryThumbnailSize))
+	pelCanvas.historyChanged()
+}
+
+// finishGesture ends any stroke, shape drag or marquee drag in progress and
+// drops any floating pixels onto their layer
+func (pelCanvas *PelCanvas) finishGesture() {
+	if pelCanvas.IsStroking() {
+		pelCanvas.mouseState.shapeDrag = nil
+		pelCanvas.EndStroke()
+	}
+	pelCanvas.mouseState.selectionDrag = nil
+	pelCanvas.dropFloating()
+}
+
+// historyChanged notifies every history listener
+func (pelCanvas *PelCanvas) historyChanged() {
+	for _, listener := range pelCanvas.historyListeners {
+		listener()
+	}
+}
+
+// Name returns the name of the tool that made the stroke
+func (stroke *Stroke) Name() string {
+	return stroke.Tool.String()
+}
+
+// Undo restores every pixel to its color before the stroke
+func (stroke *Stroke) Undo(pelCanvas *PelCanvas) error {
+	if stroke.Layer == nil {
+		return fmt.Errorf("stroke has no layer")
+	}
+	pelCanvas.revealLayer(stroke.Layer)
+	for _, change := range stroke.changes {
+		if stroke.Layer.IsIndexed() {
+			pelCanvas.writeIndex(stroke.Layer, change.BeforeIndex, change.X, change.Y)
+			continue
+		}
+		pelCanvas.writePixel(stroke.Layer, change.Before, change.X, change.Y)
+	}
+	return nil
+}
+
+// Redo paints every pixel with its color after the stroke
+func (stroke *Stroke) Redo(pelCanvas *PelCanvas) error {
+	if stroke.Layer == nil {
+		return fmt.Errorf("stroke has no layer")
+	}
+	pelCanvas.revealLayer(stroke.Layer)
+	for _, change := range stroke.changes {
+		if stroke.Layer.IsIndexed() {
+			pelCanvas.writeIndex(stroke.Layer, change.AfterIndex, change.X, change.Y)
+			continue
+		}
+		pelCanvas.writePixel(stroke.Layer, change.After, change.X, change.Y)
+	}
+	return nil
+}
+
+// Size returns the approximate memory used by the stroke in bytes
+func (stroke *Stroke) Size() int {
+	return len(stroke.changes) * strokeBytesPerPixel
+}
+
+// documentCommand records an operation that replaced the whole drawing,
+// such as loading a file, creating a new drawing or changing the color mode.
+// The timelines are kept by reference: moving through the history always
+// undoes every later edit before this command, so the timelines are back in
+// their original state whenever they are swapped in.
+type documentCommand struct {
+	name          string
+	before        *animation.Timeline
+	after         *animation.Timeline
+	beforePalette color.Palette // Palette before the replacement, nil in RGB mode
+	afterPalette  color.Palette // Palette after the replacement, nil in RGB mode
+}
+
+// Name returns the name of the operation
+func (cmd *documentCommand) Name() string {
+	return cmd.name
+}
+
+// Undo swaps the previous drawing back in
+func (cmd *documentCommand) Undo(pelCanvas *PelCanvas) error {
+	pelCanvas.replaceTimeline(cmd.before, cmd.beforePalette)
+	return nil
+}
+
+// Redo swaps the replacement drawing back in
+func (cmd *documentCommand) Redo(pelCanvas *PelCanvas) error {
+	pelCanvas.replaceTimeline(cmd.after, cmd.afterPalette)
+	return nil
+}
+
+// Size returns the approximate memory used by both drawings in bytes
+func (cmd *documentCommand) Size() int {
+	return cmd.before.Bytes() + cmd.after.Bytes()
+}
+
+// Thumbnail returns a nearest-neighbour scaled copy of img whose largest side
+// is at most maxSize pixels. Small images are copied at their original size.
+func Thumbnail(img image.Image, maxSize int) *image.NRGBA {
+	if img == nil || maxSize <= 0 {
+		return nil
+	}
+
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW <= 0 || srcH <= 0 {
+		return nil
+	}
+
+	dstW, dstH := srcW, srcH
+	if srcW > maxSize || srcH > maxSize {
+		if srcW >= srcH {
+			dstW, dstH = maxSize, max(srcH*maxSize/srcW, 1)
+		} else {
+			dstW, dstH = max(srcW*maxSize/srcH, 1), maxSize
+		}
+	}
+
+	thumb := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		srcY := bounds.Min.Y + y*srcH/dstH
+		for x := 0; x < dstW; x++ {
+			srcX := bounds.Min.X + x*srcW/dstW
+			thumb.Set(x, y, img.At(srcX, srcY))
+		}
+	}
+	return thumb
+}
+
+// imageBytes returns the approximate memory used by an image in bytes
+func imageBytes(img image.Image) int {
+	if img == nil {
+		return 0
+	}
+	bounds := img.Bounds()
+	return bounds.Dx() * bounds.Dy() * 4
+}
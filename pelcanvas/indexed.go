@@ -0,0 +1,299 @@
+// Package pelcanvas provides the indexed color mode of the pixel canvas.
+package pelcanvas
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"github.com/carlomunguia/pel/palette"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+	"github.com/carlomunguia/pel/util"
+)
+
+// Approximate memory used by each palette entry kept by a palette command:
+// an interface value holding a color.NRGBA
+const paletteEntryBytes = 20
+
+// Indexed color mode names shown in the history
+const (
+	IndexedModeName = "Indexed Color Mode"
+	RGBModeName     = "RGB Color Mode"
+)
+
+// IsIndexed returns true if the drawing is in indexed color mode, where
+// every pixel stores an index into the document palette
+func (pelCanvas *PelCanvas) IsIndexed() bool {
+	return pelCanvas.palette != nil
+}
+
+// Palette returns a copy of the document palette, or nil in RGB mode.
+// Entry layer.TransparentIndex is the reserved transparent color.
+func (pelCanvas *PelCanvas) Palette() color.Palette {
+	if pelCanvas.palette == nil {
+		return nil
+	}
+	return append(color.Palette(nil), pelCanvas.palette...)
+}
+
+// ConvertToIndexed switches the drawing to indexed color mode with the
+// given colors as the palette. Every pixel is replaced by the nearest
+// palette color.
+func (pelCanvas *PelCanvas) ConvertToIndexed(colors []color.Color) error {
+	if pelCanvas.IsIndexed() {
+		return nil
+	}
+	if len(colors) == 0 {
+		return fmt.Errorf("palette has no colors")
+	}
+	return pelCanvas.changeMode(IndexedModeName, layer.NewPalette(colors))
+}
+
+// ConvertToRGB switches the drawing back to RGB mode, keeping every pixel's color
+func (pelCanvas *PelCanvas) ConvertToRGB() error {
+	if !pelCanvas.IsIndexed() {
+		return nil
+	}
+	return pelCanvas.changeMode(RGBModeName, nil)
+}
+
+// changeMode replaces the drawing with a copy converted to the given
+// palette (nil for RGB) and records the conversion so it can be undone
+func (pelCanvas *PelCanvas) changeMode(name string, p color.Palette) error {
+	return pelCanvas.transformDocument(name, p, func(l *layer.Layer) {
+		l.ClearPalette()
+	})
+}
+
+// SetPaletteColor changes palette entry i, recoloring every pixel that uses it.
+// Consecutive changes to the same entry are merged into one history step.
+func (pelCanvas *PelCanvas) SetPaletteColor(i int, c color.Color) error {
+	if !pelCanvas.IsIndexed() {
+		return fmt.Errorf("drawing is not in indexed color mode")
+	}
+	if i <= layer.TransparentIndex || i >= len(pelCanvas.palette) || c == nil {
+		return fmt.Errorf("palette index out of range: %d", i)
+	}
+	if util.ColorsEqual(pelCanvas.palette[i], c) {
+		return nil
+	}
+
+	pelCanvas.finishGesture()
+
+	before := pelCanvas.palette
+	after := pelCanvas.Palette()
+	after[i] = color.NRGBAModel.Convert(c)
+	pelCanvas.applyPalette(after)
+
+	// Dragging the color picker sends many changes; keep them as one step
+	history := pelCanvas.history
+	if cmd, ok := history.current.cmd.(*paletteCommand); ok && cmd.index == i && len(history.current.children) == 0 {
+		cmd.after = after
+		history.current.thumbnail = Thumbnail(pelCanvas.Flatten(), HistoryThumbnailSize)
+		pelCanvas.historyChanged()
+		return nil
+	}
+
+	pelCanvas.record(&paletteCommand{name: "Edit Palette Color", index: i, before: before, after: after})
+	return nil
+}
+
+// SetPaletteColors replaces the palette colors after the transparent entry,
+// keeping every pixel's index. Missing entries keep their current color and
+// extra colors are added to the palette.
+func (pelCanvas *PelCanvas) SetPaletteColors(colors []color.Color) error {
+	if !pelCanvas.IsIndexed() {
+		return fmt.Errorf("drawing is not in indexed color mode")
+	}
+
+	pelCanvas.finishGesture()
+
+	before := pelCanvas.palette
+	after := layer.NewPalette(colors)
+	if len(after) < len(before) {
+		after = append(after, before[len(after):]...)
+	}
+	pelCanvas.applyPalette(after)
+	pelCanvas.record(&paletteCommand{name: "Replace Palette", index: -1, before: before, after: after})
+	return nil
+}
+
+// RemapPalette replaces the document palette with the given colors and
+// moves every pixel to the nearest new color under the metric
+func (pelCanvas *PelCanvas) RemapPalette(colors []color.Color, metric palette.Metric) error {
+	if !pelCanvas.IsIndexed() {
+		return fmt.Errorf("drawing is not in indexed color mode")
+	}
+	if len(colors) == 0 {
+		return fmt.Errorf("palette has no colors")
+	}
+
+	p := layer.NewPalette(colors)
+	matcher := palette.NewMatcher(p[layer.TransparentIndex+1:], metric)
+	return pelCanvas.transformDocument("Remap Palette", p, func(l *layer.Layer) {
+		bounds := l.Image.Rect
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				index := uint8(layer.TransparentIndex)
+				if c := l.At(x, y); c.A != 0 {
+					index = uint8(matcher.Nearest(c) + 1)
+				}
+				l.SetIndex(x, y, index)
+			}
+		}
+	})
+}
+
+// AddPaletteListener registers a function called whenever the color mode or
+// the palette changes
+func (pelCanvas *PelCanvas) AddPaletteListener(listener func()) {
+	if listener != nil {
+		pelCanvas.paletteListeners = append(pelCanvas.paletteListeners, listener)
+	}
+}
+
+// FlattenIndexed returns the visible layers composited into an image using
+// the document palette, or nil in RGB mode. A drawing with a single plain
+// visible layer keeps its exact indices; otherwise each composited pixel
+// takes the nearest palette color.
+func (pelCanvas *PelCanvas) FlattenIndexed() *image.Paletted {
+	if !pelCanvas.IsIndexed() {
+		return nil
+	}
+
+	composite := pelCanvas.Flatten()
+	bounds := composite.Bounds()
+	img := image.NewPaletted(bounds, pelCanvas.Palette())
+
+	visible := make([]*layer.Layer, 0, 1)
+	for _, l := range pelCanvas.layers.Layers() {
+		if l.Visible {
+			visible = append(visible, l)
+		}
+	}
+	if len(visible) == 1 && visible[0].IsIndexed() &&
+		visible[0].Opacity == layer.MaxOpacity && visible[0].Blend == layer.BlendNormal {
+		copy(img.Pix, visible[0].Indices.Pix)
+		return img
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.SetColorIndex(x, y, layer.NearestIndex(img.Palette, composite.At(x, y)))
+		}
+	}
+	return img
+}
+
+// paletteIndex returns the palette entry to paint for color c. The selected
+// swatch is preferred so that swatches sharing a color stay distinct.
+func (pelCanvas *PelCanvas) paletteIndex(c color.Color) uint8 {
+	if i := pelCanvas.appState.SwatchSelected + 1; i < len(pelCanvas.palette) && util.ColorsEqual(pelCanvas.palette[i], c) {
+		return uint8(i)
+	}
+	return layer.NearestIndex(pelCanvas.palette, c)
+}
+
+// writeIndex sets a palette index on a layer without recording it in a
+// stroke or checking the layer lock, and marks the pixel for recompositing
+func (pelCanvas *PelCanvas) writeIndex(target *layer.Layer, index uint8, x, y int) {
+	target.SetIndex(x, y, index)
+	pelCanvas.invalidate(image.Rect(x, y, x+1, y+1))
+}
+
+// applyPalette swaps in a new palette, recolors the whole drawing and
+// notifies listeners
+func (pelCanvas *PelCanvas) applyPalette(p color.Palette) {
+	pelCanvas.palette = p
+	pelCanvas.syncPalette()
+	pelCanvas.invalidate(pelCanvas.timeline.Bounds())
+	pelCanvas.layersChanged()
+	pelCanvas.framesChanged()
+	pelCanvas.paletteChanged()
+	pelCanvas.Refresh()
+}
+
+// syncPalette makes every layer of the drawing use the document palette.
+// Layers added since the last sync, such as new or merged layers, are
+// indexed by nearest color; layers bound to an older palette are recolored.
+func (pelCanvas *PelCanvas) syncPalette() {
+	if pelCanvas.palette == nil {
+		return
+	}
+
+	for _, frame := range pelCanvas.timeline.Frames() {
+		for _, l := range frame.Layers.Layers() {
+			if !l.IsIndexed() || !samePalette(l.Indices.Palette, pelCanvas.palette) {
+				l.SetPalette(pelCanvas.palette)
+			}
+		}
+	}
+}
+
+// paletteChanged notifies every palette listener
+func (pelCanvas *PelCanvas) paletteChanged() {
+	for _, listener := range pelCanvas.paletteListeners {
+		listener()
+	}
+}
+
+// samePalette returns true if both palettes share the same backing entries
+func samePalette(a, b color.Palette) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// palettedLayer creates a background layer from a paletted image along with
+// a document palette for it. Transparent image entries share the reserved
+// transparent index; entries past the palette limit use the nearest color.
+func palettedLayer(img *image.Paletted) (*layer.Layer, color.Palette) {
+	p := color.Palette{color.NRGBA{}}
+	remap := make([]uint8, len(img.Palette))
+	for i, c := range img.Palette {
+		switch {
+		case color.NRGBAModel.Convert(c).(color.NRGBA).A == 0:
+			remap[i] = layer.TransparentIndex
+		case len(p) <= layer.MaxPaletteColors:
+			remap[i] = uint8(len(p))
+			p = append(p, color.NRGBAModel.Convert(c))
+		default:
+			remap[i] = layer.NearestIndex(p, c)
+		}
+	}
+
+	indices := image.NewPaletted(img.Rect, p)
+	for i, index := range img.Pix {
+		if int(index) < len(remap) {
+			indices.Pix[i] = remap[index]
+		}
+	}
+	return layer.FromPaletted(layer.BackgroundName, indices, p), p
+}
+
+// paletteCommand records a change to the colors of the document palette
+type paletteCommand struct {
+	name   string
+	index  int // Palette entry that was edited, or -1 if the whole palette was replaced
+	before color.Palette
+	after  color.Palette
+}
+
+// Name returns the name of the operation
+func (cmd *paletteCommand) Name() string {
+	return cmd.name
+}
+
+// Undo restores the palette as it was before the change
+func (cmd *paletteCommand) Undo(pelCanvas *PelCanvas) error {
+	pelCanvas.applyPalette(cmd.before)
+	return nil
+}
+
+// Redo restores the palette as it was after the change
+func (cmd *paletteCommand) Redo(pelCanvas *PelCanvas) error {
+	pelCanvas.applyPalette(cmd.after)
+	return nil
+}
+
+// Size returns the approximate memory used by both palettes in bytes
+func (cmd *paletteCommand) Size() int {
+	return (len(cmd.before) + len(cmd.after)) * paletteEntryBytes
+}
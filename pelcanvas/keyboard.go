@@ -0,0 +1,61 @@
+// Package pelcanvas provides keyboard modifier tracking for the pixel canvas.
+package pelcanvas
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// KeyDown records a modifier key being pressed.
+// Mouse move events do not carry modifiers, so shape previews rely on this
+// to react to Shift and Alt while a drag is in progress.
+func (pelCanvas *PelCanvas) KeyDown(ev *fyne.KeyEvent) {
+	if ev == nil {
+		return
+	}
+
+	if modifier := keyToModifier(ev.Name); modifier != 0 {
+		pelCanvas.setModifiers(pelCanvas.mouseState.modifiers | modifier)
+	}
+}
+
+// KeyUp records a modifier key being released
+func (pelCanvas *PelCanvas) KeyUp(ev *fyne.KeyEvent) {
+	if ev == nil {
+		return
+	}
+
+	if modifier := keyToModifier(ev.Name); modifier != 0 {
+		pelCanvas.setModifiers(pelCanvas.mouseState.modifiers &^ modifier)
+	}
+}
+
+// setModifiers updates the held modifiers and refreshes any shape preview
+func (pelCanvas *PelCanvas) setModifiers(modifiers fyne.KeyModifier) {
+	if modifiers == pelCanvas.mouseState.modifiers {
+		return
+	}
+
+	pelCanvas.mouseState.modifiers = modifiers
+	if pelCanvas.mouseState.shapeDrag != nil {
+		pelCanvas.updateShapePreview()
+		pelCanvas.Refresh()
+	}
+}
+
+// keyToModifier maps a modifier key name to its modifier flag
+// Returns 0 for keys that are not modifiers
+func keyToModifier(key fyne.KeyName) fyne.KeyModifier {
+	switch key {
+	case desktop.KeyShiftLeft, desktop.KeyShiftRight:
+		return fyne.KeyModifierShift
+	case desktop.KeyAltLeft, desktop.KeyAltRight:
+		return fyne.KeyModifierAlt
+	case desktop.KeyControlLeft, desktop.KeyControlRight:
+		return fyne.KeyModifierControl
+	case desktop.KeySuperLeft, desktop.KeySuperRight:
+		return fyne.KeyModifierSuper
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,157 @@
+// Package layer provides layer blend modes for the pixel canvas.
+package layer
+
+import (
+	"math"
+)
+
+// BlendMode determines how a layer's colors combine with the layers below it
+type BlendMode int
+
+// Blend mode constants
+const (
+	BlendNormal BlendMode = iota
+	BlendMultiply
+	BlendScreen
+	BlendOverlay
+	BlendDarken
+	BlendLighten
+	BlendAdditive
+	BlendDifference
+	BlendColor
+)
+
+// BlendModes lists every blend mode in display order
+var BlendModes = []BlendMode{
+	BlendNormal,
+	BlendMultiply,
+	BlendScreen,
+	BlendOverlay,
+	BlendDarken,
+	BlendLighten,
+	BlendAdditive,
+	BlendDifference,
+	BlendColor,
+}
+
+// String returns a human-readable name for the blend mode
+func (mode BlendMode) String() string {
+	switch mode {
+	case BlendNormal:
+		return "Normal"
+	case BlendMultiply:
+		return "Multiply"
+	case BlendScreen:
+		return "Screen"
+	case BlendOverlay:
+		return "Overlay"
+	case BlendDarken:
+		return "Darken"
+	case BlendLighten:
+		return "Lighten"
+	case BlendAdditive:
+		return "Additive"
+	case BlendDifference:
+		return "Difference"
+	case BlendColor:
+		return "Color"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the blend mode is valid
+func (mode BlendMode) IsValid() bool {
+	return mode >= BlendNormal && mode <= BlendColor
+}
+
+// ParseBlendMode returns the blend mode with the given name
+func ParseBlendMode(name string) (BlendMode, bool) {
+	for _, mode := range BlendModes {
+		if mode.String() == name {
+			return mode, true
+		}
+	}
+	return BlendNormal, false
+}
+
+// rgb is a color with channels in the range 0-1
+type rgb struct {
+	r, g, b float64
+}
+
+// blend returns the blended color of a source pixel over a backdrop pixel,
+// before alpha compositing
+func (mode BlendMode) blend(backdrop, source rgb) rgb {
+	switch mode {
+	case BlendMultiply:
+		return separable(backdrop, source, func(b, s float64) float64 { return b * s })
+	case BlendScreen:
+		return separable(backdrop, source, screen)
+	case BlendOverlay:
+		return separable(backdrop, source, func(b, s float64) float64 {
+			if b <= 0.5 {
+				return 2 * b * s
+			}
+			return screen(b, 2*s-1)
+		})
+	case BlendDarken:
+		return separable(backdrop, source, math.Min)
+	case BlendLighten:
+		return separable(backdrop, source, math.Max)
+	case BlendAdditive:
+		return separable(backdrop, source, func(b, s float64) float64 { return math.Min(b+s, 1) })
+	case BlendDifference:
+		return separable(backdrop, source, func(b, s float64) float64 { return math.Abs(b - s) })
+	case BlendColor:
+		// Hue and saturation of the source with the luminosity of the backdrop
+		return setLum(source, lum(backdrop))
+	default:
+		return source
+	}
+}
+
+// separable applies a blend function to each channel independently
+func separable(backdrop, source rgb, f func(b, s float64) float64) rgb {
+	return rgb{
+		r: f(backdrop.r, source.r),
+		g: f(backdrop.g, source.g),
+		b: f(backdrop.b, source.b),
+	}
+}
+
+// screen is the inverse of multiplying the inverted channels
+func screen(b, s float64) float64 {
+	return b + s - b*s
+}
+
+// lum returns the luminosity of a color as defined by the W3C compositing spec
+func lum(c rgb) float64 {
+	return 0.3*c.r + 0.59*c.g + 0.11*c.b
+}
+
+// setLum shifts a color to the given luminosity, clipping it back into gamut
+func setLum(c rgb, l float64) rgb {
+	d := l - lum(c)
+	c = rgb{r: c.r + d, g: c.g + d, b: c.b + d}
+
+	l = lum(c)
+	n := math.Min(c.r, math.Min(c.g, c.b))
+	x := math.Max(c.r, math.Max(c.g, c.b))
+
+	if n < 0 {
+		c = rgb{
+			r: l + (c.r-l)*l/(l-n),
+			g: l + (c.g-l)*l/(l-n),
+			b: l + (c.b-l)*l/(l-n),
+		}
+	}
+	if x > 1 {
+		c = rgb{
+			r: l + (c.r-l)*(1-l)/(x-l),
+			g: l + (c.g-l)*(1-l)/(x-l),
+			b: l + (c.b-l)*(1-l)/(x-l),
+		}
+	}
+	return c
+}
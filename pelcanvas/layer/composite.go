@@ -0,0 +1,88 @@
+// Package layer provides layer compositing for the pixel canvas.
+package layer
+
+import (
+	"image"
+	"math"
+)
+
+// Composite draws src over dst inside r, combining the colors with the given
+// blend mode. The source alpha is scaled by opacity. Both images use
+// non-premultiplied alpha; r is clipped to the bounds of both images.
+// Colors are blended following the W3C compositing and blending model, so a
+// blended pixel over a transparent backdrop keeps its own color.
+func Composite(dst, src *image.NRGBA, r image.Rectangle, mode BlendMode, opacity uint8) {
+	r = r.Intersect(dst.Rect).Intersect(src.Rect)
+	if r.Empty() || opacity == MinOpacity {
+		return
+	}
+
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		si := src.PixOffset(r.Min.X, y)
+		di := dst.PixOffset(r.Min.X, y)
+
+		for x := r.Min.X; x < r.Max.X; x, si, di = x+1, si+4, di+4 {
+			s := src.Pix[si : si+4 : si+4]
+			d := dst.Pix[di : di+4 : di+4]
+
+			if mode == BlendNormal {
+				compositeNormal(d, s, opacity)
+			} else {
+				compositeBlend(d, s, mode, opacity)
+			}
+		}
+	}
+}
+
+// compositeNormal draws one source pixel over a destination pixel using
+// integer arithmetic
+func compositeNormal(d, s []uint8, opacity uint8) {
+	sa := mul255(uint32(s[3]), uint32(opacity))
+	if sa == 0 {
+		return
+	}
+	if sa == MaxOpacity {
+		d[0], d[1], d[2], d[3] = s[0], s[1], s[2], MaxOpacity
+		return
+	}
+
+	// Weights of the source and destination colors, scaled by 255*255
+	ws := sa * MaxOpacity
+	wd := uint32(d[3]) * (MaxOpacity - sa)
+	total := ws + wd
+
+	d[0] = uint8((uint32(s[0])*ws + uint32(d[0])*wd + total/2) / total)
+	d[1] = uint8((uint32(s[1])*ws + uint32(d[1])*wd + total/2) / total)
+	d[2] = uint8((uint32(s[2])*ws + uint32(d[2])*wd + total/2) / total)
+	d[3] = uint8((total + MaxOpacity/2) / MaxOpacity)
+}
+
+// compositeBlend draws one source pixel over a destination pixel, mixing the
+// source color with the blended color where the two pixels overlap
+func compositeBlend(d, s []uint8, mode BlendMode, opacity uint8) {
+	sa := float64(s[3]) / MaxOpacity * float64(opacity) / MaxOpacity
+	if sa == 0 {
+		return
+	}
+	ba := float64(d[3]) / MaxOpacity
+
+	source := rgb{r: float64(s[0]) / MaxOpacity, g: float64(s[1]) / MaxOpacity, b: float64(s[2]) / MaxOpacity}
+	backdrop := rgb{r: float64(d[0]) / MaxOpacity, g: float64(d[1]) / MaxOpacity, b: float64(d[2]) / MaxOpacity}
+	blended := mode.blend(backdrop, source)
+
+	alpha := sa + ba*(1-sa)
+	mix := func(cs, cb, b float64) uint8 {
+		c := (sa*(1-ba)*cs + sa*ba*b + (1-sa)*ba*cb) / alpha
+		return uint8(math.Round(math.Max(0, math.Min(c, 1)) * MaxOpacity))
+	}
+
+	d[0] = mix(source.r, backdrop.r, blended.r)
+	d[1] = mix(source.g, backdrop.g, blended.g)
+	d[2] = mix(source.b, backdrop.b, blended.b)
+	d[3] = uint8(math.Round(alpha * MaxOpacity))
+}
+
+// mul255 multiplies two values in the range 0-255, treating 255 as 1.0
+func mul255(a, b uint32) uint32 {
+	return (a*b + MaxOpacity/2) / MaxOpacity
+}
@@ -0,0 +1,117 @@
+// Package layer provides palette indices for layers of indexed documents.
+package layer
+
+import (
+	"image"
+	"image/color"
+)
+
+// Indexed palette constants
+const (
+	TransparentIndex = 0   // Palette entry reserved for transparent pixels
+	MaxPaletteColors = 255 // Largest number of colors besides the transparent entry
+)
+
+// NewPalette creates an indexed document palette: the transparent entry
+// followed by the given colors, at most MaxPaletteColors of them
+func NewPalette(colors []color.Color) color.Palette {
+	p := color.Palette{color.NRGBA{}}
+	for _, c := range colors {
+		if len(p) > MaxPaletteColors {
+			break
+		}
+		if c != nil {
+			p = append(p, color.NRGBAModel.Convert(c))
+		}
+	}
+	return p
+}
+
+// NearestIndex returns the palette entry closest to c. Fully transparent
+// colors always map to TransparentIndex and other colors never do.
+func NearestIndex(p color.Palette, c color.Color) uint8 {
+	if len(p) <= 1 || color.NRGBAModel.Convert(c).(color.NRGBA).A == 0 {
+		return TransparentIndex
+	}
+	return uint8(p[1:].Index(c) + 1)
+}
+
+// IsIndexed returns true if the layer stores palette indices
+func (l *Layer) IsIndexed() bool {
+	return l.Indices != nil
+}
+
+// SetPalette makes the layer indexed with the given palette. A layer that is
+// not yet indexed has each pixel replaced by the nearest palette color; an
+// indexed layer keeps its indices and is recolored from the new palette.
+func (l *Layer) SetPalette(p color.Palette) {
+	if l.Indices == nil {
+		l.Indices = image.NewPaletted(l.Image.Rect, p)
+		for y := l.Image.Rect.Min.Y; y < l.Image.Rect.Max.Y; y++ {
+			for x := l.Image.Rect.Min.X; x < l.Image.Rect.Max.X; x++ {
+				l.Indices.SetColorIndex(x, y, NearestIndex(p, l.Image.NRGBAAt(x, y)))
+			}
+		}
+	}
+
+	l.Indices.Palette = p
+	l.Recolor()
+}
+
+// ClearPalette drops the palette indices, keeping the current colors
+func (l *Layer) ClearPalette() {
+	l.Indices = nil
+}
+
+// Recolor repaints every pixel with the palette color of its index
+func (l *Layer) Recolor() {
+	if l.Indices == nil {
+		return
+	}
+
+	p := l.Indices.Palette
+	for i, index := range l.Indices.Pix {
+		c := color.NRGBA{}
+		if int(index) < len(p) && index != TransparentIndex {
+			c = color.NRGBAModel.Convert(p[index]).(color.NRGBA)
+		}
+		l.Image.Pix[i*4], l.Image.Pix[i*4+1], l.Image.Pix[i*4+2], l.Image.Pix[i*4+3] = c.R, c.G, c.B, c.A
+	}
+}
+
+// IndexAt returns the palette index of the pixel at (x, y), or
+// TransparentIndex if the layer is not indexed
+func (l *Layer) IndexAt(x, y int) uint8 {
+	if l.Indices == nil {
+		return TransparentIndex
+	}
+	return l.Indices.ColorIndexAt(x, y)
+}
+
+// SetIndex writes a palette index and its color to the pixel at (x, y).
+// It has no effect on layers that are not indexed.
+func (l *Layer) SetIndex(x, y int, index uint8) {
+	if l.Indices == nil || !(image.Point{X: x, Y: y}).In(l.Image.Rect) {
+		return
+	}
+
+	l.Indices.SetColorIndex(x, y, index)
+	c := color.NRGBA{}
+	if int(index) < len(l.Indices.Palette) && index != TransparentIndex {
+		c = color.NRGBAModel.Convert(l.Indices.Palette[index]).(color.NRGBA)
+	}
+	l.Image.SetNRGBA(x, y, c)
+}
+
+// FromPaletted creates an indexed layer from a paletted image whose indices
+// refer to the given document palette
+func FromPaletted(name string, img *image.Paletted, p color.Palette) *Layer {
+	bounds := img.Bounds()
+	l := New(name, bounds.Dx(), bounds.Dy())
+	l.Indices = image.NewPaletted(l.Image.Rect, p)
+	for y := 0; y < bounds.Dy(); y++ {
+		copy(l.Indices.Pix[y*l.Indices.Stride:], img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y+y):][:bounds.Dx()])
+	}
+	l.Recolor()
+	return l
+}
@@ -0,0 +1,116 @@
+// Package layer provides the layer model behind the pixel canvas.
+// It has no UI dependencies so it can be used by file formats and tools alike.
+package layer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Layer opacity limits
+const (
+	MinOpacity = 0
+	MaxOpacity = 255
+)
+
+// Default layer names
+const (
+	BackgroundName = "Background"
+	DefaultName    = "Layer"
+)
+
+// Layer errors
+var (
+	ErrLayerLocked  = errors.New("layer is locked")
+	ErrLayerHidden  = errors.New("layer is hidden")
+	ErrInvalidIndex = errors.New("layer index out of range")
+	ErrLastLayer    = errors.New("cannot remove the last layer")
+	ErrNoLayerBelow = errors.New("no layer below to merge into")
+)
+
+// Properties holds the settings of a layer that do not affect its pixels
+type Properties struct {
+	Name    string    // Display name
+	Visible bool      // Hidden layers are skipped when compositing
+	Opacity uint8     // Layer opacity, from MinOpacity (transparent) to MaxOpacity (opaque)
+	Locked  bool      // Locked layers cannot be painted on
+	Blend   BlendMode // How the layer combines with the layers below
+}
+
+// Layer is a single full-canvas image in a layer stack
+type Layer struct {
+	Properties
+	Image   *image.NRGBA
+	Indices *image.Paletted // Palette index of each pixel in indexed documents, nil otherwise
+}
+
+// New creates a transparent, visible, fully opaque layer
+func New(name string, cols, rows int) *Layer {
+	return &Layer{
+		Properties: Properties{
+			Name:    name,
+			Visible: true,
+			Opacity: MaxOpacity,
+		},
+		Image: image.NewNRGBA(image.Rect(0, 0, cols, rows)),
+	}
+}
+
+// FromImage creates a layer holding a copy of img, moved to the origin
+func FromImage(name string, img image.Image) *Layer {
+	bounds := img.Bounds()
+	l := New(name, bounds.Dx(), bounds.Dy())
+	draw.Draw(l.Image, l.Image.Bounds(), img, bounds.Min, draw.Src)
+	return l
+}
+
+// Clone returns a deep copy of the layer
+func (l *Layer) Clone() *Layer {
+	clone := &Layer{
+		Properties: l.Properties,
+		Image:      image.NewNRGBA(l.Image.Rect),
+	}
+	copy(clone.Image.Pix, l.Image.Pix)
+	if l.Indices != nil {
+		clone.Indices = image.NewPaletted(l.Indices.Rect, l.Indices.Palette)
+		copy(clone.Indices.Pix, l.Indices.Pix)
+	}
+	return clone
+}
+
+// CanPaint returns an error if the layer must not be painted on
+func (l *Layer) CanPaint() error {
+	if l.Locked {
+		return fmt.Errorf("%w: %s", ErrLayerLocked, l.Name)
+	}
+	if !l.Visible {
+		return fmt.Errorf("%w: %s", ErrLayerHidden, l.Name)
+	}
+	return nil
+}
+
+// At returns the layer pixel at (x, y)
+func (l *Layer) At(x, y int) color.NRGBA {
+	return l.Image.NRGBAAt(x, y)
+}
+
+// Set writes a pixel without checking whether the layer is locked.
+// Indexed layers store the nearest palette entry instead.
+func (l *Layer) Set(x, y int, c color.Color) {
+	if l.Indices != nil {
+		l.SetIndex(x, y, NearestIndex(l.Indices.Palette, c))
+		return
+	}
+	l.Image.Set(x, y, c)
+}
+
+// Bytes returns the approximate memory used by the layer pixels
+func (l *Layer) Bytes() int {
+	if l.Indices != nil {
+		return len(l.Image.Pix) + len(l.Indices.Pix)
+	}
+	return len(l.Image.Pix)
+}
@@ -0,0 +1,394 @@
+// Package layer provides the ordered layer stack of a drawing.
+package layer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Stack is an ordered list of equally sized layers, bottom layer first,
+// with one active layer that receives painting
+type Stack struct {
+	layers     []*Layer
+	active     int
+	cols, rows int
+	nextName   int // Number used for the next default layer name
+}
+
+// Snapshot captures the structure of a stack: which layers it holds, in
+// which order, with which properties, and which one is active.
+// Layer pixels are shared, not copied.
+type Snapshot struct {
+	layers     []*Layer
+	properties []Properties
+	active     int
+}
+
+// NewStack creates a stack with a single background layer filled with c
+func NewStack(cols, rows int, c color.Color) (*Stack, error) {
+	if cols <= 0 || rows <= 0 {
+		return nil, fmt.Errorf("invalid stack dimensions: %dx%d", cols, rows)
+	}
+
+	background := New(BackgroundName, cols, rows)
+	draw.Draw(background.Image, background.Image.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+
+	return newStack(background), nil
+}
+
+// NewStackFromImage creates a stack with a single background layer holding a copy of img
+func NewStackFromImage(img image.Image) (*Stack, error) {
+	if img == nil {
+		return nil, fmt.Errorf("image cannot be nil")
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return nil, fmt.Errorf("invalid image dimensions: %dx%d", bounds.Dx(), bounds.Dy())
+	}
+
+	return newStack(FromImage(BackgroundName, img)), nil
+}
+
+// NewStackFromLayers creates a stack from existing layers, bottom layer first.
+// Every layer must have the same dimensions.
+func NewStackFromLayers(layers []*Layer, active int) (*Stack, error) {
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("stack needs at least one layer")
+	}
+	for _, l := range layers {
+		if l == nil || l.Image == nil {
+			return nil, fmt.Errorf("layer cannot be nil")
+		}
+	}
+
+	stack := newStack(layers[0])
+	if stack.cols <= 0 || stack.rows <= 0 {
+		return nil, fmt.Errorf("invalid layer dimensions: %dx%d", stack.cols, stack.rows)
+	}
+
+	for i, l := range layers[1:] {
+		if err := stack.Insert(i+1, l); err != nil {
+			return nil, err
+		}
+	}
+	if err := stack.SetActive(active); err != nil {
+		return nil, err
+	}
+
+	stack.nextName = len(layers)
+	return stack, nil
+}
+
+// newStack creates a stack holding a single layer
+func newStack(background *Layer) *Stack {
+	bounds := background.Image.Bounds()
+	return &Stack{
+		layers:   []*Layer{background},
+		cols:     bounds.Dx(),
+		rows:     bounds.Dy(),
+		nextName: 1,
+	}
+}
+
+// Size returns the dimensions shared by every layer
+func (stack *Stack) Size() (cols, rows int) {
+	return stack.cols, stack.rows
+}
+
+// Bounds returns the rectangle covered by every layer
+func (stack *Stack) Bounds() image.Rectangle {
+	return image.Rect(0, 0, stack.cols, stack.rows)
+}
+
+// Len returns the number of layers
+func (stack *Stack) Len() int {
+	return len(stack.layers)
+}
+
+// Layer returns the layer at index i (0 is the bottom layer), or nil if out of range
+func (stack *Stack) Layer(i int) *Layer {
+	if i < 0 || i >= len(stack.layers) {
+		return nil
+	}
+	return stack.layers[i]
+}
+
+// Layers returns the layers from bottom to top
+func (stack *Stack) Layers() []*Layer {
+	layers := make([]*Layer, len(stack.layers))
+	copy(layers, stack.layers)
+	return layers
+}
+
+// Active returns the layer that receives painting
+func (stack *Stack) Active() *Layer {
+	return stack.layers[stack.active]
+}
+
+// ActiveIndex returns the index of the active layer
+func (stack *Stack) ActiveIndex() int {
+	return stack.active
+}
+
+// SetActive makes the layer at index i the active layer
+func (stack *Stack) SetActive(i int) error {
+	if err := stack.checkIndex(i); err != nil {
+		return err
+	}
+	stack.active = i
+	return nil
+}
+
+// Add inserts a new transparent layer above the active layer and makes it active
+func (stack *Stack) Add() *Layer {
+	l := New(fmt.Sprintf("%s %d", DefaultName, stack.nextName), stack.cols, stack.rows)
+	stack.nextName++
+
+	stack.insert(stack.active+1, l)
+	stack.active++
+	return l
+}
+
+// Insert adds an existing layer at index i and makes it active.
+// The layer must have the same dimensions as the stack.
+func (stack *Stack) Insert(i int, l *Layer) error {
+	if i < 0 || i > len(stack.layers) {
+		return ErrInvalidIndex
+	}
+	if l == nil || l.Image == nil {
+		return fmt.Errorf("layer cannot be nil")
+	}
+	if l.Image.Rect != stack.Bounds() {
+		return fmt.Errorf("layer size %dx%d does not match canvas size %dx%d",
+			l.Image.Rect.Dx(), l.Image.Rect.Dy(), stack.cols, stack.rows)
+	}
+
+	stack.insert(i, l)
+	stack.active = i
+	return nil
+}
+
+// Delete removes the layer at index i. The last remaining layer cannot be removed.
+func (stack *Stack) Delete(i int) error {
+	if err := stack.checkIndex(i); err != nil {
+		return err
+	}
+	if len(stack.layers) == 1 {
+		return ErrLastLayer
+	}
+
+	stack.layers = append(stack.layers[:i], stack.layers[i+1:]...)
+	if stack.active > i || stack.active == len(stack.layers) {
+		stack.active--
+	}
+	return nil
+}
+
+// Move moves the layer at index from to index to, shifting the layers in between.
+// The active layer stays the same layer.
+func (stack *Stack) Move(from, to int) error {
+	if err := stack.checkIndex(from); err != nil {
+		return err
+	}
+	if err := stack.checkIndex(to); err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+
+	active := stack.Active()
+	l := stack.layers[from]
+	stack.layers = append(stack.layers[:from], stack.layers[from+1:]...)
+	stack.insert(to, l)
+	stack.active = stack.indexOf(active)
+	return nil
+}
+
+// Duplicate inserts a copy of the layer at index i directly above it and
+// makes the copy active
+func (stack *Stack) Duplicate(i int) (*Layer, error) {
+	if err := stack.checkIndex(i); err != nil {
+		return nil, err
+	}
+
+	clone := stack.layers[i].Clone()
+	clone.Name = stack.layers[i].Name + " copy"
+
+	stack.insert(i+1, clone)
+	stack.active = i + 1
+	return clone, nil
+}
+
+// MergeDown composites the layer at index i onto the layer below it.
+// The two layers are replaced by a new layer with the lower layer's
+// properties, so the original layers are left untouched.
+func (stack *Stack) MergeDown(i int) (*Layer, error) {
+	if err := stack.checkIndex(i); err != nil {
+		return nil, err
+	}
+	if i == 0 {
+		return nil, ErrNoLayerBelow
+	}
+
+	upper := stack.layers[i]
+	merged := stack.layers[i-1].Clone()
+	if upper.Visible {
+		Composite(merged.Image, upper.Image, merged.Image.Rect, upper.Blend, upper.Opacity)
+		merged.ClearPalette() // Blended colors may not be in the palette; the canvas reindexes them
+	}
+
+	stack.layers[i-1] = merged
+	stack.layers = append(stack.layers[:i], stack.layers[i+1:]...)
+	stack.active = i - 1
+	return merged, nil
+}
+
+// SetVisible shows or hides the layer at index i
+func (stack *Stack) SetVisible(i int, visible bool) error {
+	if err := stack.checkIndex(i); err != nil {
+		return err
+	}
+	stack.layers[i].Visible = visible
+	return nil
+}
+
+// SetOpacity sets the opacity of the layer at index i
+func (stack *Stack) SetOpacity(i int, opacity uint8) error {
+	if err := stack.checkIndex(i); err != nil {
+		return err
+	}
+	stack.layers[i].Opacity = opacity
+	return nil
+}
+
+// SetBlendMode sets the blend mode of the layer at index i
+func (stack *Stack) SetBlendMode(i int, mode BlendMode) error {
+	if err := stack.checkIndex(i); err != nil {
+		return err
+	}
+	if !mode.IsValid() {
+		return fmt.Errorf("invalid blend mode: %d", mode)
+	}
+	stack.layers[i].Blend = mode
+	return nil
+}
+
+// SetLocked locks or unlocks the layer at index i
+func (stack *Stack) SetLocked(i int, locked bool) error {
+	if err := stack.checkIndex(i); err != nil {
+		return err
+	}
+	stack.layers[i].Locked = locked
+	return nil
+}
+
+// Rename changes the name of the layer at index i
+func (stack *Stack) Rename(i int, name string) error {
+	if err := stack.checkIndex(i); err != nil {
+		return err
+	}
+	if name == "" {
+		return fmt.Errorf("layer name cannot be empty")
+	}
+	stack.layers[i].Name = name
+	return nil
+}
+
+// Composite flattens the visible layers into dst inside r.
+// The area is cleared to transparent first.
+func (stack *Stack) Composite(dst *image.NRGBA, r image.Rectangle) {
+	r = r.Intersect(dst.Rect).Intersect(stack.Bounds())
+	if r.Empty() {
+		return
+	}
+
+	draw.Draw(dst, r, image.Transparent, image.Point{}, draw.Src)
+	for _, l := range stack.layers {
+		if l.Visible {
+			Composite(dst, l.Image, r, l.Blend, l.Opacity)
+		}
+	}
+}
+
+// Flatten returns a new image with every visible layer composited
+func (stack *Stack) Flatten() *image.NRGBA {
+	dst := image.NewNRGBA(stack.Bounds())
+	stack.Composite(dst, dst.Rect)
+	return dst
+}
+
+// Snapshot captures the current structure of the stack
+func (stack *Stack) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		layers:     stack.Layers(),
+		properties: make([]Properties, len(stack.layers)),
+		active:     stack.active,
+	}
+	for i, l := range stack.layers {
+		snapshot.properties[i] = l.Properties
+	}
+	return snapshot
+}
+
+// Restore returns the stack to a previously captured structure
+func (stack *Stack) Restore(snapshot Snapshot) {
+	stack.layers = make([]*Layer, len(snapshot.layers))
+	copy(stack.layers, snapshot.layers)
+	for i, l := range stack.layers {
+		l.Properties = snapshot.properties[i]
+	}
+	stack.active = snapshot.active
+}
+
+// Contains returns true if the snapshot references the layer
+func (snapshot Snapshot) Contains(l *Layer) bool {
+	for _, candidate := range snapshot.layers {
+		if candidate == l {
+			return true
+		}
+	}
+	return false
+}
+
+// Layers returns the layers referenced by the snapshot, bottom layer first
+func (snapshot Snapshot) Layers() []*Layer {
+	return snapshot.layers
+}
+
+// Bytes returns the approximate memory used by every layer in the stack
+func (stack *Stack) Bytes() int {
+	total := 0
+	for _, l := range stack.layers {
+		total += l.Bytes()
+	}
+	return total
+}
+
+// insert places a layer at index i without changing the active layer
+func (stack *Stack) insert(i int, l *Layer) {
+	stack.layers = append(stack.layers, nil)
+	copy(stack.layers[i+1:], stack.layers[i:])
+	stack.layers[i] = l
+}
+
+// indexOf returns the index of a layer in the stack, or -1 if absent
+func (stack *Stack) indexOf(l *Layer) int {
+	for i, candidate := range stack.layers {
+		if candidate == l {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkIndex returns ErrInvalidIndex if i does not refer to a layer
+func (stack *Stack) checkIndex(i int) error {
+	if i < 0 || i >= len(stack.layers) {
+		return fmt.Errorf("%w: %d", ErrInvalidIndex, i)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package pelcanvas provides layer management for the pixel canvas.
+package pelcanvas
+
+import (
+	"fmt"
+	"log"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// Approximate memory used by the structure of a layer in a snapshot,
+// excluding its pixels
+const layerSnapshotBytes = 64
+
+// Layers returns the layer stack of the current frame.
+// Use the PelCanvas layer methods to modify it so changes are undoable.
+func (pelCanvas *PelCanvas) Layers() *layer.Stack {
+	return pelCanvas.layers
+}
+
+// ActiveLayer returns the layer that receives painting
+func (pelCanvas *PelCanvas) ActiveLayer() *layer.Layer {
+	return pelCanvas.layers.Active()
+}
+
+// SetActiveLayer selects the layer that receives painting.
+// Selecting a layer is not recorded in the history.
+func (pelCanvas *PelCanvas) SetActiveLayer(i int) error {
+	if i == pelCanvas.layers.ActiveIndex() {
+		return nil
+	}
+
+	pelCanvas.finishGesture()
+	if err := pelCanvas.layers.SetActive(i); err != nil {
+		return err
+	}
+
+	pelCanvas.layersChanged()
+	return nil
+}
+
+// AddLayer adds a new transparent layer above the active layer
+func (pelCanvas *PelCanvas) AddLayer() error {
+	return pelCanvas.changeLayers("Add Layer", func(stack *layer.Stack) error {
+		stack.Add()
+		return nil
+	})
+}
+
+// DeleteLayer removes the layer at index i
+func (pelCanvas *PelCanvas) DeleteLayer(i int) error {
+	return pelCanvas.changeLayers("Delete Layer", func(stack *layer.Stack) error {
+		return stack.Delete(i)
+	})
+}
+
+// MoveLayer moves the layer at index from to index to
+func (pelCanvas *PelCanvas) MoveLayer(from, to int) error {
+	return pelCanvas.changeLayers("Move Layer", func(stack *layer.Stack) error {
+		return stack.Move(from, to)
+	})
+}
+
+// DuplicateLayer inserts a copy of the layer at index i above it
+func (pelCanvas *PelCanvas) DuplicateLayer(i int) error {
+	return pelCanvas.changeLayers("Duplicate Layer", func(stack *layer.Stack) error {
+		_, err := stack.Duplicate(i)
+		return err
+	})
+}
+
+// MergeLayerDown merges the layer at index i into the layer below it
+func (pelCanvas *PelCanvas) MergeLayerDown(i int) error {
+	return pelCanvas.changeLayers("Merge Down", func(stack *layer.Stack) error {
+		_, err := stack.MergeDown(i)
+		return err
+	})
+}
+
+// SetLayerVisible shows or hides the layer at index i
+func (pelCanvas *PelCanvas) SetLayerVisible(i int, visible bool) error {
+	name := "Hide Layer"
+	if visible {
+		name = "Show Layer"
+	}
+	return pelCanvas.changeLayers(name, func(stack *layer.Stack) error {
+		return stack.SetVisible(i, visible)
+	})
+}
+
+// SetLayerOpacity sets the opacity of the layer at index i
+func (pelCanvas *PelCanvas) SetLayerOpacity(i int, opacity uint8) error {
+	return pelCanvas.changeLayers("Layer Opacity", func(stack *layer.Stack) error {
+		return stack.SetOpacity(i, opacity)
+	})
+}
+
+// SetLayerBlendMode sets the blend mode of the layer at index i
+func (pelCanvas *PelCanvas) SetLayerBlendMode(i int, mode layer.BlendMode) error {
+	return pelCanvas.changeLayers("Blend Mode", func(stack *layer.Stack) error {
+		return stack.SetBlendMode(i, mode)
+	})
+}
+
+// SetLayerLocked locks or unlocks the layer at index i
+func (pelCanvas *PelCanvas) SetLayerLocked(i int, locked bool) error {
+	name := "Unlock Layer"
+	if locked {
+		name = "Lock Layer"
+	}
+	return pelCanvas.changeLayers(name, func(stack *layer.Stack) error {
+		return stack.SetLocked(i, locked)
+	})
+}
+
+// RenameLayer changes the name of the layer at index i
+func (pelCanvas *PelCanvas) RenameLayer(i int, name string) error {
+	return pelCanvas.changeLayers("Rename Layer", func(stack *layer.Stack) error {
+		return stack.Rename(i, name)
+	})
+}
+
+// AddLayerListener registers a function called whenever the layer stack changes
+func (pelCanvas *PelCanvas) AddLayerListener(listener func()) {
+	if listener != nil {
+		pelCanvas.layerListeners = append(pelCanvas.layerListeners, listener)
+	}
+}
+
+// changeLayers applies a structural change to the layer stack and records it
+// in the history under the given name
+func (pelCanvas *PelCanvas) changeLayers(name string, change func(stack *layer.Stack) error) error {
+	pelCanvas.finishGesture()
+
+	stack := pelCanvas.layers
+	before := stack.Snapshot()
+	if err := change(stack); err != nil {
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	after := stack.Snapshot()
+
+	pelCanvas.restoreLayers(stack, after)
+	pelCanvas.record(&layerCommand{name: name, stack: stack, before: before, after: after})
+
+	log.Printf("%s: %d layers, active layer %d", name, pelCanvas.layers.Len(), pelCanvas.layers.ActiveIndex())
+	return nil
+}
+
+// restoreLayers applies a snapshot to a frame's layer stack, shows that
+// frame and recomposites the canvas
+func (pelCanvas *PelCanvas) restoreLayers(stack *layer.Stack, snapshot layer.Snapshot) {
+	if i := pelCanvas.timeline.IndexOf(stack); i >= 0 {
+		pelCanvas.showFrame(i)
+	}
+	stack.Restore(snapshot)
+	pelCanvas.syncPalette()
+	pelCanvas.invalidate(pelCanvas.layers.Bounds())
+	pelCanvas.layersChanged()
+	pelCanvas.Refresh()
+}
+
+// layersChanged notifies every layer listener
+func (pelCanvas *PelCanvas) layersChanged() {
+	for _, listener := range pelCanvas.layerListeners {
+		listener()
+	}
+}
+
+// layerCommand records a structural change to a frame's layer stack such as
+// adding, reordering or merging layers, or changing layer properties
+type layerCommand struct {
+	name   string
+	stack  *layer.Stack // Layer stack of the frame that was changed
+	before layer.Snapshot
+	after  layer.Snapshot
+}
+
+// Name returns the name of the operation
+func (cmd *layerCommand) Name() string {
+	return cmd.name
+}
+
+// Undo restores the layer stack as it was before the change
+func (cmd *layerCommand) Undo(pelCanvas *PelCanvas) error {
+	pelCanvas.restoreLayers(cmd.stack, cmd.before)
+	return nil
+}
+
+// Redo restores the layer stack as it was after the change
+func (cmd *layerCommand) Redo(pelCanvas *PelCanvas) error {
+	pelCanvas.restoreLayers(cmd.stack, cmd.after)
+	return nil
+}
+
+// Size returns the approximate memory used by the command in bytes.
+// Layers present in only one of the snapshots are kept alive by the command.
+func (cmd *layerCommand) Size() int {
+	total := (len(cmd.before.Layers()) + len(cmd.after.Layers())) * layerSnapshotBytes
+	for _, l := range cmd.before.Layers() {
+		if !cmd.after.Contains(l) {
+			total += l.Bytes()
+		}
+	}
+	for _, l := range cmd.after.Layers() {
+		if !cmd.before.Contains(l) {
+			total += l.Bytes()
+		}
+	}
+	return total
+}
@@ -2,6 +2,7 @@
 package pelcanvas
 
 import (
+	"image"
 	"github.com/carlomunguia/pel/pelcanvas/brush"
 
 	"fyne.io/fyne/v2"
@@ -52,6 +53,29 @@ func (pelCanvas *PelCanvas) MouseDown(ev *desktop.MouseEvent) {
 		return
 	}
 
+	pelCanvas.mouseState.modifiers = ev.Modifier
+	pelCanvas.mouseState.previousCoord = &ev.PointEvent
+
+	// Selection tools select and move pixels instead of painting
+	if pelCanvas.appState.BrushType.IsSelection() {
+		if ev.Button == desktop.MouseButtonPrimary {
+			x, y := pelCanvas.positionToCanvasXY(ev.Position)
+			pelCanvas.beginSelectionDrag(x, y, ev.Modifier)
+		}
+		return
+	}
+
+	// Every primary button gesture is recorded as a single stroke
+	if ev.Button == desktop.MouseButtonPrimary {
+		pelCanvas.BeginStroke(pelCanvas.appState.BrushType)
+	}
+
+	// Shape tools anchor on mouse down and are committed on mouse up
+	if pelCanvas.appState.BrushType.IsShape() {
+		pelCanvas.beginShape(ev)
+		return
+	}
+
 	// Attempt to draw/interact with brush
 	if brush.TryBrush(pelCanvas.appState, pelCanvas, ev) {
 		pelCanvas.Refresh()
@@ -64,8 +88,40 @@ func (pelCanvas *PelCanvas) MouseIn(ev *desktop.MouseEvent) {
 }
 
 // MouseUp handles mouse button release events
+// Commits any shape being dragged and finishes the current stroke
 func (pelCanvas *PelCanvas) MouseUp(ev *desktop.MouseEvent) {
-	// TODO: Implement mouse up behavior (e.g., finish line/shape drawing)
+	if ev == nil {
+		return
+	}
+
+	pelCanvas.mouseState.modifiers = ev.Modifier
+
+	if ev.Button != desktop.MouseButtonPrimary {
+		return
+	}
+
+	if pelCanvas.mouseState.selectionDrag != nil {
+		pelCanvas.endSelectionDrag(pelCanvas.positionToCanvasXY(ev.Position))
+		return
+	}
+
+	if drag := pelCanvas.mouseState.shapeDrag; drag != nil {
+		pelCanvas.mouseState.shapeDrag = nil
+
+		// The release event carries the authoritative modifier state
+		x, y := pelCanvas.positionToCanvasXY(ev.Position)
+		drag.End = image.Point{X: x, Y: y}
+		drag.Modifiers = ev.Modifier
+
+		brush.CommitShape(pelCanvas.appState, pelCanvas, *drag)
+
+		if pelCanvas.renderer != nil {
+			pelCanvas.renderer.SetCursor(make([]fyne.CanvasObject, 0))
+		}
+	}
+
+	pelCanvas.EndStroke()
+	pelCanvas.Refresh()
 }
 
 // MouseOut handles mouse leaving the canvas area
@@ -77,24 +133,99 @@ func (pelCanvas *PelCanvas) MouseOut() {
 	}
 }
 
+// beginShape anchors a shape tool drag at the pixel under the mouse
+func (pelCanvas *PelCanvas) beginShape(ev *desktop.MouseEvent) {
+	if ev.Button != desktop.MouseButtonPrimary {
+		return
+	}
+
+	x, y := pelCanvas.MouseToCanvasXY(ev)
+	if x == nil || y == nil {
+		return
+	}
+
+	anchor := image.Point{X: *x, Y: *y}
+	pelCanvas.mouseState.shapeDrag = &brush.ShapeDrag{
+		Start:     anchor,
+		End:       anchor,
+		Modifiers: ev.Modifier,
+	}
+
+	pelCanvas.updateShapePreview()
+	pelCanvas.Refresh()
+}
+
+// updateShapePreview redraws the ghost preview of the shape being dragged
+func (pelCanvas *PelCanvas) updateShapePreview() {
+	drag := pelCanvas.mouseState.shapeDrag
+	if drag == nil || pelCanvas.renderer == nil {
+		return
+	}
+
+	drag.Modifiers = pelCanvas.mouseState.modifiers
+	cursor := brush.Cursor(
+		pelCanvas.PelCanvasConfig,
+		pelCanvas.appState,
+		nil,
+		drag.End.X,
+		drag.End.Y,
+		drag,
+	)
+	pelCanvas.renderer.SetCursor(cursor)
+}
+
 // updateCursorAndDraw updates the cursor position and handles drawing operations
 // Returns true if a refresh is needed
 func (pelCanvas *PelCanvas) updateCursorAndDraw(ev *desktop.MouseEvent) bool {
+	// The button was released outside the canvas: abandon any shape and
+	// finish the stroke, since no MouseUp will be delivered
+	if pelCanvas.IsStroking() && ev.Button&desktop.MouseButtonPrimary == 0 {
+		pelCanvas.mouseState.shapeDrag = nil
+		pelCanvas.EndStroke()
+	}
+	if drag := pelCanvas.mouseState.selectionDrag; drag != nil {
+		x, y := pelCanvas.positionToCanvasXY(ev.Position)
+		if ev.Button&desktop.MouseButtonPrimary == 0 {
+			pelCanvas.endSelectionDrag(x, y)
+		} else {
+			pelCanvas.updateSelectionDrag(x, y)
+		}
+		return true
+	}
+
+	if drag := pelCanvas.mouseState.shapeDrag; drag != nil {
+		x, y := pelCanvas.positionToCanvasXY(ev.Position)
+		drag.End = image.Point{X: x, Y: y}
+		pelCanvas.updateShapePreview()
+		return true
+	}
+
+	// Continue freehand strokes from the previous mouse position
+	drawn := false
+	if pelCanvas.IsStroking() && pelCanvas.mouseState.previousCoord != nil {
+		fromX, fromY := pelCanvas.positionToCanvasXY(pelCanvas.mouseState.previousCoord.Position)
+		toX, toY := pelCanvas.positionToCanvasXY(ev.Position)
+		drawn = brush.TryStroke(
+			pelCanvas.appState,
+			pelCanvas,
+			image.Point{X: fromX, Y: fromY},
+			image.Point{X: toX, Y: toY},
+		)
+	}
+
 	x, y := pelCanvas.MouseToCanvasXY(ev)
 
 	if x != nil && y != nil {
 		// Mouse is over a valid canvas pixel
 
-		// Try to draw if mouse button is pressed (handled by TryBrush)
-		drawn := brush.TryBrush(pelCanvas.appState, pelCanvas, ev)
-
 		// Update cursor to show current brush tool
 		cursor := brush.Cursor(
 			pelCanvas.PelCanvasConfig,
-			pelCanvas.appState.BrushType,
+			pelCanvas.appState,
 			ev,
 			*x,
 			*y,
+			nil,
 		)
 
 		if pelCanvas.renderer != nil {
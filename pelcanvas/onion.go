@@ -0,0 +1,82 @@
+// Package pelcanvas provides onion skinning for the pixel canvas.
+package pelcanvas
+
+import (
+	"image"
+	"image/color"
+	"github.com/carlomunguia/pel/apptype"
+)
+
+// SetOnionSkin changes how neighbouring frames are shown over the current frame
+func (pelCanvas *PelCanvas) SetOnionSkin(opts apptype.OnionSkinOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	pelCanvas.appState.SetOnionSkin(opts)
+	pelCanvas.onionDirty = true
+	pelCanvas.Refresh()
+	return nil
+}
+
+// onionSkins returns tinted, translucent copies of the frames around the
+// current frame, ordered so the nearest frames come last and are drawn on top.
+// Returns nil when onion skinning is disabled or the animation is playing.
+func (pelCanvas *PelCanvas) onionSkins() []*image.NRGBA {
+	opts := pelCanvas.appState.OnionSkin
+	if !opts.Enabled || pelCanvas.playing || opts.Opacity == 0 {
+		return nil
+	}
+
+	current := pelCanvas.timeline.CurrentIndex()
+	shown := pelCanvas.layers.Flatten()
+	skins := make([]*image.NRGBA, 0, opts.Before+opts.After)
+
+	// Furthest frames first, alternating sides so both fade out evenly
+	for distance := max(opts.Before, opts.After); distance > 0; distance-- {
+		if distance <= opts.Before {
+			if f := pelCanvas.timeline.Frame(current - distance); f != nil {
+				opacity := onionOpacity(opts.Opacity, distance, opts.Before)
+				skins = append(skins, onionSkin(f.Layers.Flatten(), shown, opts.PrevTint, opacity))
+			}
+		}
+		if distance <= opts.After {
+			if f := pelCanvas.timeline.Frame(current + distance); f != nil {
+				opacity := onionOpacity(opts.Opacity, distance, opts.After)
+				skins = append(skins, onionSkin(f.Layers.Flatten(), shown, opts.NextTint, opacity))
+			}
+		}
+	}
+	return skins
+}
+
+// onionOpacity fades the onion skin opacity linearly with the distance from
+// the current frame, so the nearest frame has full opacity
+func onionOpacity(opacity uint8, distance, count int) uint8 {
+	return uint8(int(opacity) * (count - distance + 1) / count)
+}
+
+// onionSkin tints an image towards the tint color by the tint's alpha and
+// scales its alpha by opacity. Pixels that match the shown frame are left
+// transparent, so shared backgrounds do not wash over the canvas.
+func onionSkin(img, shown *image.NRGBA, tint color.NRGBA, opacity uint8) *image.NRGBA {
+	bounds := img.Bounds()
+	skin := image.NewNRGBA(bounds)
+	strength := int(tint.A)
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		if [4]uint8(img.Pix[i:i+4]) == [4]uint8(shown.Pix[i:i+4]) {
+			continue
+		}
+		skin.Pix[i+0] = mix(img.Pix[i+0], tint.R, strength)
+		skin.Pix[i+1] = mix(img.Pix[i+1], tint.G, strength)
+		skin.Pix[i+2] = mix(img.Pix[i+2], tint.B, strength)
+		skin.Pix[i+3] = uint8(int(img.Pix[i+3]) * int(opacity) / 255)
+	}
+	return skin
+}
+
+// mix blends channel a towards b by amount/255
+func mix(a, b uint8, amount int) uint8 {
+	return uint8((int(a)*(255-amount) + int(b)*amount) / 255)
+}
@@ -2,6 +2,8 @@
 package pelcanvas
 
 import (
+	"github.com/carlomunguia/pel/apptype"
+
 	"fyne.io/fyne/v2"
 )
 
@@ -64,6 +66,19 @@ func (pelCanvas *PelCanvas) ResetView() {
 	pelCanvas.Refresh()
 }
 
+// RestoreView applies the zoom, pan offset and drawing area of a saved
+// configuration. The grid dimensions always follow the loaded layers.
+func (pelCanvas *PelCanvas) RestoreView(config apptype.PelCanvasConfig) {
+	if config.PxSize >= MinPixelSize && config.PxSize <= MaxPixelSize {
+		pelCanvas.PxSize = config.PxSize
+	}
+	if config.DrawingArea.Width > 0 && config.DrawingArea.Height > 0 {
+		pelCanvas.DrawingArea = config.DrawingArea
+	}
+	pelCanvas.CanvasOffset = config.CanvasOffset
+	pelCanvas.Refresh()
+}
+
 // ZoomIn increases the pixel size by one step
 func (pelCanvas *PelCanvas) ZoomIn() {
 	pelCanvas.scale(1)
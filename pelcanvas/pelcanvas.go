@@ -6,7 +6,12 @@ import (
 	"image"
 	"image/color"
 	"log"
+	"math"
 	"github.com/carlomunguia/pel/apptype"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+	"github.com/carlomunguia/pel/pelcanvas/brush"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+	"github.com/carlomunguia/pel/selection"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -29,6 +34,9 @@ var (
 // PelCanvasMouseState tracks the mouse state for pan/drag operations
 type PelCanvasMouseState struct {
 	previousCoord *fyne.PointEvent
+	shapeDrag     *brush.ShapeDrag // In-progress shape tool drag (nil when not dragging)
+	selectionDrag *selectionDrag   // In-progress selection tool drag (nil when not dragging)
+	modifiers     fyne.KeyModifier // Keyboard modifiers currently held down
 }
 
 // PelCanvas is the main canvas widget for drawing pixel art
@@ -36,10 +44,28 @@ type PelCanvas struct {
 	widget.BaseWidget
 	apptype.PelCanvasConfig
 	renderer    *PelCanvasRenderer
-	PixelData   image.Image
+	PixelData   image.Image // Composite of the visible layers, as shown on screen
 	mouseState  PelCanvasMouseState
 	appState    *apptype.State
 	reloadImage bool
+	stroke      *Stroke             // Stroke currently being recorded (nil between gestures)
+	history     *History            // Undo/redo history of canvas mutations
+	timeline    *animation.Timeline // Animation frames of the drawing
+	layers      *layer.Stack        // Layers of the current frame, composited into PixelData
+	dirty       image.Rectangle     // Area of PixelData that must be recomposited
+	playing     bool                // True while the animation is previewed
+	onionDirty  bool                // True when the onion skins must be rebuilt
+	palette     color.Palette       // Document palette in indexed color mode, nil in RGB mode
+
+	selection      *selection.Mask    // Pixels edits are clipped to, nil when nothing is selected
+	selectionDirty bool               // True when the selection outline must be redrawn
+	floating       *floatingSelection // Selected pixels lifted off their layer while being moved
+	clipboard      *clipping          // Pixels last copied or cut
+
+	historyListeners []func() // Called whenever the history changes
+	layerListeners   []func() // Called whenever the layer stack changes
+	frameListeners   []func() // Called whenever the timeline or current frame changes
+	paletteListeners []func() // Called whenever the color mode or palette changes
 }
 
 // Bounds returns the current bounds of the canvas in screen coordinates
@@ -89,14 +115,22 @@ func NewPelCanvas(state *apptype.State, config apptype.PelCanvasConfig) *PelCanv
 	pelCanvas := &PelCanvas{
 		PelCanvasConfig: config,
 		appState:        state,
+		history:         NewHistory(DefaultHistoryLimit),
 	}
 
-	// Create initial blank image
-	img, err := NewBlankImage(pelCanvas.PxCols, pelCanvas.PxRows, DefaultCanvasGray)
+	// Create initial frame with a blank background layer
+	stack, err := layer.NewStack(pelCanvas.PxCols, pelCanvas.PxRows, DefaultCanvasGray)
 	if err != nil {
 		log.Fatalf("Failed to create blank image: %v", err)
 	}
-	pelCanvas.PixelData = img
+	timeline, err := animation.NewTimeline(animation.NewFrame(stack))
+	if err != nil {
+		log.Fatalf("Failed to create timeline: %v", err)
+	}
+	pelCanvas.timeline = timeline
+	pelCanvas.layers = stack
+	pelCanvas.PixelData = stack.Flatten()
+	pelCanvas.history.root.thumbnail = Thumbnail(pelCanvas.PixelData, HistoryThumbnailSize)
 
 	pelCanvas.ExtendBaseWidget(pelCanvas)
 	log.Printf("Created PelCanvas: %dx%d grid", pelCanvas.PxCols, pelCanvas.PxRows)
@@ -138,8 +172,9 @@ func (pelCanvas *PelCanvas) TryPan(previousCoord *fyne.PointEvent, ev *desktop.M
 	}
 }
 
-// SetColor sets the color of a pixel at the specified coordinates
-// Returns an error if the coordinates are out of bounds or if the operation fails
+// SetColor sets the color of a pixel on the active layer at the specified coordinates
+// Pixels outside the selection are left unchanged while a selection exists
+// Returns an error if the coordinates are out of bounds or if the layer is locked or hidden
 func (pelCanvas *PelCanvas) SetColor(c color.Color, x, y int) error {
 	if c == nil {
 		return fmt.Errorf("color cannot be nil")
@@ -150,24 +185,108 @@ func (pelCanvas *PelCanvas) SetColor(c color.Color, x, y int) error {
 		return fmt.Errorf("coordinates out of bounds: (%d, %d)", x, y)
 	}
 
-	// Try to set color on the image
-	success := false
-	if nrgba, ok := pelCanvas.PixelData.(*image.NRGBA); ok {
-		nrgba.Set(x, y, c)
-		success = true
-	} else if rgba, ok := pelCanvas.PixelData.(*image.RGBA); ok {
-		rgba.Set(x, y, c)
-		success = true
+	target := pelCanvas.layers.Active()
+	if err := target.CanPaint(); err != nil {
+		return err
 	}
 
-	if !success {
-		return fmt.Errorf("unsupported image type: %T", pelCanvas.PixelData)
+	// Edits are clipped to the selection
+	if !pelCanvas.selected(x, y) {
+		return nil
 	}
 
-	pelCanvas.Refresh()
+	// Record the change in the active stroke
+	pelCanvas.paintPixel(target, c, x, y, pelCanvas.stroke)
+
+	// Note: Refresh is handled by the caller so that multi-pixel operations
+	// such as fills only refresh the widget once
 	return nil
 }
 
+// paintPixel sets a pixel on a layer, storing the nearest palette index on
+// indexed layers, and records the change in the given stroke if it belongs
+// to that layer
+func (pelCanvas *PelCanvas) paintPixel(target *layer.Layer, c color.Color, x, y int, stroke *Stroke) {
+	change := PixelChange{X: x, Y: y, Before: target.At(x, y), BeforeIndex: target.IndexAt(x, y)}
+	if target.IsIndexed() {
+		pelCanvas.writeIndex(target, pelCanvas.paletteIndex(c), x, y)
+	} else {
+		pelCanvas.writePixel(target, c, x, y)
+	}
+
+	if stroke != nil && stroke.Layer == target {
+		change.After, change.AfterIndex = target.At(x, y), target.IndexAt(x, y)
+		if change.After != change.Before || change.AfterIndex != change.BeforeIndex {
+			stroke.Record(change)
+		}
+	}
+}
+
+// writePixel sets a pixel on a layer without recording it in a stroke or
+// checking the layer lock, and marks the pixel for recompositing
+func (pelCanvas *PelCanvas) writePixel(target *layer.Layer, c color.Color, x, y int) {
+	target.Set(x, y, c)
+	pelCanvas.invalidate(image.Rect(x, y, x+1, y+1))
+}
+
+// invalidate marks an area of the composite image as out of date
+func (pelCanvas *PelCanvas) invalidate(r image.Rectangle) {
+	pelCanvas.dirty = pelCanvas.dirty.Union(r)
+}
+
+// updateComposite recomposites the out of date area of PixelData from the layers
+func (pelCanvas *PelCanvas) updateComposite() {
+	if pelCanvas.dirty.Empty() {
+		return
+	}
+
+	if composite, ok := pelCanvas.PixelData.(*image.NRGBA); ok {
+		pelCanvas.layers.Composite(composite, pelCanvas.dirty)
+	}
+	pelCanvas.dirty = image.Rectangle{}
+}
+
+// Flatten returns the visible layers composited into a single image.
+// The returned image is the one shown on screen and must not be modified.
+func (pelCanvas *PelCanvas) Flatten() image.Image {
+	pelCanvas.updateComposite()
+	return pelCanvas.PixelData
+}
+
+// BeginStroke starts recording pixel changes for a new gesture on the active layer.
+// Any stroke still in progress is finished and floating pixels are dropped first.
+func (pelCanvas *PelCanvas) BeginStroke(tool apptype.BrushType) {
+	if pelCanvas.stroke != nil {
+		pelCanvas.EndStroke()
+	}
+	pelCanvas.dropFloating()
+
+	target := pelCanvas.layers.Active()
+	if err := target.CanPaint(); err != nil {
+		log.Printf("Cannot paint: %v", err)
+	}
+	pelCanvas.stroke = NewStroke(tool, target)
+}
+
+// EndStroke stops recording and returns the finished stroke.
+// Strokes that changed pixels are added to the undo history.
+// Returns nil if no stroke was in progress.
+func (pelCanvas *PelCanvas) EndStroke() *Stroke {
+	stroke := pelCanvas.stroke
+	pelCanvas.stroke = nil
+
+	if stroke != nil && !stroke.IsEmpty() {
+		log.Printf("Finished %s stroke: %d pixels changed", stroke.Tool.String(), stroke.Len())
+		pelCanvas.record(stroke)
+	}
+	return stroke
+}
+
+// IsStroking returns true while a gesture is being recorded
+func (pelCanvas *PelCanvas) IsStroking() bool {
+	return pelCanvas.stroke != nil
+}
+
 // MouseToCanvasXY converts mouse event coordinates to canvas pixel coordinates
 // Returns nil pointers if the coordinates are outside the canvas
 func (pelCanvas *PelCanvas) MouseToCanvasXY(ev *desktop.MouseEvent) (*int, *int) {
@@ -189,30 +308,119 @@ func (pelCanvas *PelCanvas) MouseToCanvasXY(ev *desktop.MouseEvent) (*int, *int)
 	return &x, &y
 }
 
-// LoadImage loads an image into the canvas
+// positionToCanvasXY converts a widget position to canvas pixel coordinates.
+// Unlike MouseToCanvasXY the result is not bounds checked, so shape drags can
+// extend past the edge of the canvas.
+func (pelCanvas *PelCanvas) positionToCanvasXY(pos fyne.Position) (int, int) {
+	pxSize := float64(pelCanvas.PxSize)
+	x := math.Floor(float64(pos.X-pelCanvas.CanvasOffset.X) / pxSize)
+	y := math.Floor(float64(pos.Y-pelCanvas.CanvasOffset.Y) / pxSize)
+	return int(x), int(y)
+}
+
+// LoadImage loads an image into the canvas as a single background layer
 // The canvas dimensions will be adjusted to match the image
+// Paletted images are loaded in indexed color mode with the image's palette,
+// any other image in RGB mode
 func (pelCanvas *PelCanvas) LoadImage(img image.Image) error {
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		return pelCanvas.loadImage(img, nil, "Load Image")
+	}
+	if paletted.Rect.Empty() {
+		return fmt.Errorf("invalid image dimensions: %dx%d", paletted.Rect.Dx(), paletted.Rect.Dy())
+	}
+
+	background, p := palettedLayer(paletted)
+	stack, err := layer.NewStackFromLayers([]*layer.Layer{background}, 0)
+	if err != nil {
+		return err
+	}
+	timeline, err := animation.NewTimeline(animation.NewFrame(stack))
+	if err != nil {
+		return err
+	}
+	return pelCanvas.loadTimeline(timeline, p, "Load Image")
+}
+
+// loadImage replaces the drawing with a single frame and layer holding img and
+// records the replacement in the history under the given name so it can be undone
+// A non-nil palette loads the image in indexed color mode
+func (pelCanvas *PelCanvas) loadImage(img image.Image, p color.Palette, name string) error {
 	if img == nil {
 		return fmt.Errorf("cannot load nil image")
 	}
 
-	dimensions := img.Bounds()
-	cols := dimensions.Dx()
-	rows := dimensions.Dy()
+	stack, err := layer.NewStackFromImage(img)
+	if err != nil {
+		return err
+	}
 
-	if cols <= 0 || rows <= 0 {
-		return fmt.Errorf("invalid image dimensions: %dx%d", cols, rows)
+	timeline, err := animation.NewTimeline(animation.NewFrame(stack))
+	if err != nil {
+		return err
 	}
 
+	return pelCanvas.loadTimeline(timeline, p, name)
+}
+
+// LoadTimeline replaces the whole drawing, e.g. when opening a project file
+// The canvas dimensions will be adjusted to match the frames
+// A non-nil palette loads the frames in indexed color mode
+func (pelCanvas *PelCanvas) LoadTimeline(timeline *animation.Timeline, p color.Palette) error {
+	return pelCanvas.loadTimeline(timeline, p, "Open Project")
+}
+
+// LoadAnimation replaces the whole drawing with imported frames, e.g. from an animated GIF
+// The canvas dimensions will be adjusted to match the frames
+func (pelCanvas *PelCanvas) LoadAnimation(timeline *animation.Timeline) error {
+	return pelCanvas.loadTimeline(timeline, nil, "Load Animation")
+}
+
+// loadTimeline replaces the whole drawing and color mode and records the
+// replacement in the history under the given name so it can be undone
+func (pelCanvas *PelCanvas) loadTimeline(timeline *animation.Timeline, p color.Palette, name string) error {
+	if timeline == nil {
+		return fmt.Errorf("cannot load nil timeline")
+	}
+
+	// Finish any gesture in progress so it is recorded before the replacement
+	pelCanvas.finishGesture()
+
+	before, beforePalette := pelCanvas.timeline, pelCanvas.palette
+	pelCanvas.replaceTimeline(timeline, p)
+	pelCanvas.record(&documentCommand{
+		name:          name,
+		before:        before,
+		after:         timeline,
+		beforePalette: beforePalette,
+		afterPalette:  p,
+	})
+
+	log.Printf("Loaded image: %dx%d pixels, %d frames", pelCanvas.PxCols, pelCanvas.PxRows, timeline.Len())
+	return nil
+}
+
+// replaceTimeline swaps the whole drawing and its palette (nil for RGB mode),
+// adjusting the canvas dimensions to match
+func (pelCanvas *PelCanvas) replaceTimeline(timeline *animation.Timeline, p color.Palette) {
+	cols, rows := timeline.Size()
+
 	pelCanvas.PelCanvasConfig.PxCols = cols
 	pelCanvas.PelCanvasConfig.PxRows = rows
-	pelCanvas.PixelData = img
+	pelCanvas.timeline = timeline
+	pelCanvas.palette = p
+	pelCanvas.syncPalette()
+	pelCanvas.setSelection(pelCanvas.selection)
+	pelCanvas.layers = timeline.Current().Layers
+	pelCanvas.PixelData = pelCanvas.layers.Flatten()
+	pelCanvas.dirty = image.Rectangle{}
 	pelCanvas.reloadImage = true
 
-	log.Printf("Loaded image: %dx%d pixels", cols, rows)
+	pelCanvas.layersChanged()
+	pelCanvas.framesChanged()
+	pelCanvas.paletteChanged()
 	pelCanvas.Refresh()
-
-	return nil
 }
 
 // NewDrawing creates a new blank drawing with the specified dimensions
@@ -224,18 +432,14 @@ func (pelCanvas *PelCanvas) NewDrawing(cols, rows int) error {
 	// Clear file path to indicate unsaved new drawing
 	pelCanvas.appState.SetFilePath("")
 
-	// Update dimensions
-	pelCanvas.PxCols = cols
-	pelCanvas.PxRows = rows
-
 	// Create blank image
 	pixelData, err := NewBlankImage(cols, rows, DefaultCanvasGray)
 	if err != nil {
 		return fmt.Errorf("failed to create blank image: %w", err)
 	}
 
-	// Load the new image
-	if err := pelCanvas.LoadImage(pixelData); err != nil {
+	// Load the new image in the current color mode (this also updates the dimensions)
+	if err := pelCanvas.loadImage(pixelData, pelCanvas.palette, "New Drawing"); err != nil {
 		return fmt.Errorf("failed to load image: %w", err)
 	}
 
@@ -243,13 +447,18 @@ func (pelCanvas *PelCanvas) NewDrawing(cols, rows int) error {
 	return nil
 }
 
-// GetPixelColor returns the color at the specified pixel coordinates
+// GetPixelColor returns the color of the active layer at the specified pixel coordinates
 func (pelCanvas *PelCanvas) GetPixelColor(x, y int) (color.Color, error) {
 	if x < 0 || x >= pelCanvas.PxCols || y < 0 || y >= pelCanvas.PxRows {
 		return nil, fmt.Errorf("coordinates out of bounds: (%d, %d)", x, y)
 	}
 
-	return pelCanvas.PixelData.At(x, y), nil
+	return pelCanvas.layers.Active().At(x, y), nil
+}
+
+// GetCanvasSize returns the canvas dimensions in pixels
+func (pelCanvas *PelCanvas) GetCanvasSize() (cols, rows int) {
+	return pelCanvas.PxCols, pelCanvas.PxRows
 }
 
 // Clear fills the entire canvas with the specified color
@@ -263,5 +472,5 @@ func (pelCanvas *PelCanvas) Clear(c color.Color) error {
 		return fmt.Errorf("failed to clear canvas: %w", err)
 	}
 
-	return pelCanvas.LoadImage(img)
+	return pelCanvas.loadImage(img, pelCanvas.palette, "Clear")
 }
@@ -2,6 +2,11 @@
 package pelcanvas
 
 import (
+	"image/color"
+	"time"
+	"github.com/carlomunguia/pel/apptype"
+	"github.com/carlomunguia/pel/selection"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 )
@@ -15,12 +20,37 @@ const (
 	BorderCount  = 4
 )
 
+// Marching ants configuration
+const (
+	AntsDashLength  = 4                      // Shortest dash of the selection outline in screen pixels
+	AntsStrokeWidth = 1                      // Width of the selection outline
+	AntsInterval    = 300 * time.Millisecond // Time between steps of the marching ants
+	MaxAntsDashes   = 4096                   // Dashes are lengthened to stay below this count
+)
+
+// AntsColors are the alternating dash colors of the selection outline
+var AntsColors = [2]color.NRGBA{
+	{R: 0, G: 0, B: 0, A: 255},
+	{R: 255, G: 255, B: 255, A: 255},
+}
+
+// antsView is the zoom and pan a selection outline was laid out for
+type antsView struct {
+	pxSize int
+	offset fyne.Position
+}
+
 // PelCanvasRenderer handles the rendering of the pixel canvas widget
 type PelCanvasRenderer struct {
-	pelCanvas    *PelCanvas          // Reference to the canvas widget
-	canvasImage  *canvas.Image       // The pixel art image being displayed
-	canvasBorder []canvas.Line       // Border lines around the canvas
-	canvasCursor []fyne.CanvasObject // Current cursor objects
+	pelCanvas     *PelCanvas          // Reference to the canvas widget
+	canvasImage   *canvas.Image       // The pixel art image being displayed
+	canvasBorder  []canvas.Line       // Border lines around the canvas
+	canvasCursor  []fyne.CanvasObject // Current cursor objects
+	onionSkins    []*canvas.Image     // Neighbouring frames shown over the image
+	floatingImage *canvas.Image       // Floating selection pixels shown over the image
+	selectionAnts []*canvas.Line      // Marching ants around the selection
+	antsView      antsView            // View the marching ants were laid out for
+	ants          *fyne.Animation     // Steps the marching ants while a selection exists
 }
 
 // MinSize returns the minimum size required to display the canvas
@@ -33,8 +63,9 @@ func (renderer *PelCanvasRenderer) MinSize() fyne.Size {
 
 // Objects returns all canvas objects that need to be rendered
 func (renderer *PelCanvasRenderer) Objects() []fyne.CanvasObject {
-	// Pre-allocate with exact capacity: borders + image + cursor objects
-	capacity := len(renderer.canvasBorder) + 1 + len(renderer.canvasCursor)
+	// Pre-allocate with exact capacity: borders + image + onion skins + floating
+	// selection + marching ants + cursor objects
+	capacity := len(renderer.canvasBorder) + 2 + len(renderer.onionSkins) + len(renderer.selectionAnts) + len(renderer.canvasCursor)
 	objects := make([]fyne.CanvasObject, 0, capacity)
 
 	// Add border lines
@@ -47,6 +78,19 @@ func (renderer *PelCanvasRenderer) Objects() []fyne.CanvasObject {
 		objects = append(objects, renderer.canvasImage)
 	}
 
+	// Add onion skins over the canvas image
+	for _, skin := range renderer.onionSkins {
+		objects = append(objects, skin)
+	}
+
+	// Add the floating selection and its outline
+	if renderer.floatingImage != nil {
+		objects = append(objects, renderer.floatingImage)
+	}
+	for _, line := range renderer.selectionAnts {
+		objects = append(objects, line)
+	}
+
 	// Add cursor objects
 	objects = append(objects, renderer.canvasCursor...)
 
@@ -56,9 +100,16 @@ func (renderer *PelCanvasRenderer) Objects() []fyne.CanvasObject {
 // Destroy cleans up any resources used by the renderer
 func (renderer *PelCanvasRenderer) Destroy() {
 	// Clean up resources
+	if renderer.ants != nil {
+		renderer.ants.Stop()
+		renderer.ants = nil
+	}
+	renderer.floatingImage = nil
+	renderer.selectionAnts = nil
 	renderer.canvasImage = nil
 	renderer.canvasBorder = nil
 	renderer.canvasCursor = nil
+	renderer.onionSkins = nil
 	renderer.pelCanvas = nil
 }
 
@@ -93,6 +144,22 @@ func (renderer *PelCanvasRenderer) layoutCanvas(size fyne.Size) {
 		float32(imgPxWidth*pxSize),
 		float32(imgPxHeight*pxSize),
 	))
+
+	// Onion skins cover the canvas image exactly
+	for _, skin := range renderer.onionSkins {
+		skin.Move(renderer.canvasImage.Position())
+		skin.Resize(renderer.canvasImage.Size())
+	}
+
+	// The floating selection covers the pixels it will be dropped onto
+	if floating := renderer.pelCanvas.floating; floating != nil && renderer.floatingImage != nil {
+		bounds := floating.pixels.Rect
+		renderer.floatingImage.Move(fyne.NewPos(
+			renderer.pelCanvas.CanvasOffset.X+float32(bounds.Min.X*pxSize),
+			renderer.pelCanvas.CanvasOffset.Y+float32(bounds.Min.Y*pxSize),
+		))
+		renderer.floatingImage.Resize(fyne.NewSize(float32(bounds.Dx()*pxSize), float32(bounds.Dy()*pxSize)))
+	}
 }
 
 // layoutBorder positions the border lines around the canvas
@@ -136,6 +203,9 @@ func (renderer *PelCanvasRenderer) Refresh() {
 		return
 	}
 
+	// Composite the visible layers into the displayed image
+	renderer.pelCanvas.updateComposite()
+
 	// Reload image if needed (e.g., after loading a new file)
 	if renderer.pelCanvas.reloadImage {
 		// Clean up old image
@@ -153,12 +223,135 @@ func (renderer *PelCanvasRenderer) Refresh() {
 		_ = oldImage
 	}
 
+	// Rebuild onion skins after the frames or onion skin options change
+	if renderer.pelCanvas.onionDirty {
+		renderer.refreshOnionSkins()
+		renderer.pelCanvas.onionDirty = false
+	}
+
+	// Follow the selection and any floating pixels
+	renderer.refreshSelection()
+
 	// Update layout and refresh image
 	renderer.Layout(renderer.pelCanvas.Size())
 
 	if renderer.canvasImage != nil {
 		canvas.Refresh(renderer.canvasImage)
 	}
+	for _, skin := range renderer.onionSkins {
+		canvas.Refresh(skin)
+	}
+	if renderer.floatingImage != nil {
+		canvas.Refresh(renderer.floatingImage)
+	}
+}
+
+// refreshSelection rebuilds the floating selection image and the marching
+// ants after the selection, zoom or pan changes, and starts or stops the
+// ants animation
+func (renderer *PelCanvasRenderer) refreshSelection() {
+	pelCanvas := renderer.pelCanvas
+
+	if floating := pelCanvas.floating; floating == nil {
+		renderer.floatingImage = nil
+	} else if renderer.floatingImage == nil || renderer.floatingImage.Image != floating.pixels {
+		renderer.floatingImage = canvas.NewImageFromImage(floating.pixels)
+		renderer.floatingImage.ScaleMode = canvas.ImageScalePixels
+		renderer.floatingImage.FillMode = canvas.ImageFillStretch
+	}
+
+	view := antsView{pxSize: pelCanvas.PxSize, offset: pelCanvas.CanvasOffset}
+	if pelCanvas.selectionDirty || view != renderer.antsView {
+		renderer.selectionAnts = marchingAnts(pelCanvas.PelCanvasConfig, pelCanvas.selection.Outline())
+		renderer.antsView = view
+		pelCanvas.selectionDirty = false
+	}
+
+	switch {
+	case len(renderer.selectionAnts) > 0 && renderer.ants == nil && fyne.CurrentApp() != nil:
+		// Animations are run by the app, so the ants stand still without one
+		renderer.ants = fyne.NewAnimation(AntsInterval, func(progress float32) {
+			if progress == 1 {
+				renderer.stepAnts()
+			}
+		})
+		renderer.ants.Curve = fyne.AnimationLinear
+		renderer.ants.RepeatCount = fyne.AnimationRepeatForever
+		renderer.ants.Start()
+	case len(renderer.selectionAnts) == 0 && renderer.ants != nil:
+		renderer.ants.Stop()
+		renderer.ants = nil
+	}
+}
+
+// stepAnts swaps the colors of every dash so the selection outline appears to march
+func (renderer *PelCanvasRenderer) stepAnts() {
+	for _, line := range renderer.selectionAnts {
+		if line.StrokeColor == AntsColors[0] {
+			line.StrokeColor = AntsColors[1]
+		} else {
+			line.StrokeColor = AntsColors[0]
+		}
+		canvas.Refresh(line)
+	}
+}
+
+// marchingAnts lays out the outline of a selection as dashes of alternating
+// colors. Dashes are at least AntsDashLength screen pixels long, and longer
+// on large outlines so the number of dashes stays below MaxAntsDashes.
+func marchingAnts(config apptype.PelCanvasConfig, outline []selection.Segment) []*canvas.Line {
+	pxSize := config.PxSize
+	dash := max(1, (AntsDashLength+pxSize-1)/pxSize)
+
+	total := 0
+	for _, segment := range outline {
+		d := segment.To.Sub(segment.From)
+		total += d.X + d.Y
+	}
+	for total/dash > MaxAntsDashes {
+		dash *= 2
+	}
+
+	toScreen := func(x, y int) fyne.Position {
+		return fyne.NewPos(
+			config.CanvasOffset.X+float32(x*pxSize),
+			config.CanvasOffset.Y+float32(y*pxSize),
+		)
+	}
+
+	lines := make([]*canvas.Line, 0, total/dash+len(outline))
+	for _, segment := range outline {
+		d := segment.To.Sub(segment.From)
+		length := d.X + d.Y
+		step := d.Div(length)
+		for i := 0; i < length; i += dash {
+			from := segment.From.Add(step.Mul(i))
+			to := from.Add(step.Mul(min(dash, length-i)))
+
+			// Colors alternate along the canvas diagonal so dashes of
+			// neighbouring segments line up
+			line := canvas.NewLine(AntsColors[(((from.X+from.Y)/dash)%2+2)%2])
+			line.StrokeWidth = AntsStrokeWidth
+			line.Position1 = toScreen(from.X, from.Y)
+			line.Position2 = toScreen(to.X, to.Y)
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// refreshOnionSkins replaces the onion skin images with ones built from the
+// frames around the current frame
+func (renderer *PelCanvasRenderer) refreshOnionSkins() {
+	skins := renderer.pelCanvas.onionSkins()
+
+	renderer.onionSkins = make([]*canvas.Image, 0, len(skins))
+	for _, skin := range skins {
+		img := canvas.NewImageFromImage(skin)
+		img.ScaleMode = canvas.ImageScalePixels
+		img.FillMode = canvas.ImageFillStretch
+		renderer.onionSkins = append(renderer.onionSkins, img)
+	}
 }
 
 // SetCursor updates the cursor objects to be displayed
@@ -0,0 +1,545 @@
+// Package pelcanvas provides the selection and clipboard of the pixel canvas.
+package pelcanvas
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"github.com/carlomunguia/pel/apptype"
+	"github.com/carlomunguia/pel/pelcanvas/brush"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+	"github.com/carlomunguia/pel/selection"
+
+	"fyne.io/fyne/v2"
+)
+
+// Selection edit names shown in the history
+const (
+	MoveSelectionName   = "Move Selection"
+	DeleteSelectionName = "Delete"
+	CutSelectionName    = "Cut"
+	PasteName           = "Paste"
+)
+
+// floatingSelection holds pixels lifted off a layer while they are moved.
+// The layer shows a hole where they were until they are dropped again.
+type floatingSelection struct {
+	name   string          // History name used when the pixels are dropped
+	layer  *layer.Layer    // Layer the pixels came from and are dropped onto
+	pixels *image.NRGBA    // Lifted pixels at their current canvas position
+	stroke *Stroke         // Pixels cleared when lifting, and later dropped
+	before *selection.Mask // Selection before the pixels were lifted
+}
+
+// clipping holds pixels copied to the clipboard at their canvas position
+type clipping struct {
+	pixels *image.NRGBA
+	mask   *selection.Mask
+}
+
+// selectionDrag tracks a selection tool drag
+type selectionDrag struct {
+	tool    apptype.BrushType // Selection tool being dragged
+	op      selection.Op      // How the dragged shape is combined with base
+	base    *selection.Mask   // Selection when the drag started
+	start   image.Point       // Pixel where the drag started
+	last    image.Point       // Pixel under the mouse at the previous event
+	path    []image.Point     // Pixels visited by a lasso, or the last pixel of a move
+	moving  bool              // True when moving the selected pixels rather than selecting
+	dragged bool              // True once the mouse left the starting pixel
+}
+
+// Selection returns the selected pixels, or nil if nothing is selected.
+// The mask must not be modified.
+func (pelCanvas *PelCanvas) Selection() *selection.Mask {
+	return pelCanvas.selection
+}
+
+// HasSelection returns true if any pixel is selected
+func (pelCanvas *PelCanvas) HasSelection() bool {
+	return pelCanvas.selection != nil
+}
+
+// IsFloating returns true while selected pixels are lifted off their layer
+func (pelCanvas *PelCanvas) IsFloating() bool {
+	return pelCanvas.floating != nil
+}
+
+// SetSelection replaces the selection, dropping any floating pixels first.
+// The mask is clipped to the canvas; a nil or empty mask deselects.
+func (pelCanvas *PelCanvas) SetSelection(mask *selection.Mask) {
+	pelCanvas.finishGesture()
+	pelCanvas.setSelection(mask)
+	pelCanvas.Refresh()
+}
+
+// SelectAll selects every pixel of the canvas
+func (pelCanvas *PelCanvas) SelectAll() {
+	pelCanvas.SetSelection(selection.Rect(pelCanvas.canvasRect()))
+}
+
+// Deselect drops any floating pixels and clears the selection
+func (pelCanvas *PelCanvas) Deselect() {
+	pelCanvas.SetSelection(nil)
+}
+
+// CommitSelection drops any floating pixels onto their layer, recording the
+// move or paste in the history. The selection itself is kept.
+func (pelCanvas *PelCanvas) CommitSelection() {
+	if pelCanvas.floating != nil {
+		pelCanvas.finishGesture()
+		pelCanvas.Refresh()
+	}
+}
+
+// Copy puts the selected pixels of the active layer on the clipboard, or the
+// whole layer if nothing is selected
+func (pelCanvas *PelCanvas) Copy() error {
+	clip := pelCanvas.selectedPixels()
+	if clip == nil {
+		return fmt.Errorf("nothing to copy")
+	}
+
+	pelCanvas.clipboard = clip
+	log.Printf("Copied %dx%d pixels", clip.pixels.Rect.Dx(), clip.pixels.Rect.Dy())
+	return nil
+}
+
+// Cut copies the selected pixels to the clipboard and then clears them
+func (pelCanvas *PelCanvas) Cut() error {
+	if pelCanvas.selection == nil {
+		return fmt.Errorf("nothing is selected")
+	}
+	if err := pelCanvas.Copy(); err != nil {
+		return err
+	}
+	return pelCanvas.clearSelection(CutSelectionName)
+}
+
+// DeleteSelection clears the selected pixels of the active layer to transparent
+func (pelCanvas *PelCanvas) DeleteSelection() error {
+	if pelCanvas.selection == nil {
+		return fmt.Errorf("nothing is selected")
+	}
+	return pelCanvas.clearSelection(DeleteSelectionName)
+}
+
+// Paste places the clipboard pixels on the active layer as a floating
+// selection at the position they were copied from, or at the top left
+// corner if they no longer fit there. They are dropped onto the layer when
+// the selection is committed.
+func (pelCanvas *PelCanvas) Paste() error {
+	if pelCanvas.clipboard == nil {
+		return fmt.Errorf("clipboard is empty")
+	}
+	return pelCanvas.pasteFloating(pelCanvas.clipboard)
+}
+
+// ClipboardImage returns the selected pixels of the active layer, or the
+// visible canvas if nothing is selected, moved to the origin for sharing
+// with other applications. Unselected pixels are transparent.
+func (pelCanvas *PelCanvas) ClipboardImage() *image.NRGBA {
+	if pelCanvas.selection == nil {
+		flat := pelCanvas.Flatten()
+		img := image.NewNRGBA(image.Rect(0, 0, flat.Bounds().Dx(), flat.Bounds().Dy()))
+		draw.Draw(img, img.Rect, flat, flat.Bounds().Min, draw.Src)
+		return img
+	}
+
+	clip := pelCanvas.selectedPixels()
+	if clip == nil {
+		return nil
+	}
+	img := cloneNRGBA(clip.pixels)
+	img.Rect = img.Rect.Sub(img.Rect.Min)
+	return img
+}
+
+// PasteImage places an image from another application on the active layer
+// as a floating selection at the top left corner. Pixels outside the canvas
+// are cut off when the selection is committed.
+func (pelCanvas *PelCanvas) PasteImage(img image.Image) error {
+	if img == nil || img.Bounds().Empty() {
+		return fmt.Errorf("no image to paste")
+	}
+
+	bounds := image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy())
+	pixels := image.NewNRGBA(bounds)
+	draw.Draw(pixels, bounds, img, img.Bounds().Min, draw.Src)
+	return pelCanvas.pasteFloating(&clipping{pixels: pixels, mask: selection.Rect(bounds)})
+}
+
+// pasteFloating places copied pixels on the active layer as a floating selection
+func (pelCanvas *PelCanvas) pasteFloating(clip *clipping) error {
+	target := pelCanvas.layers.Active()
+	if err := target.CanPaint(); err != nil {
+		return err
+	}
+
+	pelCanvas.finishGesture()
+
+	pixels := cloneNRGBA(clip.pixels)
+	mask := clip.mask.Clone()
+	if !pixels.Rect.In(pelCanvas.canvasRect()) {
+		offset := image.Point{}.Sub(pixels.Rect.Min)
+		pixels.Rect = pixels.Rect.Add(offset)
+		mask = mask.Translate(offset.X, offset.Y)
+	}
+
+	pelCanvas.floating = &floatingSelection{
+		name:   PasteName,
+		layer:  target,
+		pixels: pixels,
+		stroke: NewStroke(pelCanvas.appState.BrushType, target),
+		before: pelCanvas.selection,
+	}
+	pelCanvas.selection = mask
+	pelCanvas.selectionDirty = true
+	pelCanvas.Refresh()
+
+	log.Printf("Pasted %dx%d pixels", pixels.Rect.Dx(), pixels.Rect.Dy())
+	return nil
+}
+
+// MoveSelection moves the selected pixels of the active layer by (dx, dy),
+// lifting them into a floating selection first if needed
+func (pelCanvas *PelCanvas) MoveSelection(dx, dy int) error {
+	if pelCanvas.selection == nil {
+		return fmt.Errorf("nothing is selected")
+	}
+	if pelCanvas.floating == nil {
+		if err := pelCanvas.liftSelection(MoveSelectionName); err != nil {
+			return err
+		}
+	}
+
+	floating := pelCanvas.floating
+	floating.pixels.Rect = floating.pixels.Rect.Add(image.Point{X: dx, Y: dy})
+	pelCanvas.selection = pelCanvas.selection.Translate(dx, dy)
+	pelCanvas.selectionDirty = true
+	pelCanvas.Refresh()
+	return nil
+}
+
+// setSelection replaces the selection without touching any pixels
+func (pelCanvas *PelCanvas) setSelection(mask *selection.Mask) {
+	if mask != nil {
+		mask = mask.Clip(pelCanvas.canvasRect())
+	}
+	if mask.IsEmpty() {
+		mask = nil
+	}
+	pelCanvas.selection = mask
+	pelCanvas.selectionDirty = true
+}
+
+// canvasRect returns the area covered by the canvas in pixel coordinates
+func (pelCanvas *PelCanvas) canvasRect() image.Rectangle {
+	return image.Rect(0, 0, pelCanvas.PxCols, pelCanvas.PxRows)
+}
+
+// selected returns true if edits may change the pixel at (x, y): it is
+// selected, or nothing is selected
+func (pelCanvas *PelCanvas) selected(x, y int) bool {
+	return pelCanvas.selection == nil || pelCanvas.selection.Contains(x, y)
+}
+
+// selectedPixels returns a copy of the floating pixels, or of the selected
+// pixels of the active layer, or of the whole layer if nothing is selected.
+// Unselected pixels are transparent.
+func (pelCanvas *PelCanvas) selectedPixels() *clipping {
+	if floating := pelCanvas.floating; floating != nil {
+		return &clipping{pixels: cloneNRGBA(floating.pixels), mask: pelCanvas.selection.Clone()}
+	}
+
+	mask := pelCanvas.selection
+	if mask == nil {
+		mask = selection.Rect(pelCanvas.canvasRect())
+	}
+	bounds := mask.SelectedBounds()
+	if bounds.Empty() {
+		return nil
+	}
+
+	source := pelCanvas.layers.Active()
+	pixels := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if mask.Contains(x, y) {
+				pixels.SetNRGBA(x, y, source.At(x, y))
+			}
+		}
+	}
+	return &clipping{pixels: pixels, mask: mask.Clip(bounds)}
+}
+
+// liftSelection copies the selected pixels of the active layer into a
+// floating selection and clears them from the layer
+func (pelCanvas *PelCanvas) liftSelection(name string) error {
+	target := pelCanvas.layers.Active()
+	if err := target.CanPaint(); err != nil {
+		return err
+	}
+
+	pelCanvas.finishGesture()
+
+	clip := pelCanvas.selectedPixels()
+	if clip == nil {
+		return fmt.Errorf("nothing is selected")
+	}
+
+	stroke := NewStroke(pelCanvas.appState.BrushType, target)
+	pelCanvas.clearPixels(target, clip.mask, stroke)
+	pelCanvas.floating = &floatingSelection{
+		name:   name,
+		layer:  target,
+		pixels: clip.pixels,
+		stroke: stroke,
+		before: pelCanvas.selection,
+	}
+	return nil
+}
+
+// dropFloating paints the floating pixels onto their layer at their current
+// position and records the lift and drop as a single history step.
+// Transparent floating pixels leave the layer unchanged.
+func (pelCanvas *PelCanvas) dropFloating() {
+	floating := pelCanvas.floating
+	if floating == nil {
+		return
+	}
+	pelCanvas.floating = nil
+
+	bounds := floating.pixels.Rect.Intersect(pelCanvas.canvasRect())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if c := floating.pixels.NRGBAAt(x, y); c.A != 0 && pelCanvas.selection.Contains(x, y) {
+				pelCanvas.paintPixel(floating.layer, c, x, y, floating.stroke)
+			}
+		}
+	}
+
+	pelCanvas.selectionDirty = true
+	pelCanvas.recordPixels(floating.name, floating.stroke, floating.before)
+}
+
+// clearSelection clears the selected pixels, or discards the floating
+// pixels, and records the change under the given name
+func (pelCanvas *PelCanvas) clearSelection(name string) error {
+	if floating := pelCanvas.floating; floating != nil {
+		// The pixels were already cleared from the layer when they were lifted
+		pelCanvas.finishGesture()
+		pelCanvas.floating = nil
+		pelCanvas.selectionDirty = true
+		pelCanvas.recordPixels(name, floating.stroke, floating.before)
+		pelCanvas.Refresh()
+		return nil
+	}
+
+	target := pelCanvas.layers.Active()
+	if err := target.CanPaint(); err != nil {
+		return err
+	}
+
+	pelCanvas.finishGesture()
+
+	stroke := NewStroke(pelCanvas.appState.BrushType, target)
+	pelCanvas.clearPixels(target, pelCanvas.selection, stroke)
+	pelCanvas.recordPixels(name, stroke, pelCanvas.selection)
+	pelCanvas.Refresh()
+	return nil
+}
+
+// clearPixels makes the pixels of a layer selected by mask transparent
+func (pelCanvas *PelCanvas) clearPixels(target *layer.Layer, mask *selection.Mask, stroke *Stroke) {
+	bounds := mask.Bounds().Intersect(pelCanvas.canvasRect())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if mask.Contains(x, y) {
+				pelCanvas.paintPixel(target, brush.EraserColor, x, y, stroke)
+			}
+		}
+	}
+}
+
+// recordPixels records the pixels changed by a selection edit or filter as
+// a single history step. before is the selection to restore on undo; the
+// current selection is restored on redo.
+func (pelCanvas *PelCanvas) recordPixels(name string, stroke *Stroke, before *selection.Mask) {
+	if stroke.IsEmpty() && before == pelCanvas.selection {
+		return
+	}
+	pelCanvas.record(&pixelCommand{
+		name:            name,
+		stroke:          stroke,
+		selectionBefore: before,
+		selectionAfter:  pelCanvas.selection,
+	})
+	pelCanvas.layersChanged()
+	pelCanvas.framesChanged()
+}
+
+// beginSelectionDrag starts a selection tool gesture at a pixel. Without
+// modifiers, dragging inside the selection with the marquee or lasso moves
+// the selected pixels. Otherwise the tool's shape is combined with the
+// selection as chosen by the modifiers; the magic wand applies at once.
+func (pelCanvas *PelCanvas) beginSelectionDrag(x, y int, modifiers fyne.KeyModifier) {
+	tool := pelCanvas.appState.BrushType
+	op := selectionOp(modifiers)
+	p := image.Point{X: x, Y: y}
+
+	if op == selection.OpReplace && tool != apptype.BrushTypeMagicWand && pelCanvas.selection.Contains(x, y) {
+		if pelCanvas.floating == nil {
+			if err := pelCanvas.liftSelection(MoveSelectionName); err != nil {
+				log.Printf("Cannot move selection: %v", err)
+				return
+			}
+		}
+		pelCanvas.mouseState.selectionDrag = &selectionDrag{tool: tool, start: p, last: p, moving: true}
+		return
+	}
+
+	pelCanvas.finishGesture()
+
+	if tool == apptype.BrushTypeMagicWand {
+		if p.In(pelCanvas.canvasRect()) {
+			opts := pelCanvas.appState.WandOptions
+			wand := selection.Wand(pelCanvas.layers.Active().Image, x, y, opts.Tolerance, opts.Contiguous)
+			pelCanvas.setSelection(selection.Combine(pelCanvas.selection, wand, op))
+			pelCanvas.Refresh()
+		}
+		return
+	}
+
+	drag := &selectionDrag{tool: tool, op: op, base: pelCanvas.selection, start: p, last: p, path: []image.Point{p}}
+	pelCanvas.mouseState.selectionDrag = drag
+	pelCanvas.setSelection(selection.Combine(drag.base, drag.shape(), op))
+	pelCanvas.Refresh()
+}
+
+// updateSelectionDrag follows the mouse during a selection tool drag
+func (pelCanvas *PelCanvas) updateSelectionDrag(x, y int) {
+	drag := pelCanvas.mouseState.selectionDrag
+	p := image.Point{X: x, Y: y}
+	if drag == nil || p == drag.last {
+		return
+	}
+	drag.last = p
+	drag.dragged = true
+
+	if drag.moving {
+		d := p.Sub(drag.path[len(drag.path)-1])
+		drag.path = append(drag.path[:0], p)
+		if err := pelCanvas.MoveSelection(d.X, d.Y); err != nil {
+			log.Printf("Cannot move selection: %v", err)
+		}
+		return
+	}
+
+	drag.path = append(drag.path, p)
+	pelCanvas.setSelection(selection.Combine(drag.base, drag.shape(), drag.op))
+	pelCanvas.Refresh()
+}
+
+// endSelectionDrag finishes a selection tool drag. Clicking without
+// dragging deselects, or keeps the selection when combining.
+func (pelCanvas *PelCanvas) endSelectionDrag(x, y int) {
+	drag := pelCanvas.mouseState.selectionDrag
+	if drag == nil {
+		return
+	}
+
+	pelCanvas.updateSelectionDrag(x, y)
+	pelCanvas.mouseState.selectionDrag = nil
+	if !drag.moving && !drag.dragged {
+		if drag.op == selection.OpReplace {
+			pelCanvas.setSelection(nil)
+		} else {
+			pelCanvas.setSelection(drag.base)
+		}
+	}
+	pelCanvas.Refresh()
+}
+
+// shape returns the mask drawn so far by a marquee or lasso drag
+func (drag *selectionDrag) shape() *selection.Mask {
+	if drag.tool == apptype.BrushTypeLasso {
+		return selection.Polygon(drag.path)
+	}
+	r := image.Rectangle{Min: drag.start, Max: drag.last}.Canon()
+	r.Max = r.Max.Add(image.Point{X: 1, Y: 1})
+	return selection.Rect(r)
+}
+
+// selectionOp returns how a new selection shape is combined with the
+// selection for the held modifiers: Shift adds, Alt subtracts and both
+// together intersect
+func selectionOp(modifiers fyne.KeyModifier) selection.Op {
+	shift := modifiers&fyne.KeyModifierShift != 0
+	alt := modifiers&fyne.KeyModifierAlt != 0
+	switch {
+	case shift && alt:
+		return selection.OpIntersect
+	case shift:
+		return selection.OpAdd
+	case alt:
+		return selection.OpSubtract
+	default:
+		return selection.OpReplace
+	}
+}
+
+// cloneNRGBA returns an independent copy of an image
+func cloneNRGBA(img *image.NRGBA) *image.NRGBA {
+	clone := image.NewNRGBA(img.Rect)
+	copy(clone.Pix, img.Pix)
+	return clone
+}
+
+// pixelCommand records the pixels changed by a filter or a selection edit,
+// along with the selection before and after the change
+type pixelCommand struct {
+	name            string
+	stroke          *Stroke
+	selectionBefore *selection.Mask
+	selectionAfter  *selection.Mask
+}
+
+// Name returns the name of the operation
+func (cmd *pixelCommand) Name() string {
+	return cmd.name
+}
+
+// Undo restores every pixel and the selection as they were before the change
+func (cmd *pixelCommand) Undo(pelCanvas *PelCanvas) error {
+	pelCanvas.setSelection(cmd.selectionBefore)
+	if cmd.stroke.IsEmpty() {
+		return nil
+	}
+	return cmd.stroke.Undo(pelCanvas)
+}
+
+// Redo repeats the change to the pixels and the selection
+func (cmd *pixelCommand) Redo(pelCanvas *PelCanvas) error {
+	pelCanvas.setSelection(cmd.selectionAfter)
+	if cmd.stroke.IsEmpty() {
+		return nil
+	}
+	return cmd.stroke.Redo(pelCanvas)
+}
+
+// Size returns the approximate memory used by the changed pixels and both
+// selections in bytes
+func (cmd *pixelCommand) Size() int {
+	return cmd.stroke.Size() + maskSize(cmd.selectionBefore) + maskSize(cmd.selectionAfter)
+}
+
+// maskSize returns the approximate memory used by a mask in bytes
+func maskSize(mask *selection.Mask) int {
+	if mask == nil {
+		return 0
+	}
+	bounds := mask.Bounds()
+	return bounds.Dx() * bounds.Dy()
+}
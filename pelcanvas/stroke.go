@@ -0,0 +1,66 @@
+// Package pelcanvas provides stroke recording for the pixel canvas.
+package pelcanvas
+
+import (
+	"image"
+	"image/color"
+	"github.com/carlomunguia/pel/apptype"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// PixelChange records a single pixel modified during a stroke
+type PixelChange struct {
+	X, Y        int         // Canvas pixel coordinates
+	Before      color.NRGBA // Color before the stroke touched the pixel
+	After       color.NRGBA // Color after the stroke's last write to the pixel
+	BeforeIndex uint8       // Palette index before the stroke, on indexed layers
+	AfterIndex  uint8       // Palette index after the stroke, on indexed layers
+}
+
+// Stroke groups every pixel mutation made by a single gesture,
+// from mouse down to mouse up
+type Stroke struct {
+	Tool    apptype.BrushType   // Brush tool that made the stroke
+	Layer   *layer.Layer        // Layer the stroke was painted on
+	changes []PixelChange       // Changed pixels in the order first touched
+	index   map[image.Point]int // Position of each pixel in changes
+}
+
+// NewStroke creates an empty stroke for the given tool on the given layer
+func NewStroke(tool apptype.BrushType, target *layer.Layer) *Stroke {
+	return &Stroke{
+		Tool:    tool,
+		Layer:   target,
+		changes: make([]PixelChange, 0),
+		index:   make(map[image.Point]int),
+	}
+}
+
+// Record adds a pixel change to the stroke.
+// Pixels painted more than once keep their original Before color and index.
+func (stroke *Stroke) Record(change PixelChange) {
+	p := image.Point{X: change.X, Y: change.Y}
+	if i, ok := stroke.index[p]; ok {
+		stroke.changes[i].After = change.After
+		stroke.changes[i].AfterIndex = change.AfterIndex
+		return
+	}
+
+	stroke.index[p] = len(stroke.changes)
+	stroke.changes = append(stroke.changes, change)
+}
+
+// Changes returns the pixel changes made by the stroke
+func (stroke *Stroke) Changes() []PixelChange {
+	return stroke.changes
+}
+
+// Len returns the number of distinct pixels changed by the stroke
+func (stroke *Stroke) Len() int {
+	return len(stroke.changes)
+}
+
+// IsEmpty returns true if the stroke did not change any pixel
+func (stroke *Stroke) IsEmpty() bool {
+	return len(stroke.changes) == 0
+}
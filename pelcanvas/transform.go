@@ -0,0 +1,322 @@
+// Package pelcanvas provides whole-drawing and selection pixel transforms for the pixel canvas.
+package pelcanvas
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"github.com/carlomunguia/pel/palette"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+	"github.com/carlomunguia/pel/selection"
+	"github.com/carlomunguia/pel/transform"
+)
+
+// Document transform names shown in the history
+const (
+	CanvasSizeName = "Canvas Size"
+	ImageSizeName  = "Image Size"
+)
+
+// ReduceToPalette replaces every pixel of every layer and frame with the
+// nearest of the given colors under the metric. Fully transparent pixels
+// are left alone and in RGB mode every pixel keeps its alpha. In indexed
+// color mode the document palette is used and colors is ignored.
+func (pelCanvas *PelCanvas) ReduceToPalette(colors []color.Color, metric palette.Metric) error {
+	if !metric.IsValid() {
+		return fmt.Errorf("invalid color metric: %d", metric)
+	}
+	if pelCanvas.IsIndexed() {
+		colors = pelCanvas.palette[layer.TransparentIndex+1:]
+	}
+	if len(colors) == 0 {
+		return fmt.Errorf("palette has no colors")
+	}
+
+	matcher := palette.NewMatcher(colors, metric)
+	err := pelCanvas.transformDocument("Reduce to Palette", pelCanvas.palette, func(l *layer.Layer) {
+		bounds := l.Image.Rect
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := l.At(x, y)
+				if c.A == 0 {
+					continue
+				}
+				i := matcher.Nearest(c)
+				if l.IsIndexed() {
+					l.SetIndex(x, y, uint8(i+1))
+				} else {
+					match := color.NRGBAModel.Convert(colors[i]).(color.NRGBA)
+					match.A = c.A
+					l.Set(x, y, match)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reduced drawing to %d colors (%s distance)", len(colors), metric)
+	return nil
+}
+
+// transformDocument replaces the drawing with a copy in which transform has
+// been applied to every layer of every frame, sets the palette (nil for RGB
+// mode) and records the replacement in the history under the given name.
+// The original layers are never modified, so the replacement can be undone.
+func (pelCanvas *PelCanvas) transformDocument(name string, p color.Palette, transform func(l *layer.Layer)) error {
+	pelCanvas.finishGesture()
+
+	frames := make([]*animation.Frame, 0, pelCanvas.timeline.Len())
+	for _, frame := range pelCanvas.timeline.Frames() {
+		layers := make([]*layer.Layer, 0, frame.Layers.Len())
+		for _, l := range frame.Layers.Layers() {
+			transformed := l.Clone()
+			transform(transformed)
+			layers = append(layers, transformed)
+		}
+		stack, err := layer.NewStackFromLayers(layers, frame.Layers.ActiveIndex())
+		if err != nil {
+			return err
+		}
+		frames = append(frames, &animation.Frame{Layers: stack, Duration: frame.Duration})
+	}
+
+	timeline, err := animation.NewTimelineFromFrames(frames, pelCanvas.timeline.CurrentIndex())
+	if err != nil {
+		return err
+	}
+	for _, tag := range pelCanvas.timeline.Tags() {
+		if err := timeline.AddTag(tag); err != nil {
+			return err
+		}
+	}
+
+	return pelCanvas.loadTimeline(timeline, p, name)
+}
+
+// OrientImage flips or turns every layer of every frame. Quarter turns swap
+// the canvas width and height. The selection is dropped first.
+func (pelCanvas *PelCanvas) OrientImage(o transform.Orientation) error {
+	if !o.IsValid() {
+		return fmt.Errorf("invalid orientation: %d", o)
+	}
+
+	pelCanvas.finishGesture()
+	pelCanvas.setSelection(nil)
+
+	err := pelCanvas.transformDocument(o.String(), pelCanvas.palette, func(l *layer.Layer) {
+		l.Image = transform.Orient(l.Image, o)
+		if l.Indices != nil {
+			l.Indices = transform.OrientPaletted(l.Indices, o)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%s: %dx%d pixels", o, pelCanvas.PxCols, pelCanvas.PxRows)
+	return nil
+}
+
+// RotateImage turns every layer of every frame clockwise by degrees around
+// the canvas center. Multiples of 90 degrees are lossless; other angles use
+// RotSprite and keep the canvas size, cutting off the corners. The
+// selection is dropped first.
+func (pelCanvas *PelCanvas) RotateImage(degrees float64) error {
+	degrees = normalizeAngle(degrees)
+	if degrees == 0 {
+		return nil
+	}
+	if o, ok := quarterTurn(degrees); ok {
+		return pelCanvas.OrientImage(o)
+	}
+
+	pelCanvas.finishGesture()
+	pelCanvas.setSelection(nil)
+
+	err := pelCanvas.transformDocument(rotateName(degrees), pelCanvas.palette, func(l *layer.Layer) {
+		// Indexed layers are rotated in color and matched back to their palette
+		indices := l.Indices
+		l.ClearPalette()
+		l.Image = transform.RotSprite(l.Image, degrees, false)
+		if indices != nil {
+			l.SetPalette(indices.Palette)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Rotated drawing by %g°", degrees)
+	return nil
+}
+
+// ResizeCanvas changes the canvas to cols x rows pixels without scaling the
+// drawing. The anchor chooses which part of the drawing stays in place: it
+// is cropped when the canvas shrinks, and new pixels are transparent. The
+// selection is dropped first.
+func (pelCanvas *PelCanvas) ResizeCanvas(cols, rows int, anchor transform.Anchor) error {
+	if cols <= 0 || rows <= 0 {
+		return fmt.Errorf("invalid canvas dimensions: %dx%d", cols, rows)
+	}
+	if !anchor.IsValid() {
+		return fmt.Errorf("invalid anchor: %d", anchor)
+	}
+
+	pelCanvas.finishGesture()
+	pelCanvas.setSelection(nil)
+
+	err := pelCanvas.transformDocument(CanvasSizeName, pelCanvas.palette, func(l *layer.Layer) {
+		l.Image = transform.Resize(l.Image, cols, rows, anchor)
+		if l.Indices != nil {
+			l.Indices = transform.ResizePaletted(l.Indices, cols, rows, anchor)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Resized canvas to %dx%d (anchor %s)", cols, rows, anchor)
+	return nil
+}
+
+// ScaleImage resamples every layer of every frame to cols x rows pixels
+// with the given filter. Indexed layers are matched back to their palette.
+// The selection is dropped first.
+func (pelCanvas *PelCanvas) ScaleImage(cols, rows int, filter transform.Filter) error {
+	if cols <= 0 || rows <= 0 {
+		return fmt.Errorf("invalid image dimensions: %dx%d", cols, rows)
+	}
+	if !filter.IsValid() {
+		return fmt.Errorf("invalid scaling filter: %d", filter)
+	}
+
+	pelCanvas.finishGesture()
+	pelCanvas.setSelection(nil)
+
+	err := pelCanvas.transformDocument(ImageSizeName, pelCanvas.palette, func(l *layer.Layer) {
+		indices := l.Indices
+		l.ClearPalette()
+		l.Image = transform.Scale(l.Image, cols, rows, filter)
+		if indices != nil {
+			l.SetPalette(indices.Palette)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Scaled drawing to %dx%d (%s)", cols, rows, filter)
+	return nil
+}
+
+// OrientSelection flips or turns the selected pixels of the active layer
+// around the center of the selection, lifting them into a floating
+// selection first if needed
+func (pelCanvas *PelCanvas) OrientSelection(o transform.Orientation) error {
+	if !o.IsValid() {
+		return fmt.Errorf("invalid orientation: %d", o)
+	}
+	return pelCanvas.transformSelection(o.String(), func(img *image.NRGBA) *image.NRGBA {
+		return transform.Orient(img, o)
+	})
+}
+
+// RotateSelection turns the selected pixels of the active layer clockwise
+// by degrees around the center of the selection, lifting them into a
+// floating selection first if needed. Multiples of 90 degrees are lossless;
+// other angles use RotSprite and enlarge the selection to fit.
+func (pelCanvas *PelCanvas) RotateSelection(degrees float64) error {
+	degrees = normalizeAngle(degrees)
+	if degrees == 0 {
+		return nil
+	}
+	if o, ok := quarterTurn(degrees); ok {
+		return pelCanvas.OrientSelection(o)
+	}
+	return pelCanvas.transformSelection(rotateName(degrees), func(img *image.NRGBA) *image.NRGBA {
+		return transform.RotSprite(img, degrees, true)
+	})
+}
+
+// transformSelection replaces the floating pixels and the selection with
+// copies transformed by apply, centered where they were. apply is given
+// images that start at the origin.
+func (pelCanvas *PelCanvas) transformSelection(name string, apply func(img *image.NRGBA) *image.NRGBA) error {
+	if pelCanvas.selection == nil {
+		return fmt.Errorf("nothing is selected")
+	}
+	if pelCanvas.floating == nil {
+		if err := pelCanvas.liftSelection(name); err != nil {
+			return err
+		}
+	}
+
+	floating := pelCanvas.floating
+	bounds := floating.pixels.Rect
+	pixels := cloneNRGBA(floating.pixels)
+	pixels.Rect = pixels.Rect.Sub(bounds.Min)
+
+	// The mask is transformed as an image so it follows the pixels exactly
+	shape := image.NewNRGBA(pixels.Rect)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if pelCanvas.selection.Contains(x, y) {
+				shape.SetNRGBA(x-bounds.Min.X, y-bounds.Min.Y, color.NRGBA{A: 255})
+			}
+		}
+	}
+
+	pixels, shape = apply(pixels), apply(shape)
+	offset := bounds.Min.Add(bounds.Size().Sub(pixels.Rect.Size()).Div(2))
+	pixels.Rect = pixels.Rect.Add(offset)
+	mask := selection.NewMask(pixels.Rect)
+	for y := shape.Rect.Min.Y; y < shape.Rect.Max.Y; y++ {
+		for x := shape.Rect.Min.X; x < shape.Rect.Max.X; x++ {
+			if shape.NRGBAAt(x, y).A != 0 {
+				mask.Set(x+offset.X, y+offset.Y, true)
+			}
+		}
+	}
+
+	floating.pixels = pixels
+	pelCanvas.selection = mask
+	pelCanvas.selectionDirty = true
+	pelCanvas.Refresh()
+
+	log.Printf("%s: %dx%d pixels", name, pixels.Rect.Dx(), pixels.Rect.Dy())
+	return nil
+}
+
+// normalizeAngle returns degrees turned into the range [0, 360)
+func normalizeAngle(degrees float64) float64 {
+	degrees = math.Mod(degrees, 360)
+	if degrees < 0 {
+		degrees += 360
+	}
+	return degrees
+}
+
+// quarterTurn returns the orientation that turns by a normalized angle,
+// and false if the angle is not a positive multiple of 90 degrees
+func quarterTurn(degrees float64) (transform.Orientation, bool) {
+	switch degrees {
+	case 180:
+		return transform.Rotate180, true
+	case 90:
+		return transform.Rotate90, true
+	case 270:
+		return transform.Rotate270, true
+	default:
+		return 0, false
+	}
+}
+
+// rotateName returns the history name of a rotation by degrees
+func rotateName(degrees float64) string {
+	return fmt.Sprintf("Rotate %g°", degrees)
+}
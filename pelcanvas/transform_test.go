@@ -0,0 +1,73 @@
+package pelcanvas
+
+import (
+	"image/color"
+	"testing"
+	"github.com/carlomunguia/pel/apptype"
+	"github.com/carlomunguia/pel/transform"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/test"
+)
+
+// newTestCanvas returns a canvas of the given size with a blank background
+func newTestCanvas(t *testing.T, cols, rows int) *PelCanvas {
+	t.Helper()
+	test.NewTempApp(t)
+
+	state := &apptype.State{
+		BrushColor:   color.NRGBA{A: 255},
+		FillOptions:  apptype.FillOptions{Connectivity: apptype.FillConnectivity4},
+		ShapeOptions: apptype.ShapeOptions{StrokeWidth: apptype.MinStrokeWidth},
+		WandOptions:  apptype.DefaultWandOptions,
+		OnionSkin:    apptype.DefaultOnionSkin,
+	}
+	return NewPelCanvas(state, apptype.PelCanvasConfig{
+		DrawingArea: fyne.NewSize(100, 100),
+		PxCols:      cols,
+		PxRows:      rows,
+		PxSize:      1,
+	})
+}
+
+func TestOrientImageUndo(t *testing.T) {
+	tests := []struct {
+		orient     transform.Orientation
+		cols, rows int // Canvas size after the orientation
+		x, y       int // Where the top left pixel ends up
+	}{
+		{transform.FlipHorizontal, 5, 3, 4, 0},
+		{transform.FlipVertical, 5, 3, 0, 2},
+		{transform.Rotate90, 3, 5, 2, 0},
+		{transform.Rotate180, 5, 3, 4, 2},
+		{transform.Rotate270, 3, 5, 0, 4},
+	}
+
+	marker := color.NRGBA{R: 255, A: 255}
+	for _, tt := range tests {
+		t.Run(tt.orient.String(), func(t *testing.T) {
+			pelCanvas := newTestCanvas(t, 5, 3)
+			pelCanvas.layers.Active().Image.SetNRGBA(0, 0, marker)
+
+			if err := pelCanvas.OrientImage(tt.orient); err != nil {
+				t.Fatalf("OrientImage() error = %v", err)
+			}
+			if pelCanvas.PxCols != tt.cols || pelCanvas.PxRows != tt.rows {
+				t.Fatalf("size = %dx%d, want %dx%d", pelCanvas.PxCols, pelCanvas.PxRows, tt.cols, tt.rows)
+			}
+			if got := pelCanvas.layers.Active().Image.NRGBAAt(tt.x, tt.y); got != marker {
+				t.Errorf("pixel (%d, %d) = %v, want %v", tt.x, tt.y, got, marker)
+			}
+
+			if err := pelCanvas.Undo(); err != nil {
+				t.Fatalf("Undo() error = %v", err)
+			}
+			if pelCanvas.PxCols != 5 || pelCanvas.PxRows != 3 {
+				t.Fatalf("size after undo = %dx%d, want 5x3", pelCanvas.PxCols, pelCanvas.PxRows)
+			}
+			if got := pelCanvas.layers.Active().Image.NRGBAAt(0, 0); got != marker {
+				t.Errorf("pixel (0, 0) after undo = %v, want %v", got, marker)
+			}
+		})
+	}
+}
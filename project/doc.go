@@ -0,0 +1,89 @@
+// Package project reads and writes native Pel project files (.pel).
+//
+// A project file is a zip archive holding a JSON manifest and one PNG image
+// per layer of each animation frame, so it can be inspected with ordinary tools:
+//
+//	manifest.json          project metadata (see below)
+//	frames/000/000.png     pixels of the bottom layer of the first frame
+//	frames/000/001.png     pixels of the next layer up, and so on
+//	frames/001/000.png     pixels of the bottom layer of the second frame
+//	preview.png            the first frame flattened (informational, never read)
+//
+// # Manifest schema (version 2)
+//
+//	{
+//	  "format":  "pel",            // always "pel"
+//	  "version": 2,                // schema version, see CurrentVersion
+//	  "canvas": {
+//	    "cols": 32, "rows": 32,    // canvas size in pixels
+//	    "pixelSize": 10,           // zoom: screen pixels per canvas pixel
+//	    "drawingArea": {"width": 600, "height": 600},
+//	    "offset": {"x": 0, "y": 0} // pan offset of the canvas
+//	  },
+//	  "frames": [                  // in playback order
+//	    {
+//	      "duration": 100,         // milliseconds the frame is shown
+//	      "layers": [              // bottom layer first
+//	        {
+//	          "name": "Background",
+//	          "visible": true,
+//	          "opacity": 255,      // 0 (transparent) to 255 (opaque)
+//	          "locked": false,
+//	          "blend": "Normal",   // a layer.BlendMode name
+//	          "image": "frames/000/000.png"
+//	        }
+//	      ],
+//	      "activeLayer": 0         // index into the frame's layers
+//	    }
+//	  ],
+//	  "activeFrame": 0,            // index into frames
+//	  "tags": [                    // optional named frame ranges
+//	    {"name": "walk", "from": 0, "to": 3, "direction": "forward"}
+//	  ],                           // direction: forward, reverse or pingpong
+//	  "swatches": ["#FF0000", "#00FF0080"], // "#RRGGBB" or "#RRGGBBAA"
+//	  "palette": ["#FF0000", "#000000"], // optional, see below
+//	  "state": {
+//	    "brushColor": "#000000",
+//	    "brushType": "Pencil",     // an apptype.BrushType name
+//	    "swatchSelected": 0,
+//	    "fill": {"connectivity": "4-way", "tolerance": 0, "global": false},
+//	    "shape": {"filled": false, "strokeWidth": 1},
+//	    "lockToPalette": false,    // picker colors snap to the swatches
+//	    "onionSkin": {             // neighbouring frames shown while editing
+//	      "enabled": false,
+//	      "before": 1, "after": 1, // frames shown either side, 0 to 8
+//	      "opacity": 96,           // 0 to 255
+//	      "prevTint": "#FF4040A0", "nextTint": "#4080FFA0"
+//	    },
+//	    "wand": {"tolerance": 0, "contiguous": true} // magic wand options
+//	  }
+//	}
+//
+// Projects in indexed color mode also store "palette": the document palette
+// without its reserved transparent entry, so the first color is index 1. Their
+// layer images are paletted PNGs whose indices refer to the document palette.
+// Files without a palette are in RGB mode. Older readers ignore the palette
+// and load the paletted layer images as ordinary RGB layers.
+//
+// Unknown fields are ignored, so newer files that only add fields can still
+// be read by older versions of Pel. Settings added to version 2 after its
+// first release take their defaults when missing: "lockToPalette" is off,
+// "onionSkin" is apptype.DefaultOnionSkin and "wand" is
+// apptype.DefaultWandOptions.
+//
+// Version 1 had no frames: "layers" and "activeLayer" sat at the top level
+// and images were stored under layers/. It is migrated to a single frame
+// with the default duration.
+//
+// # Versioning and migration
+//
+// Every change to the manifest that older readers cannot ignore bumps
+// CurrentVersion. When a file with an older version is opened, the manifest
+// is decoded into a generic JSON object and passed through each registered
+// migration in turn (version 1 to 2, 2 to 3, ...) until it matches the
+// current schema, and only then decoded into the typed manifest. Adding a
+// version therefore means: bump CurrentVersion, update the manifest types
+// and this schema, and register a migration from the previous version in
+// migrations. Files written by a newer version than CurrentVersion are
+// rejected with ErrNewerVersion.
+package project
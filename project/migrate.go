@@ -0,0 +1,87 @@
+// Package project provides manifest migration between project format versions.
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+)
+
+// migration upgrades a decoded manifest by exactly one version in place
+type migration func(manifest map[string]any) error
+
+// migrations maps each version to the migration that upgrades it to the next
+// version. Every version below CurrentVersion must have an entry.
+var migrations = map[int]migration{
+	1: migrateFrames,
+}
+
+// migrateFrames upgrades version 1, which had a single image, by moving the
+// top level layers into one frame shown for the default duration
+func migrateFrames(manifest map[string]any) error {
+	layers, ok := manifest["layers"].([]any)
+	if !ok {
+		return fmt.Errorf("missing layers")
+	}
+
+	activeLayer, ok := manifest["activeLayer"]
+	if !ok {
+		activeLayer = 0
+	}
+
+	manifest["frames"] = []any{
+		map[string]any{
+			"duration":    animation.DefaultDuration,
+			"layers":      layers,
+			"activeLayer": activeLayer,
+		},
+	}
+	manifest["activeFrame"] = 0
+	delete(manifest, "layers")
+	delete(manifest, "activeLayer")
+	return nil
+}
+
+// migrate upgrades raw manifest JSON to CurrentVersion.
+// Returns the manifest unchanged if it is already current.
+func migrate(raw []byte) ([]byte, error) {
+	var header struct {
+		Format  string `json:"format"`
+		Version int    `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	if header.Format != FormatName {
+		return nil, fmt.Errorf("%w: unexpected format %q", ErrNotProject, header.Format)
+	}
+	if header.Version < 1 {
+		return nil, fmt.Errorf("invalid manifest version: %d", header.Version)
+	}
+	if header.Version > CurrentVersion {
+		return nil, fmt.Errorf("%w: file version %d, supported up to %d",
+			ErrNewerVersion, header.Version, CurrentVersion)
+	}
+	if header.Version == CurrentVersion {
+		return raw, nil
+	}
+
+	manifest := make(map[string]any)
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	for version := header.Version; version < CurrentVersion; version++ {
+		upgrade, ok := migrations[version]
+		if !ok {
+			return nil, fmt.Errorf("no migration from version %d", version)
+		}
+		if err := upgrade(manifest); err != nil {
+			return nil, fmt.Errorf("failed to migrate from version %d: %w", version, err)
+		}
+		manifest["version"] = version + 1
+	}
+
+	return json.Marshal(manifest)
+}
@@ -0,0 +1,599 @@
+// Package project provides encoding and decoding of Pel project files.
+package project
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"github.com/carlomunguia/pel/apptype"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+	"github.com/carlomunguia/pel/util"
+
+	"fyne.io/fyne/v2"
+)
+
+// Project file constants
+const (
+	FormatName     = "pel"  // Value of the manifest "format" field
+	FileExtension  = ".pel" // Extension used for project files
+	CurrentVersion = 2      // Manifest schema version written by this package
+
+	manifestName = "manifest.json"
+	previewName  = "preview.png"
+	frameDir     = "frames"
+)
+
+// Project file errors
+var (
+	ErrNotProject   = errors.New("not a pel project file")
+	ErrNewerVersion = errors.New("project was saved by a newer version of pel")
+)
+
+// Project is everything stored in a project file
+type Project struct {
+	Config   apptype.PelCanvasConfig // Canvas grid and view settings
+	Timeline *animation.Timeline     // Animation frames, each with its own layers
+	Swatches []color.Color           // Swatch palette colors in order
+	Palette  color.Palette           // Document palette in indexed color mode, nil in RGB mode
+	State    apptype.State           // Brush and tool settings (FilePath is not stored)
+}
+
+// manifest is the JSON document describing a project
+type manifest struct {
+	Format      string         `json:"format"`
+	Version     int            `json:"version"`
+	Canvas      canvasManifest `json:"canvas"`
+	Frames      []frameEntry   `json:"frames"`
+	ActiveFrame int            `json:"activeFrame"`
+	Tags        []tagEntry     `json:"tags,omitempty"`
+	Swatches    []string       `json:"swatches"`
+	Palette     []string       `json:"palette,omitempty"`
+	State       stateManifest  `json:"state"`
+}
+
+// canvasManifest stores apptype.PelCanvasConfig
+type canvasManifest struct {
+	Cols        int          `json:"cols"`
+	Rows        int          `json:"rows"`
+	PixelSize   int          `json:"pixelSize"`
+	DrawingArea sizeManifest `json:"drawingArea"`
+	Offset      posManifest  `json:"offset"`
+}
+
+// sizeManifest stores a fyne.Size
+type sizeManifest struct {
+	Width  float32 `json:"width"`
+	Height float32 `json:"height"`
+}
+
+// posManifest stores a fyne.Position
+type posManifest struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+}
+
+// frameEntry stores the duration and layers of one animation frame
+type frameEntry struct {
+	Duration    int          `json:"duration"`
+	Layers      []layerEntry `json:"layers"`
+	ActiveLayer int          `json:"activeLayer"`
+}
+
+// tagEntry stores a named range of frames
+type tagEntry struct {
+	Name      string `json:"name"`
+	From      int    `json:"from"`
+	To        int    `json:"to"`
+	Direction string `json:"direction"`
+}
+
+// layerEntry stores the properties of one layer and the name of its image
+type layerEntry struct {
+	Name    string `json:"name"`
+	Visible bool   `json:"visible"`
+	Opacity int    `json:"opacity"`
+	Locked  bool   `json:"locked"`
+	Blend   string `json:"blend"`
+	Image   string `json:"image"`
+}
+
+// stateManifest stores apptype.State
+type stateManifest struct {
+	BrushColor     string             `json:"brushColor"`
+	BrushType      string             `json:"brushType"`
+	SwatchSelected int                `json:"swatchSelected"`
+	Fill           fillManifest       `json:"fill"`
+	Shape          shapeManifest      `json:"shape"`
+	LockToPalette  bool               `json:"lockToPalette"`
+	OnionSkin      *onionSkinManifest `json:"onionSkin,omitempty"` // Absent from older files
+	Wand           *wandManifest      `json:"wand,omitempty"`      // Absent from older files
+}
+
+// fillManifest stores apptype.FillOptions
+type fillManifest struct {
+	Connectivity string `json:"connectivity"`
+	Tolerance    int    `json:"tolerance"`
+	Global       bool   `json:"global"`
+}
+
+// shapeManifest stores apptype.ShapeOptions
+type shapeManifest struct {
+	Filled      bool `json:"filled"`
+	StrokeWidth int  `json:"strokeWidth"`
+}
+
+// onionSkinManifest stores apptype.OnionSkinOptions
+type onionSkinManifest struct {
+	Enabled  bool   `json:"enabled"`
+	Before   int    `json:"before"`
+	After    int    `json:"after"`
+	Opacity  int    `json:"opacity"`
+	PrevTint string `json:"prevTint"`
+	NextTint string `json:"nextTint"`
+}
+
+// wandManifest stores apptype.WandOptions
+type wandManifest struct {
+	Tolerance  int  `json:"tolerance"`
+	Contiguous bool `json:"contiguous"`
+}
+
+// Save writes a project file to disk
+func Save(filePath string, p *Project) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	if err := Encode(file, p); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Load reads a project file from disk
+func Load(filePath string) (*Project, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	return Decode(file)
+}
+
+// Encode writes a project file to w
+func Encode(w io.Writer, p *Project) error {
+	if p == nil || p.Timeline == nil {
+		return fmt.Errorf("project has no frames")
+	}
+
+	m := manifest{
+		Format:      FormatName,
+		Version:     CurrentVersion,
+		Canvas:      encodeConfig(p.Config, p.Timeline),
+		Frames:      make([]frameEntry, 0, p.Timeline.Len()),
+		ActiveFrame: p.Timeline.CurrentIndex(),
+		Swatches:    make([]string, 0, len(p.Swatches)),
+		State:       encodeState(p.State),
+	}
+	for _, c := range p.Swatches {
+		m.Swatches = append(m.Swatches, util.ColorToHex(c))
+	}
+	if len(p.Palette) > 0 {
+		// The reserved transparent entry is implied
+		for _, c := range p.Palette[layer.TransparentIndex+1:] {
+			m.Palette = append(m.Palette, util.ColorToHex(c))
+		}
+	}
+	for _, tag := range p.Timeline.Tags() {
+		m.Tags = append(m.Tags, tagEntry{
+			Name:      tag.Name,
+			From:      tag.From,
+			To:        tag.To,
+			Direction: tag.Direction.String(),
+		})
+	}
+
+	archive := zip.NewWriter(w)
+
+	for f, frame := range p.Timeline.Frames() {
+		entry := frameEntry{
+			Duration:    frame.Duration,
+			Layers:      make([]layerEntry, 0, frame.Layers.Len()),
+			ActiveLayer: frame.Layers.ActiveIndex(),
+		}
+		for i, l := range frame.Layers.Layers() {
+			saved := layerEntry{
+				Name:    l.Name,
+				Visible: l.Visible,
+				Opacity: int(l.Opacity),
+				Locked:  l.Locked,
+				Blend:   l.Blend.String(),
+				Image:   path.Join(frameDir, fmt.Sprintf("%03d", f), fmt.Sprintf("%03d.png", i)),
+			}
+			var img image.Image = l.Image
+			if l.IsIndexed() && len(p.Palette) > 0 {
+				img = &image.Paletted{Pix: l.Indices.Pix, Stride: l.Indices.Stride, Rect: l.Indices.Rect, Palette: p.Palette}
+			}
+			if err := writePNG(archive, saved.Image, img); err != nil {
+				return err
+			}
+			entry.Layers = append(entry.Layers, saved)
+		}
+		m.Frames = append(m.Frames, entry)
+	}
+
+	if err := writePNG(archive, previewName, p.Timeline.Frame(0).Layers.Flatten()); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	manifestWriter, err := archive.Create(manifestName)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if _, err := manifestWriter.Write(data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to finish project file: %w", err)
+	}
+	return nil
+}
+
+// Decode reads a project file from r, migrating older versions
+func Decode(r io.Reader) (*Project, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project: %w", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotProject, err)
+	}
+
+	raw, err := readFile(archive, manifestName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotProject, err)
+	}
+	raw, err = migrate(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	palette, err := decodePalette(m.Palette)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline, err := decodeFrames(archive, m, palette)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Project{
+		Config:   decodeConfig(m.Canvas, timeline),
+		Timeline: timeline,
+		Swatches: make([]color.Color, 0, len(m.Swatches)),
+		Palette:  palette,
+	}
+	for _, hex := range m.Swatches {
+		c, err := util.HexToColor(hex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid swatch color: %w", err)
+		}
+		p.Swatches = append(p.Swatches, c)
+	}
+
+	p.State, err = decodeState(m.State)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// decodePalette converts the manifest palette to a document palette, or nil
+// for projects in RGB mode
+func decodePalette(entries []string) (color.Palette, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if len(entries) > layer.MaxPaletteColors {
+		return nil, fmt.Errorf("palette has %d colors, at most %d", len(entries), layer.MaxPaletteColors)
+	}
+
+	colors := make([]color.Color, 0, len(entries))
+	for _, hex := range entries {
+		c, err := util.HexToColor(hex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid palette color: %w", err)
+		}
+		colors = append(colors, c)
+	}
+	return layer.NewPalette(colors), nil
+}
+
+// decodeFrames reads every frame and rebuilds the timeline
+func decodeFrames(archive *zip.Reader, m manifest, palette color.Palette) (*animation.Timeline, error) {
+	if len(m.Frames) == 0 {
+		return nil, fmt.Errorf("project has no frames")
+	}
+
+	frames := make([]*animation.Frame, 0, len(m.Frames))
+	for i, entry := range m.Frames {
+		stack, err := decodeLayers(archive, entry, palette)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+
+		cols, rows := stack.Size()
+		if cols != m.Canvas.Cols || rows != m.Canvas.Rows {
+			return nil, fmt.Errorf("frame %d: layer size %dx%d does not match canvas size %dx%d",
+				i, cols, rows, m.Canvas.Cols, m.Canvas.Rows)
+		}
+		frames = append(frames, &animation.Frame{Layers: stack, Duration: entry.Duration})
+	}
+
+	timeline, err := animation.NewTimelineFromFrames(frames, m.ActiveFrame)
+	if err != nil {
+		return nil, fmt.Errorf("invalid frames: %w", err)
+	}
+
+	for _, entry := range m.Tags {
+		direction, ok := animation.ParseDirection(entry.Direction)
+		if !ok {
+			return nil, fmt.Errorf("unknown direction for tag %q: %s", entry.Name, entry.Direction)
+		}
+		tag := animation.Tag{Name: entry.Name, From: entry.From, To: entry.To, Direction: direction}
+		if err := timeline.AddTag(tag); err != nil {
+			return nil, fmt.Errorf("invalid tag: %w", err)
+		}
+	}
+	return timeline, nil
+}
+
+// decodeLayers reads every layer image of a frame and rebuilds its layer stack.
+// In indexed projects, paletted layer images keep their palette indices.
+func decodeLayers(archive *zip.Reader, frame frameEntry, palette color.Palette) (*layer.Stack, error) {
+	if len(frame.Layers) == 0 {
+		return nil, fmt.Errorf("frame has no layers")
+	}
+
+	layers := make([]*layer.Layer, 0, len(frame.Layers))
+	for _, entry := range frame.Layers {
+		data, err := readFile(archive, entry.Image)
+		if err != nil {
+			return nil, err
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode layer %q: %w", entry.Name, err)
+		}
+
+		if entry.Opacity < layer.MinOpacity || entry.Opacity > layer.MaxOpacity {
+			return nil, fmt.Errorf("invalid opacity for layer %q: %d", entry.Name, entry.Opacity)
+		}
+		blend, ok := layer.ParseBlendMode(entry.Blend)
+		if !ok {
+			return nil, fmt.Errorf("unknown blend mode for layer %q: %s", entry.Name, entry.Blend)
+		}
+
+		l := layer.FromImage(entry.Name, img)
+		if paletted, ok := img.(*image.Paletted); ok && palette != nil {
+			l = layer.FromPaletted(entry.Name, paletted, palette)
+		}
+		l.Visible = entry.Visible
+		l.Opacity = uint8(entry.Opacity)
+		l.Locked = entry.Locked
+		l.Blend = blend
+		layers = append(layers, l)
+	}
+
+	stack, err := layer.NewStackFromLayers(layers, frame.ActiveLayer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layers: %w", err)
+	}
+	return stack, nil
+}
+
+// encodeConfig converts the canvas configuration to its manifest form.
+// The grid size always follows the frames.
+func encodeConfig(config apptype.PelCanvasConfig, timeline *animation.Timeline) canvasManifest {
+	cols, rows := timeline.Size()
+	return canvasManifest{
+		Cols:        cols,
+		Rows:        rows,
+		PixelSize:   config.PxSize,
+		DrawingArea: sizeManifest{Width: config.DrawingArea.Width, Height: config.DrawingArea.Height},
+		Offset:      posManifest{X: config.CanvasOffset.X, Y: config.CanvasOffset.Y},
+	}
+}
+
+// decodeConfig converts the manifest canvas settings to a canvas configuration
+func decodeConfig(canvas canvasManifest, timeline *animation.Timeline) apptype.PelCanvasConfig {
+	cols, rows := timeline.Size()
+	return apptype.PelCanvasConfig{
+		DrawingArea:  fyne.NewSize(canvas.DrawingArea.Width, canvas.DrawingArea.Height),
+		CanvasOffset: fyne.NewPos(canvas.Offset.X, canvas.Offset.Y),
+		PxCols:       cols,
+		PxRows:       rows,
+		PxSize:       canvas.PixelSize,
+	}
+}
+
+// encodeState converts the application state to its manifest form
+func encodeState(state apptype.State) stateManifest {
+	return stateManifest{
+		BrushColor:     util.ColorToHex(state.BrushColor),
+		BrushType:      state.BrushType.String(),
+		SwatchSelected: state.SwatchSelected,
+		Fill: fillManifest{
+			Connectivity: state.FillOptions.Connectivity.String(),
+			Tolerance:    state.FillOptions.Tolerance,
+			Global:       state.FillOptions.Global,
+		},
+		Shape: shapeManifest{
+			Filled:      state.ShapeOptions.Filled,
+			StrokeWidth: state.ShapeOptions.StrokeWidth,
+		},
+		LockToPalette: state.LockToPalette,
+		OnionSkin: &onionSkinManifest{
+			Enabled:  state.OnionSkin.Enabled,
+			Before:   state.OnionSkin.Before,
+			After:    state.OnionSkin.After,
+			Opacity:  int(state.OnionSkin.Opacity),
+			PrevTint: util.ColorToHex(state.OnionSkin.PrevTint),
+			NextTint: util.ColorToHex(state.OnionSkin.NextTint),
+		},
+		Wand: &wandManifest{
+			Tolerance:  state.WandOptions.Tolerance,
+			Contiguous: state.WandOptions.Contiguous,
+		},
+	}
+}
+
+// decodeState converts the manifest state to application state
+func decodeState(m stateManifest) (apptype.State, error) {
+	var state apptype.State
+
+	brushColor, err := util.HexToColor(m.BrushColor)
+	if err != nil {
+		return state, fmt.Errorf("invalid brush color: %w", err)
+	}
+	brushType, ok := parseBrushType(m.BrushType)
+	if !ok {
+		return state, fmt.Errorf("unknown brush type: %s", m.BrushType)
+	}
+	connectivity, ok := parseConnectivity(m.Fill.Connectivity)
+	if !ok {
+		return state, fmt.Errorf("unknown fill connectivity: %s", m.Fill.Connectivity)
+	}
+	onionSkin, err := decodeOnionSkin(m.OnionSkin)
+	if err != nil {
+		return state, err
+	}
+
+	state = apptype.State{
+		BrushColor:     brushColor,
+		BrushType:      brushType,
+		SwatchSelected: m.SwatchSelected,
+		FillOptions: apptype.FillOptions{
+			Connectivity: connectivity,
+			Tolerance:    m.Fill.Tolerance,
+			Global:       m.Fill.Global,
+		},
+		ShapeOptions: apptype.ShapeOptions{
+			Filled:      m.Shape.Filled,
+			StrokeWidth: m.Shape.StrokeWidth,
+		},
+		LockToPalette: m.LockToPalette,
+		OnionSkin:     onionSkin,
+		WandOptions:   apptype.DefaultWandOptions,
+	}
+	if m.Wand != nil {
+		state.WandOptions = apptype.WandOptions{Tolerance: m.Wand.Tolerance, Contiguous: m.Wand.Contiguous}
+	}
+
+	if err := state.Validate(); err != nil {
+		return state, fmt.Errorf("invalid state: %w", err)
+	}
+	return state, nil
+}
+
+// decodeOnionSkin converts the manifest onion skin settings, using the
+// defaults for files saved before they were stored
+func decodeOnionSkin(m *onionSkinManifest) (apptype.OnionSkinOptions, error) {
+	if m == nil {
+		return apptype.DefaultOnionSkin, nil
+	}
+	if m.Opacity < 0 || m.Opacity > 255 {
+		return apptype.OnionSkinOptions{}, fmt.Errorf("onion skin opacity must be between 0 and 255, got: %d", m.Opacity)
+	}
+
+	prevTint, err := util.HexToColor(m.PrevTint)
+	if err != nil {
+		return apptype.OnionSkinOptions{}, fmt.Errorf("invalid onion skin tint: %w", err)
+	}
+	nextTint, err := util.HexToColor(m.NextTint)
+	if err != nil {
+		return apptype.OnionSkinOptions{}, fmt.Errorf("invalid onion skin tint: %w", err)
+	}
+
+	return apptype.OnionSkinOptions{
+		Enabled:  m.Enabled,
+		Before:   m.Before,
+		After:    m.After,
+		Opacity:  uint8(m.Opacity),
+		PrevTint: color.NRGBAModel.Convert(prevTint).(color.NRGBA),
+		NextTint: color.NRGBAModel.Convert(nextTint).(color.NRGBA),
+	}, nil
+}
+
+// parseBrushType returns the brush type with the given name
+func parseBrushType(name string) (apptype.BrushType, bool) {
+	for bt := apptype.BrushTypePencil; bt.IsValid(); bt++ {
+		if bt.String() == name {
+			return bt, true
+		}
+	}
+	return apptype.BrushTypePencil, false
+}
+
+// parseConnectivity returns the fill connectivity with the given name
+func parseConnectivity(name string) (apptype.FillConnectivity, bool) {
+	for fc := apptype.FillConnectivity4; fc.IsValid(); fc++ {
+		if fc.String() == name {
+			return fc, true
+		}
+	}
+	return apptype.FillConnectivity4, false
+}
+
+// writePNG adds an image to the archive as a PNG file
+func writePNG(archive *zip.Writer, name string, img image.Image) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := png.Encode(w, img); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return nil
+}
+
+// readFile returns the contents of a file in the archive
+func readFile(archive *zip.Reader, name string) ([]byte, error) {
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("missing %s: %w", name, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,82 @@
+// Package selection provides set operations that combine selection masks.
+package selection
+
+import (
+	"image"
+)
+
+// Op selects how a new selection shape is combined with the current selection
+type Op int
+
+// Selection combination operations
+const (
+	OpReplace   Op = iota // The shape replaces the selection
+	OpAdd                 // The shape is added to the selection
+	OpSubtract            // The shape is removed from the selection
+	OpIntersect           // Only pixels in both the selection and the shape stay selected
+)
+
+// String returns a human-readable name for the operation
+func (op Op) String() string {
+	switch op {
+	case OpReplace:
+		return "Replace"
+	case OpAdd:
+		return "Add"
+	case OpSubtract:
+		return "Subtract"
+	case OpIntersect:
+		return "Intersect"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the operation is valid
+func (op Op) IsValid() bool {
+	return op >= OpReplace && op <= OpIntersect
+}
+
+// Combine returns a new mask combining the selection base with shape.
+// A nil mask selects nothing. Neither mask is modified.
+func Combine(base, shape *Mask, op Op) *Mask {
+	var bounds image.Rectangle
+	switch op {
+	case OpAdd:
+		bounds = maskBounds(base).Union(maskBounds(shape))
+	case OpSubtract:
+		bounds = maskBounds(base)
+	case OpIntersect:
+		bounds = maskBounds(base).Intersect(maskBounds(shape))
+	default:
+		bounds = maskBounds(shape)
+	}
+
+	combined := NewMask(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			inBase, inShape := base.Contains(x, y), shape.Contains(x, y)
+			var selected bool
+			switch op {
+			case OpAdd:
+				selected = inBase || inShape
+			case OpSubtract:
+				selected = inBase && !inShape
+			case OpIntersect:
+				selected = inBase && inShape
+			default:
+				selected = inShape
+			}
+			combined.pix[combined.offset(x, y)] = selected
+		}
+	}
+	return combined
+}
+
+// maskBounds returns the bounds of a mask, or an empty rectangle for nil
+func maskBounds(mask *Mask) image.Rectangle {
+	if mask == nil {
+		return image.Rectangle{}
+	}
+	return mask.rect
+}
@@ -0,0 +1,83 @@
+package selection
+
+import (
+	"image"
+	"slices"
+	"testing"
+)
+
+// selectedPixels lists the selected pixels of a mask in row order
+func selectedPixels(mask *Mask) []image.Point {
+	var points []image.Point
+	if mask == nil {
+		return points
+	}
+	for y := mask.rect.Min.Y; y < mask.rect.Max.Y; y++ {
+		for x := mask.rect.Min.X; x < mask.rect.Max.X; x++ {
+			if mask.Contains(x, y) {
+				points = append(points, image.Pt(x, y))
+			}
+		}
+	}
+	return points
+}
+
+// checkSelected compares the selected pixels of a mask with want
+func checkSelected(t *testing.T, name string, mask *Mask, want []image.Point) {
+	t.Helper()
+	if got := selectedPixels(mask); !slices.Equal(got, want) {
+		t.Errorf("%s selected %v, want %v", name, got, want)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	// Two overlapping one-row masks: base covers x 0-2 and shape x 2-4
+	base := Rect(image.Rect(0, 0, 3, 1))
+	shape := Rect(image.Rect(2, 0, 5, 1))
+
+	tests := []struct {
+		op   Op
+		want []image.Point
+	}{
+		{OpReplace, []image.Point{{2, 0}, {3, 0}, {4, 0}}},
+		{OpAdd, []image.Point{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}}},
+		{OpSubtract, []image.Point{{0, 0}, {1, 0}}},
+		{OpIntersect, []image.Point{{2, 0}}},
+	}
+	for _, tt := range tests {
+		checkSelected(t, tt.op.String(), Combine(base, shape, tt.op), tt.want)
+	}
+
+	// Neither input is modified
+	checkSelected(t, "base", base, []image.Point{{0, 0}, {1, 0}, {2, 0}})
+	checkSelected(t, "shape", shape, []image.Point{{2, 0}, {3, 0}, {4, 0}})
+}
+
+func TestCombineNilMasks(t *testing.T) {
+	mask := Rect(image.Rect(0, 0, 2, 1))
+	all := []image.Point{{0, 0}, {1, 0}}
+
+	tests := []struct {
+		name        string
+		base, shape *Mask
+		op          Op
+		want        []image.Point
+	}{
+		{"replace nil base", nil, mask, OpReplace, all},
+		{"replace with nil", mask, nil, OpReplace, nil},
+		{"add to nil", nil, mask, OpAdd, all},
+		{"add nil", mask, nil, OpAdd, all},
+		{"subtract from nil", nil, mask, OpSubtract, nil},
+		{"subtract nil", mask, nil, OpSubtract, all},
+		{"intersect nil", mask, nil, OpIntersect, nil},
+		{"both nil", nil, nil, OpAdd, nil},
+	}
+	for _, tt := range tests {
+		combined := Combine(tt.base, tt.shape, tt.op)
+		if combined == nil {
+			t.Errorf("%s: Combine() returned nil", tt.name)
+			continue
+		}
+		checkSelected(t, tt.name, combined, tt.want)
+	}
+}
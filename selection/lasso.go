@@ -0,0 +1,95 @@
+// Package selection provides polygon masks for the lasso selection tool.
+package selection
+
+import (
+	"image"
+	"math"
+	"slices"
+)
+
+// Polygon creates a mask selecting the pixels whose centers lie inside the
+// closed polygon through the given pixels, along with every pixel on its
+// edges, so even a thin or open lasso path selects the pixels it crosses
+func Polygon(points []image.Point) *Mask {
+	if len(points) == 0 {
+		return NewMask(image.Rectangle{})
+	}
+
+	bounds := image.Rectangle{Min: points[0], Max: points[0].Add(image.Pt(1, 1))}
+	for _, p := range points[1:] {
+		bounds = bounds.Union(image.Rectangle{Min: p, Max: p.Add(image.Pt(1, 1))})
+	}
+	mask := NewMask(bounds)
+
+	// Even-odd scanline fill; points are pixel centers, so pixel (x, y) is
+	// inside when x lies between a pair of crossings of row y
+	crossings := make([]float64, 0, len(points))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		crossings = crossings[:0]
+		for i, a := range points {
+			b := points[(i+1)%len(points)]
+			if (a.Y <= y) == (b.Y <= y) {
+				continue
+			}
+			t := float64(y-a.Y) / float64(b.Y-a.Y)
+			crossings = append(crossings, float64(a.X)+t*float64(b.X-a.X))
+		}
+		slices.Sort(crossings)
+
+		for i := 0; i+1 < len(crossings); i += 2 {
+			for x := int(math.Ceil(crossings[i])); x <= int(math.Floor(crossings[i+1])); x++ {
+				mask.Set(x, y, true)
+			}
+		}
+	}
+
+	// Include the edges themselves
+	for i, a := range points {
+		for _, p := range line(a, points[(i+1)%len(points)]) {
+			mask.Set(p.X, p.Y, true)
+		}
+	}
+	return mask
+}
+
+// line returns the pixels of a Bresenham line from a to b, both included
+func line(a, b image.Point) []image.Point {
+	dx, dy := abs(b.X-a.X), -abs(b.Y-a.Y)
+	sx, sy := sign(b.X-a.X), sign(b.Y-a.Y)
+	points := make([]image.Point, 0, max(dx, -dy)+1)
+
+	err := dx + dy
+	for p := a; ; {
+		points = append(points, p)
+		if p == b {
+			return points
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			p.X += sx
+		} else {
+			err += dx
+			p.Y += sy
+		}
+	}
+}
+
+// abs returns the absolute value of v
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// sign returns -1, 0 or 1 matching the sign of v
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,46 @@
+package selection
+
+import (
+	"image"
+	"testing"
+)
+
+func TestPolygon(t *testing.T) {
+	// A triangle with its right angle at the top left corner
+	mask := Polygon([]image.Point{{0, 0}, {3, 0}, {0, 3}})
+	want := []image.Point{
+		{0, 0}, {1, 0}, {2, 0}, {3, 0},
+		{0, 1}, {1, 1}, {2, 1},
+		{0, 2}, {1, 2},
+		{0, 3},
+	}
+	checkSelected(t, "triangle", mask, want)
+	if got := mask.Bounds(); got != image.Rect(0, 0, 4, 4) {
+		t.Errorf("Bounds() = %v, want %v", got, image.Rect(0, 0, 4, 4))
+	}
+}
+
+func TestPolygonSquare(t *testing.T) {
+	// Interior pixels are filled, not just the outline
+	mask := Polygon([]image.Point{{1, 1}, {4, 1}, {4, 4}, {1, 4}})
+	for y := 1; y <= 4; y++ {
+		for x := 1; x <= 4; x++ {
+			if !mask.Contains(x, y) {
+				t.Errorf("pixel (%d, %d) not selected", x, y)
+			}
+		}
+	}
+	if mask.Contains(0, 0) || mask.Contains(5, 5) {
+		t.Error("pixels outside the square are selected")
+	}
+}
+
+func TestPolygonOpenPath(t *testing.T) {
+	// A lasso dragged along a line still selects the pixels it crosses
+	checkSelected(t, "line", Polygon([]image.Point{{0, 0}, {3, 0}}),
+		[]image.Point{{0, 0}, {1, 0}, {2, 0}, {3, 0}})
+	checkSelected(t, "point", Polygon([]image.Point{{2, 5}}), []image.Point{{2, 5}})
+	if !Polygon(nil).IsEmpty() {
+		t.Error("Polygon(nil) selects pixels")
+	}
+}
@@ -0,0 +1,156 @@
+// Package selection provides selection masks that mark which canvas pixels
+// an edit may touch. It has no UI dependencies.
+package selection
+
+import (
+	"image"
+)
+
+// Mask marks a set of selected pixels. Pixels outside the mask's bounds are
+// never selected, and the bounds may extend past the canvas while a
+// selection is being moved.
+type Mask struct {
+	rect image.Rectangle // Area covered by pix
+	pix  []bool          // Selected flags, row by row
+}
+
+// NewMask creates a mask covering r with no pixel selected
+func NewMask(r image.Rectangle) *Mask {
+	r = r.Canon()
+	return &Mask{rect: r, pix: make([]bool, r.Dx()*r.Dy())}
+}
+
+// Rect creates a mask selecting every pixel of r
+func Rect(r image.Rectangle) *Mask {
+	mask := NewMask(r)
+	for i := range mask.pix {
+		mask.pix[i] = true
+	}
+	return mask
+}
+
+// Bounds returns the area covered by the mask. Pixels inside it are not
+// necessarily selected.
+func (mask *Mask) Bounds() image.Rectangle {
+	return mask.rect
+}
+
+// Contains returns true if the pixel at (x, y) is selected
+func (mask *Mask) Contains(x, y int) bool {
+	if mask == nil || !(image.Point{X: x, Y: y}).In(mask.rect) {
+		return false
+	}
+	return mask.pix[mask.offset(x, y)]
+}
+
+// Set selects or deselects the pixel at (x, y). Pixels outside the mask's
+// bounds are ignored.
+func (mask *Mask) Set(x, y int, selected bool) {
+	if (image.Point{X: x, Y: y}).In(mask.rect) {
+		mask.pix[mask.offset(x, y)] = selected
+	}
+}
+
+// IsEmpty returns true if no pixel is selected
+func (mask *Mask) IsEmpty() bool {
+	if mask == nil {
+		return true
+	}
+	for _, selected := range mask.pix {
+		if selected {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectedBounds returns the smallest rectangle holding every selected pixel
+func (mask *Mask) SelectedBounds() image.Rectangle {
+	var bounds image.Rectangle
+	if mask == nil {
+		return bounds
+	}
+	for y := mask.rect.Min.Y; y < mask.rect.Max.Y; y++ {
+		for x := mask.rect.Min.X; x < mask.rect.Max.X; x++ {
+			if mask.pix[mask.offset(x, y)] {
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return bounds
+}
+
+// Clone returns an independent copy of the mask
+func (mask *Mask) Clone() *Mask {
+	return &Mask{rect: mask.rect, pix: append([]bool(nil), mask.pix...)}
+}
+
+// Translate returns a copy of the mask moved by (dx, dy)
+func (mask *Mask) Translate(dx, dy int) *Mask {
+	moved := mask.Clone()
+	moved.rect = moved.rect.Add(image.Point{X: dx, Y: dy})
+	return moved
+}
+
+// Clip returns a copy of the mask with every pixel outside r deselected
+func (mask *Mask) Clip(r image.Rectangle) *Mask {
+	clipped := NewMask(mask.rect.Intersect(r))
+	for y := clipped.rect.Min.Y; y < clipped.rect.Max.Y; y++ {
+		for x := clipped.rect.Min.X; x < clipped.rect.Max.X; x++ {
+			clipped.pix[clipped.offset(x, y)] = mask.pix[mask.offset(x, y)]
+		}
+	}
+	return clipped
+}
+
+// offset returns the index of the pixel at (x, y) in pix
+func (mask *Mask) offset(x, y int) int {
+	return (y-mask.rect.Min.Y)*mask.rect.Dx() + (x - mask.rect.Min.X)
+}
+
+// Segment is a horizontal or vertical run of pixel edges, in canvas
+// coordinates where pixel (x, y) spans from (x, y) to (x+1, y+1)
+type Segment struct {
+	From, To image.Point
+}
+
+// Outline returns the edges between selected and unselected pixels, merged
+// into the longest straight runs
+func (mask *Mask) Outline() []Segment {
+	if mask == nil {
+		return nil
+	}
+
+	var segments []Segment
+	r := mask.rect
+
+	// Horizontal edges lie between row y-1 and row y
+	for y := r.Min.Y; y <= r.Max.Y; y++ {
+		start, inRun := 0, false
+		for x := r.Min.X; x <= r.Max.X; x++ {
+			edge := x < r.Max.X && mask.Contains(x, y-1) != mask.Contains(x, y)
+			if edge && !inRun {
+				start, inRun = x, true
+			} else if !edge && inRun {
+				segments = append(segments, Segment{From: image.Pt(start, y), To: image.Pt(x, y)})
+				inRun = false
+			}
+		}
+	}
+
+	// Vertical edges lie between column x-1 and column x
+	for x := r.Min.X; x <= r.Max.X; x++ {
+		start, inRun := 0, false
+		for y := r.Min.Y; y <= r.Max.Y; y++ {
+			edge := y < r.Max.Y && mask.Contains(x-1, y) != mask.Contains(x, y)
+			if edge && !inRun {
+				start, inRun = y, true
+			} else if !edge && inRun {
+				segments = append(segments, Segment{From: image.Pt(x, start), To: image.Pt(x, y)})
+				inRun = false
+			}
+		}
+	}
+
+	return segments
+}
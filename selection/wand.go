@@ -0,0 +1,65 @@
+// Package selection provides color-based masks for the magic wand tool.
+package selection
+
+import (
+	"image"
+	"image/color"
+)
+
+// Wand creates a mask selecting the pixels of img whose color is within
+// tolerance of the pixel at (x, y) on every channel, including alpha. In
+// contiguous mode only pixels connected to (x, y) through orthogonal
+// neighbours are selected; otherwise every matching pixel is.
+func Wand(img image.Image, x, y, tolerance int, contiguous bool) *Mask {
+	bounds := img.Bounds()
+	mask := NewMask(bounds)
+	if !(image.Point{X: x, Y: y}).In(bounds) {
+		return mask
+	}
+
+	target := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	matches := func(x, y int) bool {
+		c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+		return withinTolerance(target, c, tolerance)
+	}
+
+	if !contiguous {
+		for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+			for px := bounds.Min.X; px < bounds.Max.X; px++ {
+				if matches(px, py) {
+					mask.Set(px, py, true)
+				}
+			}
+		}
+		return mask
+	}
+
+	// Depth-first flood with an explicit stack so large areas never recurse
+	visited := NewMask(bounds)
+	stack := []image.Point{{X: x, Y: y}}
+	visited.Set(x, y, true)
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !matches(p.X, p.Y) {
+			continue
+		}
+		mask.Set(p.X, p.Y, true)
+
+		for _, n := range []image.Point{{X: p.X - 1, Y: p.Y}, {X: p.X + 1, Y: p.Y}, {X: p.X, Y: p.Y - 1}, {X: p.X, Y: p.Y + 1}} {
+			if n.In(bounds) && !visited.Contains(n.X, n.Y) {
+				visited.Set(n.X, n.Y, true)
+				stack = append(stack, n)
+			}
+		}
+	}
+	return mask
+}
+
+// withinTolerance returns true if no channel of a and b differs by more than tolerance
+func withinTolerance(a, b color.NRGBA, tolerance int) bool {
+	return abs(int(a.R)-int(b.R)) <= tolerance &&
+		abs(int(a.G)-int(b.G)) <= tolerance &&
+		abs(int(a.B)-int(b.B)) <= tolerance &&
+		abs(int(a.A)-int(b.A)) <= tolerance
+}
@@ -0,0 +1,56 @@
+package selection
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// wandImage returns a 4x1 image with two separated red pixels, a slightly
+// lighter red between them and a blue pixel:
+//
+//	red  blue  red+10  red
+func wandImage() *image.NRGBA {
+	red := color.NRGBA{R: 200, A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.SetNRGBA(0, 0, red)
+	img.SetNRGBA(1, 0, color.NRGBA{B: 200, A: 255})
+	img.SetNRGBA(2, 0, color.NRGBA{R: 210, A: 255})
+	img.SetNRGBA(3, 0, red)
+	return img
+}
+
+func TestWand(t *testing.T) {
+	img := wandImage()
+	tests := []struct {
+		name       string
+		x          int
+		tolerance  int
+		contiguous bool
+		want       []image.Point
+	}{
+		{"contiguous exact", 0, 0, true, []image.Point{{0, 0}}},
+		{"global exact", 0, 0, false, []image.Point{{0, 0}, {3, 0}}},
+		{"contiguous tolerant", 3, 10, true, []image.Point{{2, 0}, {3, 0}}},
+		{"contiguous too strict", 3, 9, true, []image.Point{{3, 0}}},
+		{"global tolerant", 0, 10, false, []image.Point{{0, 0}, {2, 0}, {3, 0}}},
+		{"any color", 0, 255, true, []image.Point{{0, 0}, {1, 0}, {2, 0}, {3, 0}}},
+	}
+	for _, tt := range tests {
+		checkSelected(t, tt.name, Wand(img, tt.x, 0, tt.tolerance, tt.contiguous), tt.want)
+	}
+}
+
+func TestWandAlpha(t *testing.T) {
+	// Alpha counts as a channel: transparent pixels do not match opaque ones
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 200, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 200})
+	checkSelected(t, "transparent", Wand(img, 1, 0, 0, false), []image.Point{{1, 0}})
+}
+
+func TestWandOutside(t *testing.T) {
+	if mask := Wand(wandImage(), 4, 0, 255, true); !mask.IsEmpty() {
+		t.Errorf("Wand() outside the image selected %v", selectedPixels(mask))
+	}
+}
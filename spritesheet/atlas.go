@@ -0,0 +1,156 @@
+// Package spritesheet provides the JSON atlas written alongside a sprite sheet.
+package spritesheet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// AtlasFormat selects how frames are listed in the JSON atlas
+type AtlasFormat int
+
+// Atlas format constants
+const (
+	AtlasHash  AtlasFormat = iota // "frames" is an object keyed by frame name
+	AtlasArray                    // "frames" is an array with a "filename" per frame
+)
+
+// AtlasFormats lists every atlas format in menu order
+var AtlasFormats = []AtlasFormat{AtlasHash, AtlasArray}
+
+// String returns a human-readable name for the atlas format
+func (f AtlasFormat) String() string {
+	switch f {
+	case AtlasHash:
+		return "JSON Hash"
+	case AtlasArray:
+		return "JSON Array"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the atlas format is valid
+func (f AtlasFormat) IsValid() bool {
+	return f == AtlasHash || f == AtlasArray
+}
+
+// Atlas metadata values
+const (
+	AtlasApp         = "https://github.com/carlomunguia/pel"
+	AtlasPixelFormat = "RGBA8888"
+	AtlasScale       = "1"
+)
+
+// Atlas describes where each frame is on a sprite sheet, in the JSON layout
+// shared by TexturePacker and Aseprite
+type Atlas struct {
+	Format AtlasFormat
+	Frames []Frame
+	Meta   Meta
+}
+
+// Frame is the atlas entry for one animation frame
+type Frame struct {
+	Filename         string `json:"filename,omitempty"` // Frame name (the key in hash atlases)
+	Frame            Rect   `json:"frame"`              // Area of the sheet holding the frame
+	Rotated          bool   `json:"rotated"`            // Always false, frames are never rotated
+	Trimmed          bool   `json:"trimmed"`            // True if transparent borders were removed
+	SpriteSourceSize Rect   `json:"spriteSourceSize"`   // Area of the original frame that was kept
+	SourceSize       Size   `json:"sourceSize"`         // Size of the original frame
+	Duration         int    `json:"duration"`           // Frame duration in milliseconds
+}
+
+// Meta describes the sheet image and the frame tags
+type Meta struct {
+	App       string     `json:"app"`
+	Image     string     `json:"image"`
+	Format    string     `json:"format"`
+	Size      Size       `json:"size"`
+	Scale     string     `json:"scale"`
+	FrameTags []FrameTag `json:"frameTags"`
+}
+
+// FrameTag is a named range of frames
+type FrameTag struct {
+	Name      string `json:"name"`
+	From      int    `json:"from"`
+	To        int    `json:"to"`
+	Direction string `json:"direction"`
+}
+
+// Rect is a rectangle in pixels
+type Rect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Size is a size in pixels
+type Size struct {
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// MarshalJSON encodes the atlas in its hash or array form. Hash keys keep
+// frame order, which engines use as the default animation order.
+func (atlas *Atlas) MarshalJSON() ([]byte, error) {
+	meta := atlas.Meta
+	if meta.FrameTags == nil {
+		meta.FrameTags = []FrameTag{}
+	}
+
+	if atlas.Format == AtlasArray {
+		frames := atlas.Frames
+		if frames == nil {
+			frames = []Frame{}
+		}
+		return json.Marshal(struct {
+			Frames []Frame `json:"frames"`
+			Meta   Meta    `json:"meta"`
+		}{frames, meta})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"frames":{`)
+	for i, f := range atlas.Frames {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.Filename)
+		if err != nil {
+			return nil, err
+		}
+		f.Filename = ""
+		entry, err := json.Marshal(f)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(entry)
+	}
+	buf.WriteString(`},"meta":`)
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(metaJSON)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Encode writes the atlas to w as indented JSON
+func (atlas *Atlas) Encode(w io.Writer) error {
+	data, err := json.MarshalIndent(atlas, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode atlas: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write atlas: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package spritesheet provides slicing of sprite sheet images into frames.
+package spritesheet
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+)
+
+// Order determines the order in which cells become frames
+type Order int
+
+// Order constants
+const (
+	OrderRowMajor    Order = iota // Left to right, then top to bottom
+	OrderColumnMajor              // Top to bottom, then left to right
+)
+
+// Orders lists every cell order in menu order
+var Orders = []Order{OrderRowMajor, OrderColumnMajor}
+
+// String returns a human-readable name for the order
+func (o Order) String() string {
+	switch o {
+	case OrderRowMajor:
+		return "Rows"
+	case OrderColumnMajor:
+		return "Columns"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the order is valid
+func (o Order) IsValid() bool {
+	return o == OrderRowMajor || o == OrderColumnMajor
+}
+
+// ErrNoCells is returned when no whole cell fits on the sheet
+var ErrNoCells = errors.New("no cells fit on the sheet")
+
+// SliceOptions describes the grid of cells on a sprite sheet
+type SliceOptions struct {
+	CellWidth  int   // Width of each cell in pixels
+	CellHeight int   // Height of each cell in pixels
+	Margin     int   // Pixels around the edge of the sheet before the first cell
+	Spacing    int   // Pixels between neighbouring cells
+	Order      Order // Order in which cells become frames
+	SkipEmpty  bool  // Leave out cells without any visible pixel
+}
+
+// Validate checks if the options are valid
+func (o SliceOptions) Validate() error {
+	if o.CellWidth <= 0 || o.CellHeight <= 0 {
+		return fmt.Errorf("invalid cell size: %dx%d", o.CellWidth, o.CellHeight)
+	}
+	if o.Margin < 0 {
+		return fmt.Errorf("margin cannot be negative: %d", o.Margin)
+	}
+	if o.Spacing < 0 {
+		return fmt.Errorf("spacing cannot be negative: %d", o.Spacing)
+	}
+	if !o.Order.IsValid() {
+		return fmt.Errorf("invalid order: %d", o.Order)
+	}
+	return nil
+}
+
+// Cells returns the area of every whole cell that fits within bounds, in
+// frame order. Partial cells at the right and bottom edges are left out.
+func Cells(bounds image.Rectangle, opts SliceOptions) ([]image.Rectangle, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	columns := (bounds.Dx() - 2*opts.Margin + opts.Spacing) / (opts.CellWidth + opts.Spacing)
+	rows := (bounds.Dy() - 2*opts.Margin + opts.Spacing) / (opts.CellHeight + opts.Spacing)
+	if columns <= 0 || rows <= 0 {
+		return nil, fmt.Errorf("%w: %dx%d cells on a %dx%d sheet",
+			ErrNoCells, opts.CellWidth, opts.CellHeight, bounds.Dx(), bounds.Dy())
+	}
+
+	cell := func(column, row int) image.Rectangle {
+		origin := bounds.Min.Add(image.Pt(
+			opts.Margin+column*(opts.CellWidth+opts.Spacing),
+			opts.Margin+row*(opts.CellHeight+opts.Spacing),
+		))
+		return image.Rectangle{Min: origin, Max: origin.Add(image.Pt(opts.CellWidth, opts.CellHeight))}
+	}
+
+	cells := make([]image.Rectangle, 0, columns*rows)
+	if opts.Order == OrderColumnMajor {
+		for column := 0; column < columns; column++ {
+			for row := 0; row < rows; row++ {
+				cells = append(cells, cell(column, row))
+			}
+		}
+	} else {
+		for row := 0; row < rows; row++ {
+			for column := 0; column < columns; column++ {
+				cells = append(cells, cell(column, row))
+			}
+		}
+	}
+	return cells, nil
+}
+
+// Slice cuts a sprite sheet into cells and returns them as the frames of a
+// timeline, each with a single layer and the default duration
+func Slice(img image.Image, opts SliceOptions) (*animation.Timeline, error) {
+	if img == nil {
+		return nil, fmt.Errorf("image cannot be nil")
+	}
+
+	cells, err := Cells(img.Bounds(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]*animation.Frame, 0, len(cells))
+	for _, cell := range cells {
+		l := layer.New(layer.BackgroundName, cell.Dx(), cell.Dy())
+		draw.Draw(l.Image, l.Image.Bounds(), img, cell.Min, draw.Src)
+		if opts.SkipEmpty && isEmpty(l.Image) {
+			continue
+		}
+		stack, err := layer.NewStackFromLayers([]*layer.Layer{l}, 0)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, animation.NewFrame(stack))
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("%w: every cell is empty", ErrNoCells)
+	}
+
+	return animation.NewTimelineFromFrames(frames, 0)
+}
+
+// isEmpty returns true if every pixel of img is fully transparent
+func isEmpty(img *image.NRGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,307 @@
+// Package spritesheet packs animation frames into a sprite sheet image with a
+// JSON atlas that game engines and tools such as TexturePacker, Aseprite,
+// Phaser or Godot importers can read.
+package spritesheet
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"sort"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+)
+
+// Layout determines how frames are arranged on the sheet
+type Layout int
+
+// Layout constants
+const (
+	LayoutHorizontal Layout = iota // One row, frames left to right
+	LayoutVertical                 // One column, frames top to bottom
+	LayoutGrid                     // Rows of a fixed number of columns
+	LayoutPacked                   // Trimmed, deduplicated frames packed tightly
+)
+
+// Layouts lists every layout in menu order
+var Layouts = []Layout{LayoutHorizontal, LayoutVertical, LayoutGrid, LayoutPacked}
+
+// String returns a human-readable name for the layout
+func (l Layout) String() string {
+	switch l {
+	case LayoutHorizontal:
+		return "Horizontal Strip"
+	case LayoutVertical:
+		return "Vertical Strip"
+	case LayoutGrid:
+		return "Grid"
+	case LayoutPacked:
+		return "Packed"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the layout is valid
+func (l Layout) IsValid() bool {
+	return l >= LayoutHorizontal && l <= LayoutPacked
+}
+
+// Sheet option limits
+const (
+	MaxPadding = 64 // Largest gap between sprites in pixels
+	MaxExtrude = 16 // Largest number of repeated edge pixels
+)
+
+// Options configures how a sprite sheet is built
+type Options struct {
+	Layout    Layout      // Arrangement of the frames
+	Columns   int         // Grid columns; 0 picks a near-square grid
+	Padding   int         // Transparent pixels between sprites
+	Extrude   int         // Pixels each sprite's edges are repeated outward, against bleeding when filtered
+	Format    AtlasFormat // Shape of the JSON atlas
+	Name      string      // Frame names in the atlas are "<Name> <index>"
+	ImageName string      // File name of the sheet image, stored in the atlas
+}
+
+// Validate checks if the options are valid
+func (o Options) Validate() error {
+	if !o.Layout.IsValid() {
+		return fmt.Errorf("invalid layout: %d", o.Layout)
+	}
+	if o.Columns < 0 {
+		return fmt.Errorf("columns cannot be negative: %d", o.Columns)
+	}
+	if o.Padding < 0 || o.Padding > MaxPadding {
+		return fmt.Errorf("padding must be between 0 and %d, got: %d", MaxPadding, o.Padding)
+	}
+	if o.Extrude < 0 || o.Extrude > MaxExtrude {
+		return fmt.Errorf("extrude must be between 0 and %d, got: %d", MaxExtrude, o.Extrude)
+	}
+	if !o.Format.IsValid() {
+		return fmt.Errorf("invalid atlas format: %d", o.Format)
+	}
+	return nil
+}
+
+// Sheet is a packed sprite sheet and the atlas describing it
+type Sheet struct {
+	Image *image.NRGBA
+	Atlas *Atlas
+}
+
+// sprite is one distinct image placed on the sheet
+type sprite struct {
+	img  *image.NRGBA    // Pixels placed on the sheet
+	trim image.Rectangle // Area of the source frame the pixels came from
+	pos  image.Point     // Top left of the sprite on the sheet, inside the extrusion
+}
+
+// Build packs every frame of the timeline into a sprite sheet
+func Build(timeline *animation.Timeline, opts Options) (*Sheet, error) {
+	if timeline == nil {
+		return nil, fmt.Errorf("timeline cannot be nil")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	cols, rows := timeline.Size()
+	sprites, frameSprites := collectSprites(timeline, opts.Layout == LayoutPacked)
+
+	var size image.Point
+	if opts.Layout == LayoutPacked {
+		size = packShelves(sprites, opts.Padding, opts.Extrude)
+	} else {
+		size = placeCells(sprites, cols, rows, opts)
+	}
+
+	sheet := image.NewNRGBA(image.Rectangle{Max: size})
+	for _, s := range sprites {
+		drawExtruded(sheet, s.img, s.pos, opts.Extrude)
+	}
+
+	atlas := &Atlas{
+		Format: opts.Format,
+		Meta: Meta{
+			App:    AtlasApp,
+			Image:  opts.ImageName,
+			Format: AtlasPixelFormat,
+			Size:   Size{W: size.X, H: size.Y},
+			Scale:  AtlasScale,
+		},
+	}
+	for i, f := range timeline.Frames() {
+		s := sprites[frameSprites[i]]
+		atlas.Frames = append(atlas.Frames, Frame{
+			Filename:         fmt.Sprintf("%s %d", opts.Name, i),
+			Frame:            Rect{X: s.pos.X, Y: s.pos.Y, W: s.img.Rect.Dx(), H: s.img.Rect.Dy()},
+			Trimmed:          s.trim.Dx() != cols || s.trim.Dy() != rows,
+			SpriteSourceSize: Rect{X: s.trim.Min.X, Y: s.trim.Min.Y, W: s.trim.Dx(), H: s.trim.Dy()},
+			SourceSize:       Size{W: cols, H: rows},
+			Duration:         f.Duration,
+		})
+	}
+	for _, tag := range timeline.Tags() {
+		atlas.Meta.FrameTags = append(atlas.Meta.FrameTags, FrameTag{
+			Name:      tag.Name,
+			From:      tag.From,
+			To:        tag.To,
+			Direction: tag.Direction.String(),
+		})
+	}
+
+	return &Sheet{Image: sheet, Atlas: atlas}, nil
+}
+
+// collectSprites flattens every frame into a sprite and returns, for each
+// frame, the index of its sprite. When packing, frames are trimmed to their
+// visible pixels and identical frames share one sprite.
+func collectSprites(timeline *animation.Timeline, pack bool) ([]*sprite, []int) {
+	sprites := make([]*sprite, 0, timeline.Len())
+	frameSprites := make([]int, 0, timeline.Len())
+	seen := make(map[string]int)
+
+	for _, f := range timeline.Frames() {
+		img := f.Layers.Flatten()
+		trim := img.Bounds()
+
+		if pack {
+			trim = opaqueBounds(img)
+			img = img.SubImage(trim).(*image.NRGBA)
+
+			key := spriteKey(img, trim)
+			if i, ok := seen[key]; ok {
+				frameSprites = append(frameSprites, i)
+				continue
+			}
+			seen[key] = len(sprites)
+		}
+
+		frameSprites = append(frameSprites, len(sprites))
+		sprites = append(sprites, &sprite{img: img, trim: trim})
+	}
+	return sprites, frameSprites
+}
+
+// placeCells positions sprites in equally sized cells for the strip and grid
+// layouts and returns the size of the sheet
+func placeCells(sprites []*sprite, cols, rows int, opts Options) image.Point {
+	n := len(sprites)
+	columns := n
+	switch opts.Layout {
+	case LayoutVertical:
+		columns = 1
+	case LayoutGrid:
+		columns = opts.Columns
+		if columns <= 0 {
+			columns = int(math.Ceil(math.Sqrt(float64(n))))
+		}
+		columns = min(columns, n)
+	}
+	gridRows := (n + columns - 1) / columns
+
+	cellW := cols + 2*opts.Extrude
+	cellH := rows + 2*opts.Extrude
+	for i, s := range sprites {
+		s.pos = image.Pt(
+			(i%columns)*(cellW+opts.Padding)+opts.Extrude,
+			(i/columns)*(cellH+opts.Padding)+opts.Extrude,
+		)
+	}
+
+	return image.Pt(
+		columns*cellW+(columns-1)*opts.Padding,
+		gridRows*cellH+(gridRows-1)*opts.Padding,
+	)
+}
+
+// packShelves positions sprites in rows ("shelves") filled tallest first,
+// aiming for a roughly square sheet, and returns the size of the sheet
+func packShelves(sprites []*sprite, padding, extrude int) image.Point {
+	order := make([]*sprite, len(sprites))
+	copy(order, sprites)
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].img.Rect.Dy() > order[j].img.Rect.Dy()
+	})
+
+	area, widest := 0, 0
+	for _, s := range order {
+		w := s.img.Rect.Dx() + 2*extrude + padding
+		h := s.img.Rect.Dy() + 2*extrude + padding
+		area += w * h
+		widest = max(widest, w)
+	}
+	width := max(int(math.Ceil(math.Sqrt(float64(area)))), widest)
+
+	var size image.Point
+	x, y, shelfHeight := 0, 0, 0
+	for _, s := range order {
+		w := s.img.Rect.Dx() + 2*extrude
+		h := s.img.Rect.Dy() + 2*extrude
+		if x > 0 && x+w > width {
+			x, y = 0, y+shelfHeight+padding
+			shelfHeight = 0
+		}
+
+		s.pos = image.Pt(x+extrude, y+extrude)
+		size.X = max(size.X, x+w)
+		size.Y = max(size.Y, y+h)
+
+		x += w + padding
+		shelfHeight = max(shelfHeight, h)
+	}
+	return size
+}
+
+// drawExtruded draws a sprite with its top left at pos, repeating its edge
+// pixels outward by extrude pixels
+func drawExtruded(dst, src *image.NRGBA, pos image.Point, extrude int) {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	draw.Draw(dst, image.Rect(pos.X, pos.Y, pos.X+w, pos.Y+h), src, src.Rect.Min, draw.Src)
+	if extrude == 0 {
+		return
+	}
+
+	for y := -extrude; y < h+extrude; y++ {
+		srcY := src.Rect.Min.Y + min(max(y, 0), h-1)
+		for x := -extrude; x < w+extrude; x++ {
+			if x >= 0 && x < w && y >= 0 && y < h {
+				continue
+			}
+			srcX := src.Rect.Min.X + min(max(x, 0), w-1)
+			dst.SetNRGBA(pos.X+x, pos.Y+y, src.NRGBAAt(srcX, srcY))
+		}
+	}
+}
+
+// opaqueBounds returns the smallest rectangle holding every pixel that is not
+// fully transparent. Fully transparent images keep a single pixel.
+func opaqueBounds(img *image.NRGBA) image.Rectangle {
+	bounds := img.Bounds()
+	found := image.Rectangle{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if img.NRGBAAt(x, y).A != 0 {
+				found = found.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if found.Empty() {
+		return image.Rectangle{Min: bounds.Min, Max: bounds.Min.Add(image.Pt(1, 1))}
+	}
+	return found
+}
+
+// spriteKey identifies a trimmed sprite by its position and pixels, so
+// frames that would look identical on screen share one sprite
+func spriteKey(img *image.NRGBA, trim image.Rectangle) string {
+	var key bytes.Buffer
+	fmt.Fprintf(&key, "%v;", trim)
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		start := img.PixOffset(img.Rect.Min.X, y)
+		key.Write(img.Pix[start : start+img.Rect.Dx()*4])
+	}
+	return key.String()
+}
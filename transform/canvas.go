@@ -0,0 +1,95 @@
+// Package transform provides anchored canvas resizing of pixel art.
+package transform
+
+import (
+	"image"
+)
+
+// Anchor is the part of the canvas that stays in place when it is resized
+type Anchor int
+
+// Anchor constants, in reading order of a 3 x 3 grid
+const (
+	AnchorTopLeft Anchor = iota
+	AnchorTop
+	AnchorTopRight
+	AnchorLeft
+	AnchorCenter
+	AnchorRight
+	AnchorBottomLeft
+	AnchorBottom
+	AnchorBottomRight
+)
+
+// Anchors lists every anchor in reading order of a 3 x 3 grid
+var Anchors = []Anchor{
+	AnchorTopLeft, AnchorTop, AnchorTopRight,
+	AnchorLeft, AnchorCenter, AnchorRight,
+	AnchorBottomLeft, AnchorBottom, AnchorBottomRight,
+}
+
+// String returns a human-readable name for the anchor
+func (a Anchor) String() string {
+	switch a {
+	case AnchorTopLeft:
+		return "Top Left"
+	case AnchorTop:
+		return "Top"
+	case AnchorTopRight:
+		return "Top Right"
+	case AnchorLeft:
+		return "Left"
+	case AnchorCenter:
+		return "Center"
+	case AnchorRight:
+		return "Right"
+	case AnchorBottomLeft:
+		return "Bottom Left"
+	case AnchorBottom:
+		return "Bottom"
+	case AnchorBottomRight:
+		return "Bottom Right"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the anchor is valid
+func (a Anchor) IsValid() bool {
+	return a >= AnchorTopLeft && a <= AnchorBottomRight
+}
+
+// Offset returns where the top left corner of a w x h image goes on a
+// canvas resized to nw x nh. Negative offsets crop the image.
+func (a Anchor) Offset(w, h, nw, nh int) image.Point {
+	// Column and row of the anchor in the grid: 0, 1 or 2
+	col, row := int(a)%3, int(a)/3
+	return image.Point{X: (nw - w) * col / 2, Y: (nh - h) * row / 2}
+}
+
+// Resize returns a copy of img on a canvas of nw x nh pixels starting at
+// the origin, placed by the anchor. New pixels are transparent.
+func Resize(img *image.NRGBA, nw, nh int, a Anchor) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, nw, nh))
+	offset := a.Offset(img.Rect.Dx(), img.Rect.Dy(), nw, nh)
+	r := img.Rect.Sub(img.Rect.Min).Add(offset).Intersect(dst.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		src := img.PixOffset(img.Rect.Min.X+r.Min.X-offset.X, img.Rect.Min.Y+y-offset.Y)
+		copy(dst.Pix[dst.PixOffset(r.Min.X, y):][:r.Dx()*4], img.Pix[src:][:r.Dx()*4])
+	}
+	return dst
+}
+
+// ResizePaletted returns a copy of img on a canvas of nw x nh pixels
+// starting at the origin, placed by the anchor. New pixels use palette
+// index 0.
+func ResizePaletted(img *image.Paletted, nw, nh int, a Anchor) *image.Paletted {
+	dst := image.NewPaletted(image.Rect(0, 0, nw, nh), img.Palette)
+	offset := a.Offset(img.Rect.Dx(), img.Rect.Dy(), nw, nh)
+	r := img.Rect.Sub(img.Rect.Min).Add(offset).Intersect(dst.Rect)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		src := img.PixOffset(img.Rect.Min.X+r.Min.X-offset.X, img.Rect.Min.Y+y-offset.Y)
+		copy(dst.Pix[dst.PixOffset(r.Min.X, y):][:r.Dx()], img.Pix[src:][:r.Dx()])
+	}
+	return dst
+}
@@ -0,0 +1,50 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRotSpriteAddsNoColors(t *testing.T) {
+	// A diagonal stripe and an outlined block in three colors
+	red := color.NRGBA{R: 255, A: 255}
+	green := color.NRGBA{G: 255, A: 128}
+	blue := color.NRGBA{B: 255, A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 12, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 12; x++ {
+			switch {
+			case x == y:
+				img.SetNRGBA(x, y, red)
+			case x >= 6 && y >= 4 && (x == 6 || y == 4 || x == 11 || y == 9):
+				img.SetNRGBA(x, y, blue)
+			case x >= 6 && y >= 4:
+				img.SetNRGBA(x, y, green)
+			}
+		}
+	}
+	allowed := map[color.NRGBA]bool{{}: true, red: true, green: true, blue: true}
+
+	tests := []struct {
+		degrees float64
+		expand  bool
+	}{
+		{15, false},
+		{30, true},
+		{45, true},
+		{-60, false},
+		{135, true},
+	}
+
+	for _, tt := range tests {
+		rotated := RotSprite(img, tt.degrees, tt.expand)
+		for y := rotated.Rect.Min.Y; y < rotated.Rect.Max.Y; y++ {
+			for x := rotated.Rect.Min.X; x < rotated.Rect.Max.X; x++ {
+				if c := rotated.NRGBAAt(x, y); !allowed[c] {
+					t.Fatalf("RotSprite(%v, %v) pixel (%d, %d) = %v, a new color", tt.degrees, tt.expand, x, y, c)
+				}
+			}
+		}
+	}
+}
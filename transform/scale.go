@@ -0,0 +1,206 @@
+// Package transform provides image scaling with pixel-art upscalers.
+package transform
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Filter selects how Scale resamples an image
+type Filter int
+
+// Filter constants
+const (
+	FilterNearest Filter = iota // Repeat or drop whole pixels
+	FilterEPX                   // Scale2x and Scale3x, then nearest neighbor
+	FilterXBR                   // xBR edge smoothing, then nearest neighbor
+)
+
+// Filters lists every filter in menu order
+var Filters = []Filter{FilterNearest, FilterEPX, FilterXBR}
+
+// String returns a human-readable name for the filter
+func (f Filter) String() string {
+	switch f {
+	case FilterNearest:
+		return "Nearest Neighbor"
+	case FilterEPX:
+		return "Scale2x/Scale3x (EPX)"
+	case FilterXBR:
+		return "xBR"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the filter is valid
+func (f Filter) IsValid() bool {
+	return f >= FilterNearest && f <= FilterXBR
+}
+
+// Scale returns img resampled to nw x nh pixels, starting at the origin.
+// The EPX and xBR filters first enlarge the image in steps of two or three
+// until it is at least the requested size; nearest neighbor sampling then
+// gives the exact size. Shrinking always uses nearest neighbor.
+func Scale(img *image.NRGBA, nw, nh int, filter Filter) *image.NRGBA {
+	scaled := img
+	for filter != FilterNearest {
+		w, h := scaled.Rect.Dx(), scaled.Rect.Dy()
+		if w == 0 || h == 0 {
+			break
+		}
+		need := max((nw+w-1)/w, (nh+h-1)/h)
+		if need <= 1 {
+			break
+		}
+
+		switch {
+		case filter == FilterXBR:
+			scaled = XBR2x(scaled)
+		case need%3 == 0 && need%2 != 0:
+			scaled = Scale3x(scaled)
+		default:
+			scaled = Scale2x(scaled)
+		}
+	}
+	return nearest(scaled, nw, nh)
+}
+
+// Scale3x returns img at three times its size, enlarged with the Scale3x
+// (AdvMAME3x) algorithm, the three times version of Scale2x. The result
+// starts at the origin.
+func Scale3x(img *image.NRGBA) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w*3, h*3))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a, b, c := neighbor(img, x, y, -1, -1), neighbor(img, x, y, 0, -1), neighbor(img, x, y, 1, -1)
+			d, e, f := neighbor(img, x, y, -1, 0), neighbor(img, x, y, 0, 0), neighbor(img, x, y, 1, 0)
+			g, hh, i := neighbor(img, x, y, -1, 1), neighbor(img, x, y, 0, 1), neighbor(img, x, y, 1, 1)
+
+			out := [9]color.NRGBA{e, e, e, e, e, e, e, e, e}
+			if b != hh && d != f {
+				out[0] = pick(d == b, d, e)
+				out[1] = pick(d == b && e != c || b == f && e != a, b, e)
+				out[2] = pick(b == f, f, e)
+				out[3] = pick(d == b && e != g || d == hh && e != a, d, e)
+				out[5] = pick(b == f && e != i || hh == f && e != c, f, e)
+				out[6] = pick(d == hh, d, e)
+				out[7] = pick(d == hh && e != i || hh == f && e != g, hh, e)
+				out[8] = pick(hh == f, f, e)
+			}
+			for j, c := range out {
+				dst.SetNRGBA(x*3+j%3, y*3+j/3, c)
+			}
+		}
+	}
+	return dst
+}
+
+// XBR2x returns img at twice its size, enlarged with the first level of the
+// xBR algorithm: each corner of a pixel that lies on a diagonal edge is
+// blended with the color across the edge, giving smooth outlines at the
+// cost of new in-between colors. The result starts at the origin.
+func XBR2x(img *image.NRGBA) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w*2, h*2))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			for corner := 0; corner < 4; corner++ {
+				dx, dy := corner%2, corner/2
+				dst.SetNRGBA(x*2+dx, y*2+dy, xbrCorner(img, x, y, dx*2-1, dy*2-1))
+			}
+		}
+	}
+	return dst
+}
+
+// xbrCorner returns the color of the corner of pixel (x, y) in direction
+// (sx, sy), each 1 or -1. Neighbours are named for the bottom right corner
+// and mirrored for the others:
+//
+//	.  B  C  .
+//	D  E  F  F4
+//	G  H  I  I4
+//	.  H5 I5
+func xbrCorner(img *image.NRGBA, x, y, sx, sy int) color.NRGBA {
+	p := func(u, v int) color.NRGBA {
+		return neighbor(img, x, y, u*sx, v*sy)
+	}
+	e := p(0, 0)
+	b, c := p(0, -1), p(1, -1)
+	d, f, f4 := p(-1, 0), p(1, 0), p(2, 0)
+	g, hh, i, i4 := p(-1, 1), p(0, 1), p(1, 1), p(2, 1)
+	h5, i5 := p(0, 2), p(1, 2)
+
+	if e == f || e == hh {
+		return e
+	}
+
+	// An edge runs between F and H when colors change less along it than across it
+	along := colorDistance(e, c) + colorDistance(e, g) + colorDistance(i, f4) + colorDistance(i, h5) + 4*colorDistance(hh, f)
+	across := colorDistance(hh, d) + colorDistance(hh, i5) + colorDistance(f, i4) + colorDistance(f, b) + 4*colorDistance(e, i)
+	if along >= across {
+		return e
+	}
+
+	if colorDistance(e, f) <= colorDistance(e, hh) {
+		return blend(e, f)
+	}
+	return blend(e, hh)
+}
+
+// colorDistance returns how different two colors look, weighting the YUV
+// components as xBR does and counting alpha like brightness
+func colorDistance(a, b color.NRGBA) float64 {
+	dr := float64(a.R) - float64(b.R)
+	dg := float64(a.G) - float64(b.G)
+	db := float64(a.B) - float64(b.B)
+	y := 0.299*dr + 0.587*dg + 0.114*db
+	u := -0.169*dr - 0.331*dg + 0.5*db
+	v := 0.5*dr - 0.419*dg - 0.081*db
+	alpha := float64(a.A) - float64(b.A)
+	return 48*math.Abs(y) + 7*math.Abs(u) + 6*math.Abs(v) + 48*math.Abs(alpha)
+}
+
+// blend returns the even mix of two colors, weighting each by its alpha
+func blend(a, b color.NRGBA) color.NRGBA {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	mixed := color.RGBA64{
+		R: uint16((ar + br) / 2),
+		G: uint16((ag + bg) / 2),
+		B: uint16((ab + bb) / 2),
+		A: uint16((aa + ba) / 2),
+	}
+	return color.NRGBAModel.Convert(mixed).(color.NRGBA)
+}
+
+// pick returns a if cond holds and b otherwise
+func pick(cond bool, a, b color.NRGBA) color.NRGBA {
+	if cond {
+		return a
+	}
+	return b
+}
+
+// nearest returns img resampled to nw x nh pixels with nearest neighbor
+// sampling, starting at the origin
+func nearest(img *image.NRGBA, nw, nh int) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, nw, nh))
+	if w == 0 || h == 0 {
+		return dst
+	}
+
+	// Each destination pixel takes the source pixel under its center
+	for y := 0; y < nh; y++ {
+		sy := img.Rect.Min.Y + (y*2+1)*h/(nh*2)
+		for x := 0; x < nw; x++ {
+			sx := img.Rect.Min.X + (x*2+1)*w/(nw*2)
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], img.Pix[img.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,109 @@
+// Package transform provides lossless flips and quarter turns of pixel art.
+// It has no UI dependencies so it can be used by the canvas and tools alike.
+package transform
+
+import (
+	"image"
+)
+
+// Orientation is a lossless flip or quarter turn of an image
+type Orientation int
+
+// Orientation constants
+const (
+	FlipHorizontal Orientation = iota // Mirror left to right
+	FlipVertical                      // Mirror top to bottom
+	Rotate90                          // Quarter turn clockwise
+	Rotate180                         // Half turn
+	Rotate270                         // Quarter turn counterclockwise
+)
+
+// Orientations lists every orientation in menu order
+var Orientations = []Orientation{FlipHorizontal, FlipVertical, Rotate90, Rotate180, Rotate270}
+
+// String returns a human-readable name for the orientation
+func (o Orientation) String() string {
+	switch o {
+	case FlipHorizontal:
+		return "Flip Horizontal"
+	case FlipVertical:
+		return "Flip Vertical"
+	case Rotate90:
+		return "Rotate 90° Clockwise"
+	case Rotate180:
+		return "Rotate 180°"
+	case Rotate270:
+		return "Rotate 90° Counterclockwise"
+	default:
+		return "Unknown"
+	}
+}
+
+// IsValid checks if the orientation is valid
+func (o Orientation) IsValid() bool {
+	return o >= FlipHorizontal && o <= Rotate270
+}
+
+// SwapsSize reports whether the orientation exchanges width and height
+func (o Orientation) SwapsSize() bool {
+	return o == Rotate90 || o == Rotate270
+}
+
+// Size returns the size of a w x h image after the orientation
+func (o Orientation) Size(w, h int) (int, int) {
+	if o.SwapsSize() {
+		return h, w
+	}
+	return w, h
+}
+
+// Source returns the pixel of a w x h image that ends up at (x, y) after
+// the orientation. Both points are relative to the top left corner.
+func (o Orientation) Source(x, y, w, h int) (int, int) {
+	switch o {
+	case FlipHorizontal:
+		return w - 1 - x, y
+	case FlipVertical:
+		return x, h - 1 - y
+	case Rotate90:
+		return y, h - 1 - x
+	case Rotate180:
+		return w - 1 - x, h - 1 - y
+	case Rotate270:
+		return w - 1 - y, x
+	default:
+		return x, y
+	}
+}
+
+// Orient returns a copy of img flipped or turned by o, with the same top
+// left corner
+func Orient(img *image.NRGBA, o Orientation) *image.NRGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	nw, nh := o.Size(w, h)
+	dst := image.NewNRGBA(image.Rectangle{Min: img.Rect.Min, Max: img.Rect.Min.Add(image.Point{X: nw, Y: nh})})
+	for y := 0; y < nh; y++ {
+		for x := 0; x < nw; x++ {
+			sx, sy := o.Source(x, y, w, h)
+			copy(dst.Pix[dst.PixOffset(dst.Rect.Min.X+x, dst.Rect.Min.Y+y):][:4],
+				img.Pix[img.PixOffset(img.Rect.Min.X+sx, img.Rect.Min.Y+sy):][:4])
+		}
+	}
+	return dst
+}
+
+// OrientPaletted returns a copy of img flipped or turned by o, with the same
+// top left corner and palette
+func OrientPaletted(img *image.Paletted, o Orientation) *image.Paletted {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	nw, nh := o.Size(w, h)
+	dst := image.NewPaletted(image.Rectangle{Min: img.Rect.Min, Max: img.Rect.Min.Add(image.Point{X: nw, Y: nh})}, img.Palette)
+	for y := 0; y < nh; y++ {
+		for x := 0; x < nw; x++ {
+			sx, sy := o.Source(x, y, w, h)
+			dst.Pix[dst.PixOffset(dst.Rect.Min.X+x, dst.Rect.Min.Y+y)] =
+				img.Pix[img.PixOffset(img.Rect.Min.X+sx, img.Rect.Min.Y+sy)]
+		}
+	}
+	return dst
+}
@@ -0,0 +1,80 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testImage returns a w x h image whose pixels all have different colors
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+func TestOrientLossless(t *testing.T) {
+	tests := []struct {
+		name   string
+		orient []Orientation
+	}{
+		{"flip horizontal twice", []Orientation{FlipHorizontal, FlipHorizontal}},
+		{"flip vertical twice", []Orientation{FlipVertical, FlipVertical}},
+		{"rotate 90 and back", []Orientation{Rotate90, Rotate270}},
+		{"rotate 270 and back", []Orientation{Rotate270, Rotate90}},
+		{"rotate 180 twice", []Orientation{Rotate180, Rotate180}},
+		{"rotate 90 four times", []Orientation{Rotate90, Rotate90, Rotate90, Rotate90}},
+		{"both flips are a half turn", []Orientation{FlipHorizontal, FlipVertical, Rotate180}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := testImage(5, 3)
+			img := src
+			for _, o := range tt.orient {
+				img = Orient(img, o)
+			}
+			if img.Rect != src.Rect {
+				t.Fatalf("bounds = %v, want %v", img.Rect, src.Rect)
+			}
+			for y := 0; y < 3; y++ {
+				for x := 0; x < 5; x++ {
+					if got, want := img.NRGBAAt(x, y), src.NRGBAAt(x, y); got != want {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestOrientMovesPixels(t *testing.T) {
+	tests := []struct {
+		orient Orientation
+		size   image.Point
+		x, y   int // Where the top left pixel of the 5x3 image ends up
+	}{
+		{FlipHorizontal, image.Pt(5, 3), 4, 0},
+		{FlipVertical, image.Pt(5, 3), 0, 2},
+		{Rotate90, image.Pt(3, 5), 2, 0},
+		{Rotate180, image.Pt(5, 3), 4, 2},
+		{Rotate270, image.Pt(3, 5), 0, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.orient.String(), func(t *testing.T) {
+			src := testImage(5, 3)
+			img := Orient(src, tt.orient)
+			if img.Rect.Size() != tt.size {
+				t.Fatalf("size = %v, want %v", img.Rect.Size(), tt.size)
+			}
+			if got, want := img.NRGBAAt(tt.x, tt.y), src.NRGBAAt(0, 0); got != want {
+				t.Errorf("pixel (%d, %d) = %v, want %v", tt.x, tt.y, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Package ui provides system clipboard exchange for the Pel pixel art editor.
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"github.com/carlomunguia/pel/util"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/storage"
+	"golang.design/x/clipboard"
+)
+
+// MaxClipboardColors is the largest number of colors copied as a hex list
+const MaxClipboardColors = 256
+
+// Clipboard errors
+var (
+	ErrNoClipboardImage = errors.New("the clipboard holds no image")
+	errOwnClipboard     = errors.New("the clipboard holds pixels copied in Pel")
+)
+
+// clipboardImageExtensions lists the image files that can be pasted by path
+var clipboardImageExtensions = []string{PNGExtension, GIFExtension}
+
+// imageClipboard reports whether the system clipboard can hold images. The
+// native clipboard is set up on first use; without it, as in browsers or
+// builds without cgo, only text can be exchanged through Fyne.
+var imageClipboard = sync.OnceValue(func() bool {
+	if err := clipboard.Init(); err != nil {
+		log.Printf("Warning: Image clipboard unavailable: %v", err)
+		return false
+	}
+	return true
+})
+
+// writeSystemClipboard puts the hex colors of an image on the system
+// clipboard as text through Fyne, then the image itself as a PNG through the
+// native clipboard, as Fyne's clipboard only holds text. Where the system
+// clipboard keeps a single item per copy the image replaces the text.
+func writeSystemClipboard(app *AppInit, img image.Image) {
+	if img == nil {
+		return
+	}
+	if err := writeHexColors(img); err != nil {
+		log.Printf("Warning: Failed to copy colors to the system clipboard: %v", err)
+	}
+	if !imageClipboard() {
+		return
+	}
+
+	var data bytes.Buffer
+	if err := png.Encode(&data, img); err != nil {
+		log.Printf("Warning: Failed to copy to the system clipboard: %v", err)
+		return
+	}
+	clipboard.Write(clipboard.FmtImage, data.Bytes())
+	app.copiedImage = data.Bytes()
+}
+
+// writeHexColors puts the colors used by an image on the system clipboard
+// as text, one hex color per line
+func writeHexColors(img image.Image) error {
+	if fyne.CurrentApp() == nil {
+		return fmt.Errorf("no clipboard available")
+	}
+
+	colors := hexColors(img)
+	if colors == nil {
+		return fmt.Errorf("more than %d colors to copy", MaxClipboardColors)
+	}
+	fyne.CurrentApp().Clipboard().SetContent(strings.Join(colors, "\n"))
+	return nil
+}
+
+// readSystemClipboard returns the image on the system clipboard, or the
+// image file whose path or file URI is on it as text. It returns
+// errOwnClipboard when the clipboard still holds what Pel last copied, so
+// the internal clipboard can paste it at its original position, and
+// ErrNoClipboardImage when there is no image to paste.
+func readSystemClipboard(app *AppInit) (image.Image, error) {
+	if imageClipboard() {
+		if data := clipboard.Read(clipboard.FmtImage); len(data) > 0 {
+			if bytes.Equal(data, app.copiedImage) {
+				return nil, errOwnClipboard
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				log.Printf("Warning: Failed to decode clipboard image: %v", err)
+				return nil, ErrNoClipboardImage
+			}
+			return img, nil
+		}
+	}
+
+	if fyne.CurrentApp() == nil {
+		return nil, ErrNoClipboardImage
+	}
+	return imageFromPath(fyne.CurrentApp().Clipboard().Content())
+}
+
+// imageFromPath returns the image file named by clipboard text holding a
+// single absolute path or file URI with an image extension. Anything else,
+// or a file that cannot be decoded, gives ErrNoClipboardImage.
+func imageFromPath(text string) (image.Image, error) {
+	path := strings.TrimSpace(text)
+	if uri, err := storage.ParseURI(path); err == nil && uri.Scheme() == "file" {
+		path = uri.Path()
+	}
+	if strings.Contains(path, "\n") || !filepath.IsAbs(path) ||
+		!slices.Contains(clipboardImageExtensions, strings.ToLower(filepath.Ext(path))) {
+		return nil, ErrNoClipboardImage
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Warning: Failed to open pasted path: %v", err)
+		return nil, ErrNoClipboardImage
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		log.Printf("Warning: Failed to decode %s: %v", filepath.Base(path), err)
+		return nil, ErrNoClipboardImage
+	}
+	return img, nil
+}
+
+// hexColors returns the visible colors of an image in the order they first
+// appear, or nil if there are more than MaxClipboardColors
+func hexColors(img image.Image) []string {
+	bounds := img.Bounds()
+	seen := make(map[string]bool)
+	var colors []string
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.At(x, y)
+			if _, _, _, a := c.RGBA(); a == 0 {
+				continue
+			}
+
+			hex := util.ColorToHex(c)
+			if seen[hex] {
+				continue
+			}
+			if len(colors) == MaxClipboardColors {
+				return nil
+			}
+			seen[hex] = true
+			colors = append(colors, hex)
+		}
+	}
+	return colors
+}
+
+// pasteImage pastes an image from another application as a floating
+// selection, or opens it as a new drawing when it is larger than the canvas
+func pasteImage(app *AppInit, img image.Image) error {
+	size := img.Bounds().Size()
+	cols, rows := app.PelCanvas.GetCanvasSize()
+	if size.X <= cols && size.Y <= rows {
+		return app.PelCanvas.PasteImage(img)
+	}
+
+	if size.X > MaxImageSize || size.Y > MaxImageSize {
+		return fmt.Errorf("pasted image is %dx%d, larger than %dx%d",
+			size.X, size.Y, MaxImageSize, MaxImageSize)
+	}
+	if err := app.PelCanvas.LoadImage(img); err != nil {
+		return fmt.Errorf("failed to load image: %w", err)
+	}
+	app.State.SetFilePath("")
+	updateSwatchesFromImage(app, img)
+
+	log.Printf("Pasted %dx%d image as a new drawing", size.X, size.Y)
+	return nil
+}
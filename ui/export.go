@@ -0,0 +1,312 @@
+// Package ui provides animation and sprite sheet export and import for the Pel pixel art editor.
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+	"github.com/carlomunguia/pel/spritesheet"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Export file extensions
+const (
+	GIFExtension  = ".gif"
+	PNGExtension  = ".png"
+	JSONExtension = ".json" // Sprite sheet atlas
+)
+
+// isGIFPath returns true if the path names a GIF file
+func isGIFPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), GIFExtension)
+}
+
+// openGIF decodes an animated GIF into frames and loads them into the canvas.
+// A GIF holding a single full-size image is opened in indexed color mode.
+func openGIF(app *AppInit, r io.Reader, path string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if g, err := gif.DecodeAll(bytes.NewReader(data)); err == nil && len(g.Image) == 1 &&
+		g.Image[0].Rect == image.Rect(0, 0, g.Config.Width, g.Config.Height) {
+		if err := app.PelCanvas.LoadImage(g.Image[0]); err != nil {
+			return fmt.Errorf("failed to load image: %w", err)
+		}
+		app.State.SetFilePath(path)
+
+		log.Printf("Opened GIF: %s (indexed, %d colors)", path, len(app.PelCanvas.Palette())-1)
+		dialog.ShowInformation("Success",
+			fmt.Sprintf("Loaded: %s\nSize: %dx%d", filepath.Base(path), g.Config.Width, g.Config.Height),
+			app.PelWindow)
+		return nil
+	}
+
+	timeline, err := animation.DecodeGIF(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	if err := app.PelCanvas.LoadAnimation(timeline); err != nil {
+		return fmt.Errorf("failed to load frames: %w", err)
+	}
+	app.State.SetFilePath(path)
+
+	// Extract colors from the first frame
+	updateSwatchesFromImage(app, timeline.Frame(0).Layers.Flatten())
+
+	cols, rows := timeline.Size()
+	log.Printf("Opened GIF: %s (%d frames)", path, timeline.Len())
+	dialog.ShowInformation("Success",
+		fmt.Sprintf("Loaded: %s\nSize: %dx%d\nFrames: %d",
+			filepath.Base(path), cols, rows, timeline.Len()),
+		app.PelWindow)
+	return nil
+}
+
+// showGIFExportDialog asks for the GIF loop count, then for the file to write
+func showGIFExportDialog(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	loopsEntry := widget.NewEntry()
+	loopsEntry.SetText(strconv.Itoa(animation.GIFLoopForever))
+	loopsEntry.Validator = func(s string) error {
+		loops, err := strconv.Atoi(s)
+		if err != nil || loops < 0 {
+			return errors.New("loop count must be zero or a positive integer")
+		}
+		return nil
+	}
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Loops", loopsEntry),
+	}
+	formItems[0].HintText = "Times the animation plays, 0 to loop forever"
+
+	dialog.ShowForm("Export Animated GIF", "Export", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := loopsEntry.Validate(); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+			return
+		}
+
+		loops, _ := strconv.Atoi(loopsEntry.Text)
+		showExportFileDialog(app, GIFExtension, func(w io.Writer) error {
+			app.PelCanvas.CommitSelection()
+			return animation.EncodeGIF(w, app.PelCanvas.Timeline(), animation.GIFOptions{Loops: loops})
+		})
+	}, app.PelWindow)
+}
+
+// showExportFileDialog asks for a file with the given extension and writes
+// the export to it. The current file path is left unchanged.
+func showExportFileDialog(app *AppInit, extension string, export func(w io.Writer) error) {
+	saveDialog := dialog.NewFileSave(func(uri fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to export file: %w", err), app.PelWindow)
+			return
+		}
+		if uri == nil {
+			return
+		}
+		defer uri.Close()
+
+		if err := export(uri); err != nil {
+			dialog.ShowError(fmt.Errorf("export failed: %w", err), app.PelWindow)
+			return
+		}
+
+		log.Printf("Exported to: %s", uri.URI().Path())
+		dialog.ShowInformation("Success",
+			fmt.Sprintf("Exported: %s", filepath.Base(uri.URI().Path())),
+			app.PelWindow)
+	}, app.PelWindow)
+
+	saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{extension}))
+	saveDialog.SetFileName(exportFileName(app, extension))
+	saveDialog.Show()
+}
+
+// exportFileName suggests a file name for an export based on the current file
+func exportFileName(app *AppInit, extension string) string {
+	name := "untitled"
+	if app.State.FilePath != "" {
+		base := filepath.Base(app.State.FilePath)
+		name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return name + extension
+}
+
+// showSpriteSheetExportDialog asks for the sheet layout and atlas format,
+// then for the PNG file to write. The JSON atlas is written next to it with
+// the same name.
+func showSpriteSheetExportDialog(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	layoutNames := make([]string, len(spritesheet.Layouts))
+	for i, layout := range spritesheet.Layouts {
+		layoutNames[i] = layout.String()
+	}
+	formatNames := make([]string, len(spritesheet.AtlasFormats))
+	for i, format := range spritesheet.AtlasFormats {
+		formatNames[i] = format.String()
+	}
+
+	columnsEntry := widget.NewEntry()
+	columnsEntry.SetText("0")
+	columnsEntry.Validator = rangeValidator("columns", 0, MaxImageSize)
+	columnsEntry.Disable()
+
+	layoutSelect := widget.NewSelect(layoutNames, func(selected string) {
+		if selected == spritesheet.LayoutGrid.String() {
+			columnsEntry.Enable()
+		} else {
+			columnsEntry.Disable()
+		}
+	})
+	layoutSelect.SetSelectedIndex(int(spritesheet.LayoutHorizontal))
+
+	paddingEntry := widget.NewEntry()
+	paddingEntry.SetText("0")
+	paddingEntry.Validator = rangeValidator("padding", 0, spritesheet.MaxPadding)
+
+	extrudeEntry := widget.NewEntry()
+	extrudeEntry.SetText("0")
+	extrudeEntry.Validator = rangeValidator("extrude", 0, spritesheet.MaxExtrude)
+
+	formatSelect := widget.NewSelect(formatNames, nil)
+	formatSelect.SetSelectedIndex(int(spritesheet.AtlasHash))
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Layout", layoutSelect),
+		widget.NewFormItem("Columns", columnsEntry),
+		widget.NewFormItem("Padding", paddingEntry),
+		widget.NewFormItem("Extrude", extrudeEntry),
+		widget.NewFormItem("Atlas", formatSelect),
+	}
+	formItems[1].HintText = "Grid only, 0 for a square grid"
+	formItems[3].HintText = "Repeat edge pixels outward"
+
+	dialog.ShowForm("Export Sprite Sheet", "Export", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+		for _, entry := range []*widget.Entry{columnsEntry, paddingEntry, extrudeEntry} {
+			if err := entry.Validate(); err != nil {
+				dialog.ShowError(err, app.PelWindow)
+				return
+			}
+		}
+
+		columns, _ := strconv.Atoi(columnsEntry.Text)
+		padding, _ := strconv.Atoi(paddingEntry.Text)
+		extrude, _ := strconv.Atoi(extrudeEntry.Text)
+		opts := spritesheet.Options{
+			Layout:  spritesheet.Layouts[layoutSelect.SelectedIndex()],
+			Columns: columns,
+			Padding: padding,
+			Extrude: extrude,
+			Format:  spritesheet.AtlasFormats[formatSelect.SelectedIndex()],
+		}
+
+		showSpriteSheetFileDialog(app, opts)
+	}, app.PelWindow)
+}
+
+// showSpriteSheetFileDialog asks for the sheet image file, then writes the
+// sheet and its atlas
+func showSpriteSheetFileDialog(app *AppInit, opts spritesheet.Options) {
+	saveDialog := dialog.NewFileSave(func(uri fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to export file: %w", err), app.PelWindow)
+			return
+		}
+		if uri == nil {
+			return
+		}
+		defer uri.Close()
+
+		atlasURI, err := writeSpriteSheet(app, uri, opts)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("export failed: %w", err), app.PelWindow)
+			return
+		}
+
+		log.Printf("Exported sprite sheet to: %s", uri.URI().Path())
+		dialog.ShowInformation("Success",
+			fmt.Sprintf("Exported: %s\nAtlas: %s", uri.URI().Name(), atlasURI.Name()),
+			app.PelWindow)
+	}, app.PelWindow)
+
+	saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{PNGExtension}))
+	saveDialog.SetFileName(exportFileName(app, PNGExtension))
+	saveDialog.Show()
+}
+
+// writeSpriteSheet builds the sheet, writes its image to w and its atlas to a
+// JSON file next to the image. Returns the location of the atlas.
+func writeSpriteSheet(app *AppInit, w fyne.URIWriteCloser, opts spritesheet.Options) (fyne.URI, error) {
+	imageName := w.URI().Name()
+	baseName := strings.TrimSuffix(imageName, filepath.Ext(imageName))
+	opts.Name = baseName
+	opts.ImageName = imageName
+
+	app.PelCanvas.CommitSelection()
+	sheet, err := spritesheet.Build(app.PelCanvas.Timeline(), opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := png.Encode(w, sheet.Image); err != nil {
+		return nil, fmt.Errorf("failed to encode sheet: %w", err)
+	}
+
+	parent, err := storage.Parent(w.URI())
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate atlas: %w", err)
+	}
+	atlasURI, err := storage.Child(parent, baseName+JSONExtension)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate atlas: %w", err)
+	}
+	atlasWriter, err := storage.Writer(atlasURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create atlas: %w", err)
+	}
+	defer atlasWriter.Close()
+
+	if err := sheet.Atlas.Encode(atlasWriter); err != nil {
+		return nil, err
+	}
+	return atlasURI, nil
+}
+
+// rangeValidator returns an entry validator accepting integers from lo to hi
+func rangeValidator(name string, lo, hi int) fyne.StringValidator {
+	return func(s string) error {
+		value, err := strconv.Atoi(s)
+		if err != nil || value < lo || value > hi {
+			return fmt.Errorf("%s must be an integer between %d and %d", name, lo, hi)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+// Package ui provides the history panel for the Pel pixel art editor.
+package ui
+
+import (
+	"image/color"
+	"log"
+	"github.com/carlomunguia/pel/pelcanvas"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// History panel constants
+const (
+	HistoryPanelWidth      = 180  // Minimum width of the history panel in pixels
+	HistoryThumbnailSize   = 32   // Size of each thumbnail in the history list
+	HistoryBranchIndent    = 12   // Indentation per alternate branch level in pixels
+	HistoryAlternatePrefix = "↳ " // Marks states on alternate branches
+)
+
+// BuildHistoryPanel creates the history panel listing every canvas state.
+// Selecting an entry jumps to that state, including states on alternate branches.
+func BuildHistoryPanel(app *AppInit) fyne.CanvasObject {
+	if app == nil || app.PelCanvas == nil {
+		log.Println("Warning: Cannot build history panel - app or canvas is nil")
+		return container.NewVBox()
+	}
+
+	entries := app.PelCanvas.History().Entries()
+
+	list := widget.NewList(
+		func() int {
+			return len(entries)
+		},
+		createHistoryRow,
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id >= 0 && id < len(entries) {
+				updateHistoryRow(entries[id], obj)
+			}
+		},
+	)
+
+	list.OnSelected = func(id widget.ListItemID) {
+		list.UnselectAll()
+		if id < 0 || id >= len(entries) {
+			return
+		}
+
+		if err := app.PelCanvas.JumpTo(entries[id].Node); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}
+
+	// Rebuild the list whenever the history changes
+	app.PelCanvas.AddHistoryListener(func() {
+		entries = app.PelCanvas.History().Entries()
+		list.Refresh()
+
+		for i, entry := range entries {
+			if entry.State == pelcanvas.HistoryEntryCurrent {
+				list.ScrollTo(i)
+				break
+			}
+		}
+	})
+
+	title := widget.NewLabelWithStyle("History",
+		fyne.TextAlignCenter,
+		fyne.TextStyle{Bold: true})
+
+	// Keep the panel from collapsing to the width of its narrowest entry
+	spacer := canvas.NewRectangle(color.Transparent)
+	spacer.SetMinSize(fyne.NewSize(HistoryPanelWidth, 0))
+
+	return container.NewStack(spacer, container.NewBorder(title, nil, nil, nil, list))
+}
+
+// createHistoryRow creates the template row for a history entry:
+// a branch indent, a thumbnail and the action name
+func createHistoryRow() fyne.CanvasObject {
+	indent := canvas.NewRectangle(color.Transparent)
+
+	thumbnail := canvas.NewImageFromImage(nil)
+	thumbnail.ScaleMode = canvas.ImageScalePixels
+	thumbnail.FillMode = canvas.ImageFillContain
+	thumbnail.SetMinSize(fyne.NewSize(HistoryThumbnailSize, HistoryThumbnailSize))
+
+	label := widget.NewLabel("")
+
+	return container.NewHBox(indent, thumbnail, label)
+}
+
+// updateHistoryRow fills a history row with the details of an entry
+func updateHistoryRow(entry pelcanvas.HistoryEntry, obj fyne.CanvasObject) {
+	row, ok := obj.(*fyne.Container)
+	if !ok || len(row.Objects) < 3 {
+		return
+	}
+
+	indent := row.Objects[0].(*canvas.Rectangle)
+	thumbnail := row.Objects[1].(*canvas.Image)
+	label := row.Objects[2].(*widget.Label)
+
+	indent.SetMinSize(fyne.NewSize(float32(entry.Depth*HistoryBranchIndent), 0))
+
+	thumbnail.Image = entry.Node.Thumbnail()
+	thumbnail.Refresh()
+
+	text := entry.Node.Name()
+	if entry.State == pelcanvas.HistoryEntryAlternate && entry.Node.Parent() != nil {
+		text = HistoryAlternatePrefix + text
+	}
+
+	label.TextStyle = fyne.TextStyle{Bold: entry.State == pelcanvas.HistoryEntryCurrent}
+	switch entry.State {
+	case pelcanvas.HistoryEntryUndone, pelcanvas.HistoryEntryAlternate:
+		label.Importance = widget.LowImportance
+	default:
+		label.Importance = widget.MediumImportance
+	}
+	label.SetText(text)
+
+	row.Refresh()
+}
@@ -0,0 +1,309 @@
+// Package ui provides the Image menu of whole-drawing operations and transforms for the Pel pixel art editor.
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"strconv"
+	"github.com/carlomunguia/pel/dither"
+	"github.com/carlomunguia/pel/palette"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+	"github.com/carlomunguia/pel/transform"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Image menu defaults and limits
+const (
+	DefaultGeneratedColors = 16  // Colors suggested when generating a palette
+	DefaultRotateAngle     = 45  // Angle suggested by the Rotate dialog, in degrees
+	MaxRotateAngle         = 360 // Largest angle accepted by the Rotate dialog, either way
+)
+
+// BuildImageMenu constructs the Image menu for operations on the whole drawing
+func BuildImageMenu(app *AppInit) *fyne.Menu {
+	return fyne.NewMenu("Image",
+		fyne.NewMenuItem("Generate Palette...", func() {
+			showGeneratePaletteDialog(app)
+		}),
+		fyne.NewMenuItem("Reduce to Palette...", func() {
+			showReduceToPaletteDialog(app)
+		}),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Canvas Size...", func() {
+			showCanvasSizeDialog(app)
+		}),
+		fyne.NewMenuItem("Image Size...", func() {
+			showImageSizeDialog(app)
+		}),
+		buildTransformMenu(app, false),
+		buildFiltersMenu(app),
+	)
+}
+
+// buildTransformMenu constructs the Transform submenu of flips and
+// rotations, acting on the selection or on the whole drawing
+func buildTransformMenu(app *AppInit, onSelection bool) *fyne.MenuItem {
+	menu := fyne.NewMenu("Transform")
+	for _, o := range transform.Orientations {
+		menu.Items = append(menu.Items, fyne.NewMenuItem(o.String(), func() {
+			orient(app, o, onSelection)
+		}))
+	}
+	menu.Items = append(menu.Items,
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Rotate...", func() {
+			showRotateDialog(app, onSelection)
+		}),
+	)
+
+	item := fyne.NewMenuItem("Transform", nil)
+	item.ChildMenu = menu
+	return item
+}
+
+// orient flips or turns the selection or the whole drawing
+func orient(app *AppInit, o transform.Orientation, onSelection bool) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	var err error
+	if onSelection {
+		if !app.PelCanvas.HasSelection() {
+			return
+		}
+		err = app.PelCanvas.OrientSelection(o)
+	} else {
+		err = app.PelCanvas.OrientImage(o)
+	}
+	if err != nil {
+		dialog.ShowError(err, app.PelWindow)
+	}
+}
+
+// showRotateDialog asks for an angle, then rotates the selection or the
+// whole drawing clockwise by it
+func showRotateDialog(app *AppInit, onSelection bool) {
+	if app == nil || app.PelCanvas == nil || (onSelection && !app.PelCanvas.HasSelection()) {
+		return
+	}
+
+	angleEntry := widget.NewEntry()
+	angleEntry.SetText(strconv.Itoa(DefaultRotateAngle))
+	angleEntry.Validator = rangeValidator("angle", -MaxRotateAngle, MaxRotateAngle)
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Angle (°)", angleEntry),
+	}
+	formItems[0].HintText = "Clockwise; multiples of 90 are lossless, other angles use RotSprite"
+
+	title := "Rotate Image"
+	if onSelection {
+		title = "Rotate Selection"
+	}
+	dialog.ShowForm(title, "Rotate", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		angle, _ := strconv.Atoi(angleEntry.Text)
+		var err error
+		if onSelection {
+			err = app.PelCanvas.RotateSelection(float64(angle))
+		} else {
+			err = app.PelCanvas.RotateImage(float64(angle))
+		}
+		if err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}, app.PelWindow)
+}
+
+// buildFiltersMenu constructs the Filters submenu of the Image menu
+func buildFiltersMenu(app *AppInit) *fyne.MenuItem {
+	filters := fyne.NewMenuItem("Filters", nil)
+	filters.ChildMenu = fyne.NewMenu("Filters",
+		fyne.NewMenuItem("Dither...", func() {
+			showDitherDialog(app)
+		}),
+	)
+	return filters
+}
+
+// showDitherDialog asks for the dithering method, strength and color
+// distance metric, then dithers the active layer to the current palette
+func showDitherDialog(app *AppInit) {
+	if app == nil || app.PelCanvas == nil || len(app.Swatches) == 0 {
+		return
+	}
+
+	defaults := dither.DefaultOptions()
+
+	methodNames := make([]string, len(dither.Methods))
+	for i, method := range dither.Methods {
+		methodNames[i] = method.String()
+	}
+	methodSelect := widget.NewSelect(methodNames, nil)
+	methodSelect.SetSelectedIndex(int(defaults.Method))
+
+	strengthEntry := widget.NewEntry()
+	strengthEntry.SetText(strconv.Itoa(int(defaults.Strength * 100)))
+	strengthEntry.Validator = rangeValidator("strength", int(dither.MinStrength*100), int(dither.MaxStrength*100))
+
+	metricNames := make([]string, len(palette.Metrics))
+	for i, metric := range palette.Metrics {
+		metricNames[i] = metric.String()
+	}
+	metricSelect := widget.NewSelect(metricNames, nil)
+	metricSelect.SetSelectedIndex(int(defaults.Metric))
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Method", methodSelect),
+		widget.NewFormItem("Strength (%)", strengthEntry),
+		widget.NewFormItem("Distance", metricSelect),
+	}
+	formItems[0].HintText = "Bayer patterns suit pixel art; Floyd-Steinberg and Atkinson suit photos"
+	formItems[1].HintText = "0 maps each pixel to the nearest color, 100 dithers fully"
+
+	target := "swatch colors"
+	if app.PelCanvas.IsIndexed() {
+		target = "document palette"
+	}
+
+	dialog.ShowForm(fmt.Sprintf("Dither Active Layer (%s)", target), "Dither", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		strength, _ := strconv.Atoi(strengthEntry.Text)
+		opts := dither.Options{
+			Method:   dither.Methods[methodSelect.SelectedIndex()],
+			Strength: float64(strength) / 100,
+			Metric:   palette.Metrics[metricSelect.SelectedIndex()],
+		}
+		if err := app.PelCanvas.Dither(swatchColors(app), opts); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}, app.PelWindow)
+}
+
+// showReduceToPaletteDialog asks for the color distance metric, then remaps
+// every pixel of the drawing to the nearest swatch color
+func showReduceToPaletteDialog(app *AppInit) {
+	if app == nil || app.PelCanvas == nil || len(app.Swatches) == 0 {
+		return
+	}
+
+	metricNames := make([]string, len(palette.Metrics))
+	for i, metric := range palette.Metrics {
+		metricNames[i] = metric.String()
+	}
+	metricSelect := widget.NewSelect(metricNames, nil)
+	metricSelect.SetSelectedIndex(int(palette.MetricOKLab))
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Distance", metricSelect),
+	}
+	formItems[0].HintText = "RGB matches raw values; CIELAB and OKLab match colors as they look"
+
+	target := "swatch colors"
+	if app.PelCanvas.IsIndexed() {
+		target = "document palette"
+	}
+
+	dialog.ShowForm(fmt.Sprintf("Reduce to Palette (%s)", target), "Reduce", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		metric := palette.Metrics[metricSelect.SelectedIndex()]
+		if err := app.PelCanvas.ReduceToPalette(swatchColors(app), metric); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}, app.PelWindow)
+}
+
+// showGeneratePaletteDialog asks for the number of colors and the
+// quantization method, then fills the swatches with a palette generated from
+// the current frame and optionally remaps the drawing to it
+func showGeneratePaletteDialog(app *AppInit) {
+	if app == nil || app.PelCanvas == nil || len(app.Swatches) == 0 {
+		return
+	}
+
+	// The swatches grow to hold an indexed palette
+	maxColors := len(app.Swatches)
+	if app.PelCanvas.IsIndexed() {
+		maxColors = layer.MaxPaletteColors
+	}
+	countEntry := widget.NewEntry()
+	countEntry.SetText(strconv.Itoa(min(DefaultGeneratedColors, maxColors)))
+	countEntry.Validator = rangeValidator("colors", 1, maxColors)
+
+	methodNames := make([]string, len(palette.Methods))
+	for i, method := range palette.Methods {
+		methodNames[i] = method.String()
+	}
+	methodSelect := widget.NewSelect(methodNames, nil)
+	methodSelect.SetSelectedIndex(int(palette.MethodKMeans))
+
+	remapCheck := widget.NewCheck("Remap the drawing to the new colors", nil)
+	if app.PelCanvas.IsIndexed() {
+		// The swatches are the document palette, so the drawing always follows
+		remapCheck.SetChecked(true)
+		remapCheck.Disable()
+	}
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Colors", countEntry),
+		widget.NewFormItem("Method", methodSelect),
+		widget.NewFormItem("", remapCheck),
+	}
+	formItems[1].HintText = "Colors are grouped in OKLab; k-means is slower but closer"
+
+	dialog.ShowForm("Generate Palette", "Generate", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		count, _ := strconv.Atoi(countEntry.Text)
+		method := palette.Methods[methodSelect.SelectedIndex()]
+		if err := generatePalette(app, count, method, remapCheck.Checked); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}, app.PelWindow)
+}
+
+// generatePalette quantizes the current frame to at most count colors and
+// puts them in the swatches, most used first. In indexed color mode they
+// replace the document palette and the drawing is remapped to them.
+func generatePalette(app *AppInit, count int, method palette.Method, remap bool) error {
+	generated, err := palette.Quantize(app.PelCanvas.Flatten(), count, method)
+	if err != nil {
+		return err
+	}
+	colors := make([]color.Color, len(generated))
+	for i, c := range generated {
+		colors[i] = c
+	}
+
+	if app.PelCanvas.IsIndexed() {
+		if err := app.PelCanvas.RemapPalette(colors, palette.MetricOKLab); err != nil {
+			return err
+		}
+	} else {
+		fillSwatches(app, generated)
+		if remap {
+			if err := app.PelCanvas.ReduceToPalette(colors, palette.MetricOKLab); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("Generated palette: %d colors (%s)", len(generated), method)
+	return nil
+}
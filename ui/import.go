@@ -0,0 +1,264 @@
+// Package ui provides sprite sheet and Aseprite import for the Pel pixel art editor.
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"github.com/carlomunguia/pel/aseprite"
+	"github.com/carlomunguia/pel/spritesheet"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Sprite sheet import constants
+const (
+	SlicePreviewSize = 320 // Largest side of the sheet preview in pixels
+	MaxPreviewScale  = 8   // Largest magnification of small sheets in the preview
+	sliceShadeAlpha  = 160 // Opacity of the shade over pixels outside every cell
+)
+
+// Colors of the slicing preview overlay
+var (
+	sliceCutColor   = color.NRGBA{R: 255, G: 0, B: 255, A: 255}
+	sliceShadeColor = color.NRGBA{A: sliceShadeAlpha}
+)
+
+// openAseprite decodes an Aseprite file into frames and layers, loads them
+// into the canvas and fills the swatches from its palette
+func openAseprite(app *AppInit, r io.Reader, path string) error {
+	doc, err := aseprite.Decode(r)
+	if err != nil {
+		return fmt.Errorf("failed to read aseprite file: %w", err)
+	}
+
+	if err := app.PelCanvas.LoadAnimation(doc.Timeline); err != nil {
+		return fmt.Errorf("failed to load frames: %w", err)
+	}
+
+	// Pel cannot write Aseprite files, so saving asks for a new file
+	app.State.SetFilePath("")
+
+	if len(doc.Palette) > 0 {
+		for i, c := range doc.Palette {
+			if i >= len(app.Swatches) {
+				break
+			}
+			app.Swatches[i].SetColor(c)
+		}
+	} else {
+		updateSwatchesFromImage(app, doc.Timeline.Frame(0).Layers.Flatten())
+	}
+
+	cols, rows := doc.Timeline.Size()
+	log.Printf("Opened Aseprite file: %s (%s, %d frames)", path, doc.ColorMode, doc.Timeline.Len())
+	dialog.ShowInformation("Success",
+		fmt.Sprintf("Loaded: %s\nSize: %dx%d\nFrames: %d\nLayers: %d\nColor Mode: %s",
+			filepath.Base(path), cols, rows, doc.Timeline.Len(),
+			doc.Timeline.Frame(0).Layers.Len(), doc.ColorMode),
+		app.PelWindow)
+	return nil
+}
+
+// showImportSpriteSheetDialog asks for a sprite sheet image, then for how to
+// slice it into frames
+func showImportSpriteSheetDialog(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	dialog.ShowFileOpen(func(uri fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to open file: %w", err), app.PelWindow)
+			return
+		}
+		if uri == nil {
+			return
+		}
+		defer uri.Close()
+
+		img, _, err := image.Decode(uri)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to decode image: %w", err), app.PelWindow)
+			return
+		}
+
+		showSliceDialog(app, img, uri.URI().Name())
+	}, app.PelWindow)
+}
+
+// showSliceDialog asks for the cell size, margin, spacing and order of a
+// sprite sheet, previewing the cut lines, and loads the cells as frames
+func showSliceDialog(app *AppInit, img image.Image, name string) {
+	bounds := img.Bounds()
+	cellSize := min(bounds.Dx(), bounds.Dy())
+	maxSize := max(bounds.Dx(), bounds.Dy())
+
+	cellWidthEntry := widget.NewEntry()
+	cellWidthEntry.SetText(strconv.Itoa(cellSize))
+	cellWidthEntry.Validator = rangeValidator("cell width", MinImageSize, min(bounds.Dx(), MaxImageSize))
+
+	cellHeightEntry := widget.NewEntry()
+	cellHeightEntry.SetText(strconv.Itoa(cellSize))
+	cellHeightEntry.Validator = rangeValidator("cell height", MinImageSize, min(bounds.Dy(), MaxImageSize))
+
+	marginEntry := widget.NewEntry()
+	marginEntry.SetText("0")
+	marginEntry.Validator = rangeValidator("margin", 0, maxSize)
+
+	spacingEntry := widget.NewEntry()
+	spacingEntry.SetText("0")
+	spacingEntry.Validator = rangeValidator("spacing", 0, maxSize)
+
+	orderNames := make([]string, len(spritesheet.Orders))
+	for i, order := range spritesheet.Orders {
+		orderNames[i] = order.String()
+	}
+	orderSelect := widget.NewSelect(orderNames, nil)
+	orderSelect.SetSelectedIndex(int(spritesheet.OrderRowMajor))
+
+	skipEmptyCheck := widget.NewCheck("Skip empty cells", nil)
+	skipEmptyCheck.SetChecked(true)
+
+	// The cut lines are drawn at the size of the preview, so that they fall
+	// between the pixels of small sheets and stay visible on large ones
+	scale := max(1, min(SlicePreviewSize/maxSize, MaxPreviewScale))
+	overlaySize := bounds.Size().Mul(scale)
+	if maxSize > SlicePreviewSize {
+		overlaySize = bounds.Size().Mul(SlicePreviewSize).Div(maxSize)
+	}
+	previewSize := fyne.NewSize(float32(overlaySize.X), float32(overlaySize.Y))
+	sheetImage := canvas.NewImageFromImage(img)
+	sheetImage.FillMode = canvas.ImageFillContain
+	sheetImage.ScaleMode = canvas.ImageScalePixels
+	overlayImage := canvas.NewImageFromImage(image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+	overlayImage.FillMode = canvas.ImageFillContain
+	overlayImage.ScaleMode = canvas.ImageScalePixels
+	preview := container.NewGridWrap(previewSize, container.NewStack(sheetImage, overlayImage))
+
+	cellsLabel := widget.NewLabel("")
+
+	// options reads the form, returning an error if any entry is invalid
+	options := func() (spritesheet.SliceOptions, error) {
+		for _, entry := range []*widget.Entry{cellWidthEntry, cellHeightEntry, marginEntry, spacingEntry} {
+			if err := entry.Validate(); err != nil {
+				return spritesheet.SliceOptions{}, err
+			}
+		}
+
+		cellWidth, _ := strconv.Atoi(cellWidthEntry.Text)
+		cellHeight, _ := strconv.Atoi(cellHeightEntry.Text)
+		margin, _ := strconv.Atoi(marginEntry.Text)
+		spacing, _ := strconv.Atoi(spacingEntry.Text)
+		return spritesheet.SliceOptions{
+			CellWidth:  cellWidth,
+			CellHeight: cellHeight,
+			Margin:     margin,
+			Spacing:    spacing,
+			Order:      spritesheet.Orders[orderSelect.SelectedIndex()],
+			SkipEmpty:  skipEmptyCheck.Checked,
+		}, nil
+	}
+
+	updatePreview := func() {
+		opts, err := options()
+		var cells []image.Rectangle
+		if err == nil {
+			cells, err = spritesheet.Cells(bounds, opts)
+		}
+		if err != nil {
+			cellsLabel.SetText(err.Error())
+		} else {
+			cellsLabel.SetText(fmt.Sprintf("%d cells", len(cells)))
+		}
+
+		overlayImage.Image = sliceOverlay(bounds, cells, overlaySize)
+		overlayImage.Refresh()
+	}
+	for _, entry := range []*widget.Entry{cellWidthEntry, cellHeightEntry, marginEntry, spacingEntry} {
+		entry.OnChanged = func(string) { updatePreview() }
+	}
+	orderSelect.OnChanged = func(string) { updatePreview() }
+	updatePreview()
+
+	form := widget.NewForm(
+		widget.NewFormItem("Cell Width", cellWidthEntry),
+		widget.NewFormItem("Cell Height", cellHeightEntry),
+		widget.NewFormItem("Margin", marginEntry),
+		widget.NewFormItem("Spacing", spacingEntry),
+		widget.NewFormItem("Order", orderSelect),
+		widget.NewFormItem("", skipEmptyCheck),
+	)
+	content := container.NewBorder(nil, cellsLabel, nil, nil,
+		container.NewHBox(container.NewCenter(preview), form))
+
+	sliceDialog := dialog.NewCustomConfirm("Import Sprite Sheet", "Import", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		opts, err := options()
+		if err != nil {
+			dialog.ShowError(err, app.PelWindow)
+			return
+		}
+		timeline, err := spritesheet.Slice(img, opts)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to slice sheet: %w", err), app.PelWindow)
+			return
+		}
+		if err := app.PelCanvas.LoadAnimation(timeline); err != nil {
+			dialog.ShowError(fmt.Errorf("failed to load frames: %w", err), app.PelWindow)
+			return
+		}
+
+		// Saving must not overwrite the sheet with a single frame
+		app.State.SetFilePath("")
+		updateSwatchesFromImage(app, img)
+
+		log.Printf("Imported sprite sheet: %s (%d frames)", name, timeline.Len())
+		dialog.ShowInformation("Success",
+			fmt.Sprintf("Imported: %s\nFrame Size: %dx%d\nFrames: %d",
+				filepath.Base(name), opts.CellWidth, opts.CellHeight, timeline.Len()),
+			app.PelWindow)
+	}, app.PelWindow)
+	sliceDialog.Show()
+}
+
+// sliceOverlay draws the outline of every cell and shades the pixels outside
+// them on an image of the given size, stretched over the sheet
+func sliceOverlay(bounds image.Rectangle, cells []image.Rectangle, size image.Point) *image.NRGBA {
+	overlay := image.NewNRGBA(image.Rectangle{Max: size})
+	draw.Draw(overlay, overlay.Rect, image.NewUniform(sliceShadeColor), image.Point{}, draw.Src)
+
+	toOverlay := func(p image.Point) image.Point {
+		p = p.Sub(bounds.Min)
+		return image.Pt(p.X*size.X/bounds.Dx(), p.Y*size.Y/bounds.Dy())
+	}
+	for _, cell := range cells {
+		r := image.Rectangle{Min: toOverlay(cell.Min), Max: toOverlay(cell.Max)}
+		if r.Empty() {
+			continue
+		}
+		draw.Draw(overlay, r, image.Transparent, image.Point{}, draw.Src)
+
+		for x := r.Min.X; x < r.Max.X; x++ {
+			overlay.SetNRGBA(x, r.Min.Y, sliceCutColor)
+			overlay.SetNRGBA(x, r.Max.Y-1, sliceCutColor)
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			overlay.SetNRGBA(r.Min.X, y, sliceCutColor)
+			overlay.SetNRGBA(r.Max.X-1, y, sliceCutColor)
+		}
+	}
+	return overlay
+}
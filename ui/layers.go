@@ -0,0 +1,209 @@
+// Package ui provides the layers panel for the Pel pixel art editor.
+package ui
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"github.com/carlomunguia/pel/pelcanvas/layer"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Layers panel constants
+const (
+	MaxOpacityPercent = 100 // Opacity slider range is 0-100%
+	LayersPanelHeight = 160 // Minimum height of the layer list in pixels
+)
+
+// BuildLayersPanel creates the layers panel: a list of layers, top layer
+// first, with visibility and lock toggles, blend mode and opacity controls
+// for the active layer and buttons for adding, removing, reordering and
+// merging layers
+func BuildLayersPanel(app *AppInit) fyne.CanvasObject {
+	if app == nil || app.PelCanvas == nil {
+		log.Println("Warning: Cannot build layers panel - app or canvas is nil")
+		return container.NewVBox()
+	}
+
+	pelCanvas := app.PelCanvas
+	stack := func() *layer.Stack {
+		return pelCanvas.Layers()
+	}
+
+	// Rows are listed top layer first, the reverse of the stack order
+	rowToIndex := func(row widget.ListItemID) int {
+		return stack().Len() - 1 - row
+	}
+
+	showError := func(err error) {
+		if err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}
+
+	list := widget.NewList(
+		func() int {
+			return stack().Len()
+		},
+		createLayerRow,
+		func(row widget.ListItemID, obj fyne.CanvasObject) {
+			i := rowToIndex(row)
+			if l := stack().Layer(i); l != nil {
+				updateLayerRow(app, l, i, obj)
+			}
+		},
+	)
+	list.OnSelected = func(row widget.ListItemID) {
+		showError(pelCanvas.SetActiveLayer(rowToIndex(row)))
+	}
+
+	// Opacity of the active layer, recorded in the history when the drag ends
+	opacityLabel := widget.NewLabel("")
+	opacitySlider := widget.NewSlider(0, MaxOpacityPercent)
+	opacitySlider.Step = 1
+	opacitySlider.OnChanged = func(value float64) {
+		opacityLabel.SetText(fmt.Sprintf("Opacity: %d%%", int(value)))
+	}
+	opacitySlider.OnChangeEnded = func(value float64) {
+		opacity := uint8(math.Round(value * layer.MaxOpacity / MaxOpacityPercent))
+		if opacity != pelCanvas.ActiveLayer().Opacity {
+			showError(pelCanvas.SetLayerOpacity(stack().ActiveIndex(), opacity))
+		}
+	}
+
+	// Blend mode of the active layer
+	blendNames := make([]string, len(layer.BlendModes))
+	for i, mode := range layer.BlendModes {
+		blendNames[i] = mode.String()
+	}
+	blendSelect := widget.NewSelect(blendNames, nil)
+	onBlendSelected := func(name string) {
+		mode, ok := layer.ParseBlendMode(name)
+		if ok && mode != pelCanvas.ActiveLayer().Blend {
+			showError(pelCanvas.SetLayerBlendMode(stack().ActiveIndex(), mode))
+		}
+	}
+	blendSelect.OnChanged = onBlendSelected
+
+	buttons := container.NewGridWithColumns(3,
+		widget.NewButtonWithIcon("Add", theme.ContentAddIcon(), func() {
+			showError(pelCanvas.AddLayer())
+		}),
+		widget.NewButtonWithIcon("Delete", theme.DeleteIcon(), func() {
+			showError(pelCanvas.DeleteLayer(stack().ActiveIndex()))
+		}),
+		widget.NewButtonWithIcon("Copy", theme.ContentCopyIcon(), func() {
+			showError(pelCanvas.DuplicateLayer(stack().ActiveIndex()))
+		}),
+		widget.NewButtonWithIcon("Up", theme.MoveUpIcon(), func() {
+			if i := stack().ActiveIndex(); i < stack().Len()-1 {
+				showError(pelCanvas.MoveLayer(i, i+1))
+			}
+		}),
+		widget.NewButtonWithIcon("Down", theme.MoveDownIcon(), func() {
+			if i := stack().ActiveIndex(); i > 0 {
+				showError(pelCanvas.MoveLayer(i, i-1))
+			}
+		}),
+		widget.NewButton("Merge", func() {
+			showError(pelCanvas.MergeLayerDown(stack().ActiveIndex()))
+		}),
+	)
+
+	// Keep the list, the opacity slider and the blend mode in sync with the layer stack
+	updatePanel := func() {
+		list.Refresh()
+		list.Select(stack().Len() - 1 - stack().ActiveIndex())
+
+		percent := math.Round(float64(pelCanvas.ActiveLayer().Opacity) * MaxOpacityPercent / layer.MaxOpacity)
+		opacitySlider.Value = percent
+		opacitySlider.Refresh()
+		opacityLabel.SetText(fmt.Sprintf("Opacity: %d%%", int(percent)))
+
+		// Detach the handler while syncing so the update is not recorded
+		blendSelect.OnChanged = nil
+		blendSelect.SetSelected(pelCanvas.ActiveLayer().Blend.String())
+		blendSelect.OnChanged = onBlendSelected
+	}
+	updatePanel()
+	pelCanvas.AddLayerListener(updatePanel)
+
+	title := widget.NewLabelWithStyle("Layers",
+		fyne.TextAlignCenter,
+		fyne.TextStyle{Bold: true})
+
+	controls := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Blend:"), nil, blendSelect),
+		container.NewBorder(nil, nil, opacityLabel, nil, opacitySlider),
+		buttons,
+	)
+
+	listArea := container.NewGridWrap(fyne.NewSize(PickerWidth, LayersPanelHeight), list)
+
+	return container.NewBorder(title, controls, nil, nil, listArea)
+}
+
+// createLayerRow creates the template row for a layer:
+// a visibility toggle, the layer name and a lock toggle
+func createLayerRow() fyne.CanvasObject {
+	visibility := widget.NewButtonWithIcon("", theme.VisibilityIcon(), nil)
+	visibility.Importance = widget.LowImportance
+
+	lock := widget.NewCheck("Lock", nil)
+	name := widget.NewLabel("")
+	name.Truncation = fyne.TextTruncateEllipsis
+
+	return container.NewBorder(nil, nil, visibility, lock, name)
+}
+
+// updateLayerRow fills a layer row with the details of the layer at index i
+func updateLayerRow(app *AppInit, l *layer.Layer, i int, obj fyne.CanvasObject) {
+	row, ok := obj.(*fyne.Container)
+	if !ok || len(row.Objects) < 3 {
+		return
+	}
+
+	var name *widget.Label
+	var visibility *widget.Button
+	var lock *widget.Check
+	for _, child := range row.Objects {
+		switch w := child.(type) {
+		case *widget.Label:
+			name = w
+		case *widget.Button:
+			visibility = w
+		case *widget.Check:
+			lock = w
+		}
+	}
+	if name == nil || visibility == nil || lock == nil {
+		return
+	}
+
+	name.SetText(l.Name)
+
+	if l.Visible {
+		visibility.SetIcon(theme.VisibilityIcon())
+	} else {
+		visibility.SetIcon(theme.VisibilityOffIcon())
+	}
+	visibility.OnTapped = func() {
+		if err := app.PelCanvas.SetLayerVisible(i, !l.Visible); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}
+
+	// Detach the handler while syncing so the update is not recorded
+	lock.OnChanged = nil
+	lock.SetChecked(l.Locked)
+	lock.OnChanged = func(locked bool) {
+		if err := app.PelCanvas.SetLayerLocked(i, locked); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}
+}
@@ -36,6 +36,9 @@ func Setup(app *AppInit) {
 	SetupMenus(app)
 	log.Println("Menus initialized")
 
+	// Setup keyboard handling
+	SetupKeyboard(app)
+
 	// Build color swatch panel
 	swatchesContainer := BuildSwatches(app)
 	if swatchesContainer == nil {
@@ -50,17 +53,27 @@ func Setup(app *AppInit) {
 		colorPicker = container.NewVBox()
 	}
 
+	// Build layers panel below the color picker
+	layersPanel := BuildLayersPanel(app)
+	rightPanel := container.NewBorder(colorPicker, nil, nil, nil, layersPanel)
+
 	// Build toolbar (optional - for future implementation)
 	toolbar := buildToolbar(app)
 
 	// Build status bar (optional - for future implementation)
 	statusBar := buildStatusBar(app)
 
+	// Build history panel (can be hidden from the View menu)
+	app.HistoryPanel = BuildHistoryPanel(app)
+
+	// Build animation timeline (can be hidden from the View menu)
+	app.TimelinePanel = BuildTimeline(app)
+
 	// Create main layout:
 	// - Top: toolbar (if available)
-	// - Bottom: swatches and status bar
-	// - Left: (reserved for future tools panel)
-	// - Right: color picker
+	// - Bottom: timeline, swatches and status bar
+	// - Left: history panel
+	// - Right: color picker and layers
 	// - Center: canvas
 
 	// Combine status bar with swatches if status bar exists
@@ -69,13 +82,16 @@ func Setup(app *AppInit) {
 		bottomContainer = container.NewBorder(statusBar, nil, nil, nil, swatchesContainer)
 	}
 
+	// Place the timeline above the swatches
+	bottomContainer = container.NewBorder(app.TimelinePanel, nil, nil, nil, bottomContainer)
+
 	// Create the main application layout
 	appLayout := container.NewBorder(
-		toolbar,         // top
-		bottomContainer, // bottom
-		nil,             // left (reserved for future tools panel)
-		colorPicker,     // right
-		app.PelCanvas,   // center
+		toolbar,          // top
+		bottomContainer,  // bottom
+		app.HistoryPanel, // left
+		rightPanel,       // right
+		app.PelCanvas,    // center
 	)
 
 	// Set the window content
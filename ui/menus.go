@@ -5,15 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"image"
-	"image/png"
 	"log"
 	"os"
 	"path/filepath"
-	"github.com/carlomunguia/pel/util"
+	"github.com/carlomunguia/pel/aseprite"
+	"github.com/carlomunguia/pel/palette"
 	"strconv"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/widget"
 )
 
@@ -41,7 +42,7 @@ func SetupMenus(app *AppInit) {
 	}
 
 	menus := BuildMenus(app)
-	mainMenu := fyne.NewMainMenu(menus)
+	mainMenu := fyne.NewMainMenu(menus, BuildEditMenu(app), BuildSelectMenu(app), BuildImageMenu(app), BuildPaletteMenu(app), BuildViewMenu(app))
 	app.PelWindow.SetMainMenu(mainMenu)
 	log.Println("Menus initialized successfully")
 }
@@ -52,6 +53,7 @@ func BuildMenus(app *AppInit) *fyne.Menu {
 		"File",
 		BuildNewMenu(app),
 		BuildOpenMenu(app),
+		BuildImportMenu(app),
 		fyne.NewMenuItemSeparator(),
 		BuildSaveMenu(app),
 		BuildSaveAsMenu(app),
@@ -76,6 +78,13 @@ func BuildOpenMenu(app *AppInit) *fyne.MenuItem {
 	})
 }
 
+// BuildImportMenu creates the "Import Sprite Sheet" menu item for slicing an image into frames
+func BuildImportMenu(app *AppInit) *fyne.MenuItem {
+	return fyne.NewMenuItem("Import Sprite Sheet...", func() {
+		showImportSpriteSheetDialog(app)
+	})
+}
+
 // BuildSaveMenu creates the "Save" menu item
 func BuildSaveMenu(app *AppInit) *fyne.MenuItem {
 	return fyne.NewMenuItem("Save", func() {
@@ -90,12 +99,18 @@ func BuildSaveAsMenu(app *AppInit) *fyne.MenuItem {
 	})
 }
 
-// BuildExportMenu creates the "Export" menu item for exporting to different formats
+// BuildExportMenu creates the "Export" submenu for exporting to different formats
 func BuildExportMenu(app *AppInit) *fyne.MenuItem {
-	return fyne.NewMenuItem("Export...", func() {
-		// TODO: Implement export with format options (JPEG, GIF, etc.)
-		dialog.ShowInformation("Export", "Export feature coming soon!", app.PelWindow)
-	})
+	item := fyne.NewMenuItem("Export", nil)
+	item.ChildMenu = fyne.NewMenu("",
+		fyne.NewMenuItem("Animated GIF...", func() {
+			showGIFExportDialog(app)
+		}),
+		fyne.NewMenuItem("Sprite Sheet...", func() {
+			showSpriteSheetExportDialog(app)
+		}),
+	)
+	return item
 }
 
 // BuildQuitMenu creates the "Quit" menu item
@@ -105,6 +120,125 @@ func BuildQuitMenu(app *AppInit) *fyne.MenuItem {
 	})
 }
 
+// BuildEditMenu constructs the Edit menu with undo and redo.
+// The menu items are kept in sync with the canvas history.
+func BuildEditMenu(app *AppInit) *fyne.Menu {
+	undoItem := BuildUndoMenu(app)
+	redoItem := BuildRedoMenu(app)
+	editMenu := fyne.NewMenu("Edit", undoItem, redoItem, fyne.NewMenuItemSeparator())
+	editMenu.Items = append(editMenu.Items, buildClipboardItems(app)...)
+	editMenu.Items = append(editMenu.Items, fyne.NewMenuItemSeparator())
+	editMenu.Items = append(editMenu.Items, buildToolOptionsItems(app)...)
+
+	if app == nil || app.PelCanvas == nil {
+		return editMenu
+	}
+
+	updateItems := func() {
+		history := app.PelCanvas.History()
+		undoItem.Label = historyMenuLabel("Undo", history.UndoName())
+		undoItem.Disabled = !history.CanUndo()
+		redoItem.Label = historyMenuLabel("Redo", history.RedoName())
+		redoItem.Disabled = !history.CanRedo()
+		editMenu.Refresh()
+	}
+	updateItems()
+	app.PelCanvas.AddHistoryListener(updateItems)
+
+	return editMenu
+}
+
+// BuildUndoMenu creates the "Undo" menu item (Ctrl+Z)
+func BuildUndoMenu(app *AppInit) *fyne.MenuItem {
+	item := fyne.NewMenuItem("Undo", func() {
+		undo(app)
+	})
+	item.Shortcut = &fyne.ShortcutUndo{}
+	return item
+}
+
+// BuildRedoMenu creates the "Redo" menu item (Ctrl+Shift+Z, Ctrl+Y is registered separately)
+func BuildRedoMenu(app *AppInit) *fyne.MenuItem {
+	item := fyne.NewMenuItem("Redo", func() {
+		redo(app)
+	})
+	item.Shortcut = &desktop.CustomShortcut{
+		KeyName:  fyne.KeyZ,
+		Modifier: fyne.KeyModifierShortcutDefault | fyne.KeyModifierShift,
+	}
+	return item
+}
+
+// historyMenuLabel appends the name of the affected action to a menu label
+func historyMenuLabel(label, actionName string) string {
+	if actionName == "" {
+		return label
+	}
+	return fmt.Sprintf("%s %s", label, actionName)
+}
+
+// undo reverts the most recent canvas action
+func undo(app *AppInit) {
+	if app == nil || app.PelCanvas == nil || !app.PelCanvas.History().CanUndo() {
+		return
+	}
+
+	if err := app.PelCanvas.Undo(); err != nil {
+		dialog.ShowError(err, app.PelWindow)
+	}
+}
+
+// redo reapplies the most recently undone canvas action
+func redo(app *AppInit) {
+	if app == nil || app.PelCanvas == nil || !app.PelCanvas.History().CanRedo() {
+		return
+	}
+
+	if err := app.PelCanvas.Redo(); err != nil {
+		dialog.ShowError(err, app.PelWindow)
+	}
+}
+
+// BuildViewMenu constructs the View menu for showing and hiding panels
+func BuildViewMenu(app *AppInit) *fyne.Menu {
+	viewMenu := fyne.NewMenu("View")
+
+	historyItem := fyne.NewMenuItem("History Panel", nil)
+	historyItem.Checked = true
+	historyItem.Action = func() {
+		if app == nil || app.HistoryPanel == nil {
+			return
+		}
+
+		historyItem.Checked = !historyItem.Checked
+		if historyItem.Checked {
+			app.HistoryPanel.Show()
+		} else {
+			app.HistoryPanel.Hide()
+		}
+		viewMenu.Refresh()
+	}
+
+	timelineItem := fyne.NewMenuItem("Timeline", nil)
+	timelineItem.Checked = true
+	timelineItem.Action = func() {
+		if app == nil || app.TimelinePanel == nil {
+			return
+		}
+
+		timelineItem.Checked = !timelineItem.Checked
+		if timelineItem.Checked {
+			app.TimelinePanel.Show()
+		} else {
+			app.TimelinePanel.Hide()
+		}
+		viewMenu.Refresh()
+	}
+
+	viewMenu.Items = append(viewMenu.Items, historyItem, timelineItem)
+	return viewMenu
+}
+
 // showNewImageDialog displays a dialog for creating a new image
 func showNewImageDialog(app *AppInit) {
 	if app == nil {
@@ -187,6 +321,30 @@ func showOpenFileDialog(app *AppInit) {
 		}
 		defer uri.Close()
 
+		// Native project files restore layers, swatches and settings
+		if isProjectPath(uri.URI().Path()) {
+			if err := openProject(app, uri, uri.URI().Path()); err != nil {
+				dialog.ShowError(err, app.PelWindow)
+			}
+			return
+		}
+
+		// GIFs are split into one frame per GIF frame
+		if isGIFPath(uri.URI().Path()) {
+			if err := openGIF(app, uri, uri.URI().Path()); err != nil {
+				dialog.ShowError(err, app.PelWindow)
+			}
+			return
+		}
+
+		// Aseprite files keep their frames, layers, tags and palette
+		if aseprite.IsAsepritePath(uri.URI().Path()) {
+			if err := openAseprite(app, uri, uri.URI().Path()); err != nil {
+				dialog.ShowError(err, app.PelWindow)
+			}
+			return
+		}
+
 		// Decode image
 		img, format, err := image.Decode(uri)
 		if err != nil {
@@ -257,8 +415,8 @@ func showSaveFileDialog(app *AppInit) {
 		}
 		defer uri.Close()
 
-		// Encode and write image
-		if err := png.Encode(uri, app.PelCanvas.PixelData); err != nil {
+		// Encode and write image (or project, for .pel files)
+		if err := writeDocument(app, uri, uri.URI().Path()); err != nil {
 			dialog.ShowError(fmt.Errorf("failed to encode image: %w", err), app.PelWindow)
 			return
 		}
@@ -291,35 +449,32 @@ func saveImageToFile(app *AppInit, filePath string) error {
 		}
 	}()
 
-	// Encode image
-	if err := png.Encode(file, app.PelCanvas.PixelData); err != nil {
+	// Encode as a project for .pel files, otherwise flatten the visible layers into a PNG
+	if err := writeDocument(app, file, filePath); err != nil {
 		return fmt.Errorf("failed to encode image: %w", err)
 	}
 
 	return nil
 }
 
-// updateSwatchesFromImage extracts colors from the image and updates swatches
+// updateSwatchesFromImage fills the swatches with a palette quantized from
+// the image, most used colors first. Swatches left over are reset to the
+// default color. In indexed color mode the swatches already show the
+// document palette.
 func updateSwatchesFromImage(app *AppInit, img image.Image) {
 	if app == nil || img == nil || len(app.Swatches) == 0 {
 		return
 	}
+	if app.PelCanvas != nil && app.PelCanvas.IsIndexed() {
+		return
+	}
 
-	// Use the updated GetImageColors function with error handling
-	imgColors, err := util.GetImageColors(img)
+	colors, err := palette.Quantize(img, len(app.Swatches), palette.MethodKMeans)
 	if err != nil {
 		log.Printf("Warning: Failed to extract colors: %v", err)
 		return
 	}
+	fillSwatches(app, colors)
 
-	i := 0
-	for c := range imgColors {
-		if i >= len(app.Swatches) {
-			break
-		}
-		app.Swatches[i].SetColor(c)
-		i++
-	}
-
-	log.Printf("Updated %d swatches from image colors", i)
+	log.Printf("Updated %d swatches from image colors", len(colors))
 }
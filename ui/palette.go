@@ -0,0 +1,240 @@
+// Package ui provides palette file import and export for the Pel pixel art editor.
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"github.com/carlomunguia/pel/palette"
+	"github.com/carlomunguia/pel/pelcanvas"
+	"github.com/carlomunguia/pel/util"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// BuildPaletteMenu constructs the Palette menu for loading and saving the
+// swatches and switching between RGB and indexed color mode
+func BuildPaletteMenu(app *AppInit) *fyne.Menu {
+	paletteMenu := fyne.NewMenu("Palette",
+		fyne.NewMenuItem("Import Palette...", func() {
+			showImportPaletteDialog(app)
+		}),
+		fyne.NewMenuItem("Export Palette...", func() {
+			showExportPaletteDialog(app)
+		}),
+		fyne.NewMenuItemSeparator(),
+	)
+
+	lockItem := fyne.NewMenuItem("Lock to Palette", nil)
+	lockItem.Checked = app != nil && app.State != nil && app.State.LockToPalette
+	lockItem.Action = func() {
+		if app == nil || app.State == nil {
+			return
+		}
+
+		lockItem.Checked = !lockItem.Checked
+		app.State.SetLockToPalette(lockItem.Checked)
+		paletteMenu.Refresh()
+	}
+
+	indexedItem := fyne.NewMenuItem(pelcanvas.IndexedModeName, func() {
+		toggleIndexedMode(app)
+	})
+	paletteMenu.Items = append(paletteMenu.Items, lockItem, indexedItem)
+
+	if app != nil && app.State != nil {
+		app.AddSettingsListener(func() {
+			lockItem.Checked = app.State.LockToPalette
+			paletteMenu.Refresh()
+		})
+	}
+	if app != nil && app.PelCanvas != nil {
+		app.PelCanvas.AddPaletteListener(func() {
+			indexedItem.Checked = app.PelCanvas.IsIndexed()
+			paletteMenu.Refresh()
+			syncSwatchesToPalette(app)
+		})
+	}
+	return paletteMenu
+}
+
+// toggleIndexedMode switches the drawing between RGB and indexed color mode.
+// Converting to indexed mode uses the swatches as the palette.
+func toggleIndexedMode(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	var err error
+	if app.PelCanvas.IsIndexed() {
+		err = app.PelCanvas.ConvertToRGB()
+	} else {
+		err = app.PelCanvas.ConvertToIndexed(swatchColors(app))
+	}
+	if err != nil {
+		dialog.ShowError(err, app.PelWindow)
+	}
+}
+
+// syncSwatchesToPalette shows the document palette in the swatches while the
+// drawing is in indexed color mode. Swatch i shows palette entry i+1, after
+// the reserved transparent entry; swatches past the end of the palette are
+// reset to the default color. The panel grows to hold palettes with more
+// than MaxSwatches colors and shrinks back in RGB mode.
+func syncSwatchesToPalette(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+	if !app.PelCanvas.IsIndexed() {
+		resizeSwatches(app, MaxSwatches)
+		return
+	}
+
+	p := app.PelCanvas.Palette()
+	resizeSwatches(app, max(MaxSwatches, len(p)-1))
+	for i, s := range app.Swatches {
+		if s == nil {
+			continue
+		}
+		if i+1 < len(p) {
+			s.SetColor(p[i+1])
+		} else {
+			s.SetColor(DefaultSwatchColor)
+		}
+	}
+
+	// Keep painting with the selected palette entry
+	if selected := GetSelectedSwatch(app); selected != nil {
+		app.State.SetBrushColor(selected.Color)
+	}
+}
+
+// showImportPaletteDialog asks for a palette file and loads it into the swatches
+func showImportPaletteDialog(app *AppInit) {
+	if app == nil || len(app.Swatches) == 0 {
+		return
+	}
+
+	openDialog := dialog.NewFileOpen(func(uri fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("failed to open file: %w", err), app.PelWindow)
+			return
+		}
+		if uri == nil {
+			return
+		}
+		defer uri.Close()
+
+		if err := importPalette(app, uri, uri.URI().Path()); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}, app.PelWindow)
+
+	openDialog.SetFilter(storage.NewExtensionFileFilter(paletteExtensions()))
+	openDialog.Show()
+}
+
+// importPalette reads a palette in the format implied by the path and
+// replaces the swatches with its colors. Swatches past the end of the
+// palette are reset to the default color.
+func importPalette(app *AppInit, r io.Reader, path string) error {
+	format, ok := palette.FormatForPath(path)
+	if !ok {
+		return fmt.Errorf("%w: %s", palette.ErrInvalidFormat, filepath.Ext(path))
+	}
+
+	p, err := palette.Decode(r, format)
+	if err != nil {
+		return err
+	}
+
+	// In indexed color mode the palette colors replace the document palette,
+	// recoloring the drawing; the swatches follow the palette
+	if app.PelCanvas != nil && app.PelCanvas.IsIndexed() {
+		colors := make([]color.Color, len(p.Colors))
+		for i, c := range p.Colors {
+			colors[i] = c
+		}
+		if err := app.PelCanvas.SetPaletteColors(colors); err != nil {
+			return err
+		}
+
+		log.Printf("Imported palette into the document: %s (%d colors)", path, len(p.Colors))
+		dialog.ShowInformation("Success",
+			fmt.Sprintf("Loaded: %s\nColors: %d", filepath.Base(path), len(p.Colors)),
+			app.PelWindow)
+		return nil
+	}
+
+	fillSwatches(app, p.Colors)
+	loaded := min(len(p.Colors), len(app.Swatches))
+
+	log.Printf("Imported palette: %s (%d colors)", path, len(p.Colors))
+	message := fmt.Sprintf("Loaded: %s\nColors: %d", filepath.Base(path), len(p.Colors))
+	if loaded < len(p.Colors) {
+		message += fmt.Sprintf("\nOnly the first %d colors fit in the swatches", loaded)
+	}
+	dialog.ShowInformation("Success", message, app.PelWindow)
+	return nil
+}
+
+// showExportPaletteDialog asks for the palette format, then for the file to
+// write the swatches to
+func showExportPaletteDialog(app *AppInit) {
+	if app == nil || len(app.Swatches) == 0 {
+		return
+	}
+
+	formatNames := make([]string, len(palette.Formats))
+	for i, format := range palette.Formats {
+		formatNames[i] = fmt.Sprintf("%s (%s)", format, format.Extension())
+	}
+	formatSelect := widget.NewSelect(formatNames, nil)
+	formatSelect.SetSelectedIndex(int(palette.FormatGPL))
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Format", formatSelect),
+	}
+	formItems[0].HintText = "Trailing swatches left at the default color are not exported"
+
+	dialog.ShowForm("Export Palette", "Export", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		format := palette.Formats[formatSelect.SelectedIndex()]
+		fileName := exportFileName(app, format.Extension())
+		p := palette.FromColors(strings.TrimSuffix(fileName, format.Extension()), usedSwatchColors(app))
+		showExportFileDialog(app, format.Extension(), func(w io.Writer) error {
+			return palette.Encode(w, p, format)
+		})
+	}, app.PelWindow)
+}
+
+// usedSwatchColors returns the swatch colors up to the last swatch that is
+// not the default color, keeping at least one
+func usedSwatchColors(app *AppInit) []color.Color {
+	colors := swatchColors(app)
+	end := 1
+	for i, c := range colors {
+		if !util.ColorsEqual(c, DefaultSwatchColor) {
+			end = i + 1
+		}
+	}
+	return colors[:min(end, len(colors))]
+}
+
+// paletteExtensions lists the file extensions of every palette format
+func paletteExtensions() []string {
+	extensions := make([]string, len(palette.Formats))
+	for i, format := range palette.Formats {
+		extensions[i] = format.Extension()
+	}
+	return extensions
+}
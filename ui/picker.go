@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"image/color"
 	"log"
+	"github.com/carlomunguia/pel/palette"
+	"github.com/carlomunguia/pel/swatch"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -96,13 +98,24 @@ func handleColorChange(app *AppInit, c color.Color, preview *canvas.Rectangle, c
 		return
 	}
 
-	// Update application state using setter method
-	app.State.SetBrushColor(c)
-
-	// Update the current swatch if valid
-	if err := updateCurrentSwatch(app, c); err != nil {
-		log.Printf("Warning: Failed to update swatch: %v", err)
-		// Continue anyway - this is not critical
+	if app.State.LockToPalette {
+		// Colors are locked to the palette: pick the nearest swatch instead
+		// of editing the selected one
+		if nearest := nearestSwatch(app, c); nearest != nil {
+			c = nearest.Color
+			swatch.SelectSwatch(nearest, app.Swatches)
+			app.State.SetSwatchSelected(nearest.SwatchIndex)
+		}
+		app.State.SetBrushColor(c)
+	} else {
+		// Update application state using setter method
+		app.State.SetBrushColor(c)
+
+		// Update the current swatch if valid
+		if err := updateCurrentSwatch(app, c); err != nil {
+			log.Printf("Warning: Failed to update swatch: %v", err)
+			// Continue anyway - this is not critical
+		}
 	}
 
 	// Update preview
@@ -137,9 +150,38 @@ func updateCurrentSwatch(app *AppInit, c color.Color) error {
 	}
 
 	swatch.SetColor(c)
+
+	// In indexed color mode the swatches are the palette, so editing one
+	// recolors every pixel using that palette entry
+	if app.PelCanvas != nil && app.PelCanvas.IsIndexed() {
+		if selectedIndex+1 < len(app.PelCanvas.Palette()) {
+			return app.PelCanvas.SetPaletteColor(selectedIndex+1, c)
+		}
+		// The swatch is past the end of the palette; grow the palette up to it
+		return app.PelCanvas.SetPaletteColors(swatchColors(app)[:selectedIndex+1])
+	}
 	return nil
 }
 
+// nearestSwatch returns the swatch whose color is perceptually closest to c,
+// or nil if there are no swatches
+func nearestSwatch(app *AppInit, c color.Color) *swatch.Swatch {
+	swatches := make([]*swatch.Swatch, 0, len(app.Swatches))
+	colors := make([]color.Color, 0, len(app.Swatches))
+	for _, s := range app.Swatches {
+		if s != nil {
+			swatches = append(swatches, s)
+			colors = append(colors, s.Color)
+		}
+	}
+
+	i := palette.NewMatcher(colors, palette.MetricOKLab).Nearest(c)
+	if i < 0 {
+		return nil
+	}
+	return swatches[i]
+}
+
 // formatColorInfo returns a human-readable string representation of a color
 func formatColorInfo(c color.Color) string {
 	if c == nil {
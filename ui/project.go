@@ -0,0 +1,93 @@
+// Package ui provides native project file handling for the Pel pixel art editor.
+package ui
+
+import (
+	"fmt"
+	"image/png"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+	"github.com/carlomunguia/pel/project"
+	"github.com/carlomunguia/pel/swatch"
+)
+
+// isProjectPath returns true if the path names a native .pel project file
+func isProjectPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), project.FileExtension)
+}
+
+// writeDocument encodes the drawing to w in the format implied by the file
+// path: a .pel project keeps frames, layers, swatches and settings, a .gif
+// keeps the frames as a looping animation, anything else is written as a PNG
+// of the current frame's visible layers flattened. Drawings in indexed color
+// mode are written as indexed PNGs with the document palette.
+func writeDocument(app *AppInit, w io.Writer, path string) error {
+	// Floating pixels are part of the drawing once saved
+	app.PelCanvas.CommitSelection()
+
+	if isProjectPath(path) {
+		return project.Encode(w, buildProject(app))
+	}
+	if isGIFPath(path) {
+		return animation.EncodeGIF(w, app.PelCanvas.Timeline(), animation.GIFOptions{Loops: animation.GIFLoopForever})
+	}
+	if indexed := app.PelCanvas.FlattenIndexed(); indexed != nil {
+		return png.Encode(w, indexed)
+	}
+	return png.Encode(w, app.PelCanvas.Flatten())
+}
+
+// buildProject collects the canvas, swatches and settings into a project
+func buildProject(app *AppInit) *project.Project {
+	return &project.Project{
+		Config:   app.PelCanvas.PelCanvasConfig,
+		Timeline: app.PelCanvas.Timeline(),
+		Swatches: swatchColors(app),
+		Palette:  app.PelCanvas.Palette(),
+		State:    *app.State,
+	}
+}
+
+// openProject decodes a project file and applies it to the application
+func openProject(app *AppInit, r io.Reader, path string) error {
+	p, err := project.Decode(r)
+	if err != nil {
+		return fmt.Errorf("failed to read project: %w", err)
+	}
+
+	if err := app.PelCanvas.LoadTimeline(p.Timeline, p.Palette); err != nil {
+		return fmt.Errorf("failed to load frames: %w", err)
+	}
+	app.PelCanvas.RestoreView(p.Config)
+
+	// Restore the swatch palette; swatches not stored in the file are left as is
+	for i, c := range p.Swatches {
+		if i >= len(app.Swatches) {
+			break
+		}
+		app.Swatches[i].SetColor(c)
+	}
+
+	// Restore brush and tool settings
+	app.State.SetBrushColor(p.State.BrushColor)
+	app.State.SetBrushType(p.State.BrushType)
+	app.State.SetFillOptions(p.State.FillOptions)
+	app.State.SetShapeOptions(p.State.ShapeOptions)
+	app.State.SetLockToPalette(p.State.LockToPalette)
+	app.State.SetWandOptions(p.State.WandOptions)
+	if err := app.PelCanvas.SetOnionSkin(p.State.OnionSkin); err != nil {
+		log.Printf("Warning: Failed to restore onion skin: %v", err)
+	}
+	if selected := app.GetSwatch(p.State.SwatchSelected); selected != nil {
+		app.State.SetSwatchSelected(p.State.SwatchSelected)
+		swatch.SelectSwatch(selected, app.Swatches)
+	}
+	app.settingsRestored()
+
+	app.State.SetFilePath(path)
+
+	log.Printf("Opened project: %s (%d frames)", path, p.Timeline.Len())
+	return nil
+}
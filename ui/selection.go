@@ -0,0 +1,253 @@
+// Package ui provides the Select menu and clipboard commands for the Pel pixel art editor.
+package ui
+
+import (
+	"strconv"
+	"github.com/carlomunguia/pel/apptype"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+)
+
+// selectionTools lists the selection tools offered by the Select menu
+var selectionTools = []struct {
+	brushType apptype.BrushType
+	label     string
+}{
+	{apptype.BrushTypeMarquee, "Rectangle Marquee"},
+	{apptype.BrushTypeLasso, "Lasso"},
+	{apptype.BrushTypeMagicWand, "Magic Wand"},
+}
+
+// BuildSelectMenu constructs the Select menu for choosing a selection tool
+// and changing the selection
+func BuildSelectMenu(app *AppInit) *fyne.Menu {
+	selectMenu := fyne.NewMenu("Select")
+
+	// The tool in use before a selection tool, restored when it is switched off
+	previousTool := apptype.BrushTypePencil
+
+	toolItems := make([]*fyne.MenuItem, len(selectionTools))
+	for i, tool := range selectionTools {
+		toolItems[i] = fyne.NewMenuItem(tool.label, func() {
+			if app == nil || app.State == nil || app.PelCanvas == nil {
+				return
+			}
+
+			switch {
+			case app.State.BrushType == tool.brushType:
+				app.PelCanvas.CommitSelection()
+				app.State.SetBrushType(previousTool)
+			case !app.State.BrushType.IsSelection():
+				previousTool = app.State.BrushType
+				fallthrough
+			default:
+				app.State.SetBrushType(tool.brushType)
+			}
+			for i, item := range toolItems {
+				item.Checked = app.State.BrushType == selectionTools[i].brushType
+			}
+			selectMenu.Refresh()
+		})
+		toolItems[i].Checked = app != nil && app.State != nil && app.State.BrushType == tool.brushType
+	}
+
+	wandOptionsItem := fyne.NewMenuItem("Magic Wand Options...", func() {
+		showWandOptionsDialog(app)
+	})
+
+	selectAllItem := fyne.NewMenuItem("Select All", func() {
+		if app != nil && app.PelCanvas != nil {
+			app.PelCanvas.SelectAll()
+		}
+	})
+	selectAllItem.Shortcut = &fyne.ShortcutSelectAll{}
+
+	deselectItem := fyne.NewMenuItem("Deselect", func() {
+		if app != nil && app.PelCanvas != nil {
+			app.PelCanvas.Deselect()
+		}
+	})
+	deselectItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyD, Modifier: fyne.KeyModifierShortcutDefault}
+
+	selectMenu.Items = append(selectMenu.Items, toolItems...)
+	selectMenu.Items = append(selectMenu.Items,
+		wandOptionsItem,
+		fyne.NewMenuItemSeparator(),
+		selectAllItem,
+		deselectItem,
+		fyne.NewMenuItemSeparator(),
+		buildTransformMenu(app, true),
+	)
+	return selectMenu
+}
+
+// showWandOptionsDialog asks for the magic wand tolerance and whether it
+// selects only connected pixels
+func showWandOptionsDialog(app *AppInit) {
+	if app == nil || app.State == nil {
+		return
+	}
+
+	opts := app.State.WandOptions
+	toleranceEntry := widget.NewEntry()
+	toleranceEntry.SetText(strconv.Itoa(opts.Tolerance))
+	toleranceEntry.Validator = rangeValidator("tolerance", apptype.MinFillTolerance, apptype.MaxFillTolerance)
+
+	contiguousCheck := widget.NewCheck("Contiguous", nil)
+	contiguousCheck.SetChecked(opts.Contiguous)
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Tolerance", toleranceEntry),
+		widget.NewFormItem("", contiguousCheck),
+	}
+	formItems[0].HintText = "Largest difference per channel from the clicked color"
+	formItems[1].HintText = "Select only pixels connected to the clicked one"
+
+	dialog.ShowForm("Magic Wand Options", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		opts.Tolerance, _ = strconv.Atoi(toleranceEntry.Text)
+		opts.Contiguous = contiguousCheck.Checked
+		app.State.SetWandOptions(opts)
+	}, app.PelWindow)
+}
+
+// buildClipboardItems creates the Cut, Copy, Paste and Delete items of the Edit menu
+func buildClipboardItems(app *AppInit) []*fyne.MenuItem {
+	cutItem := fyne.NewMenuItem("Cut", func() {
+		cutSelection(app)
+	})
+	cutItem.Shortcut = &fyne.ShortcutCut{}
+
+	copyItem := fyne.NewMenuItem("Copy", func() {
+		copySelection(app)
+	})
+	copyItem.Shortcut = &fyne.ShortcutCopy{}
+
+	pasteItem := fyne.NewMenuItem("Paste", func() {
+		pasteSelection(app)
+	})
+	pasteItem.Shortcut = &fyne.ShortcutPaste{}
+
+	deleteItem := fyne.NewMenuItem("Delete", func() {
+		deleteSelection(app)
+	})
+
+	copyColorsItem := fyne.NewMenuItem("Copy Colors as Hex", func() {
+		copyColors(app)
+	})
+
+	return []*fyne.MenuItem{cutItem, copyItem, copyColorsItem, pasteItem, deleteItem}
+}
+
+// cutSelection moves the selected pixels to the clipboard
+func cutSelection(app *AppInit) {
+	if app == nil || app.PelCanvas == nil || !app.PelCanvas.HasSelection() {
+		return
+	}
+
+	img := app.PelCanvas.ClipboardImage()
+	if err := app.PelCanvas.Cut(); err != nil {
+		dialog.ShowError(err, app.PelWindow)
+		return
+	}
+	writeSystemClipboard(app, img)
+}
+
+// copySelection copies the selected pixels, or the active layer, to the
+// clipboard. The system clipboard gets the selected pixels or the whole
+// canvas as a PNG image.
+func copySelection(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	if err := app.PelCanvas.Copy(); err != nil {
+		dialog.ShowError(err, app.PelWindow)
+		return
+	}
+	writeSystemClipboard(app, app.PelCanvas.ClipboardImage())
+}
+
+// copyColors puts the colors of the selected pixels, or of the whole canvas,
+// on the system clipboard as a list of hex colors
+func copyColors(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	if err := writeHexColors(app.PelCanvas.ClipboardImage()); err != nil {
+		dialog.ShowError(err, app.PelWindow)
+	}
+}
+
+// pasteSelection pastes an image copied in another application, or else the
+// pixels copied in Pel, as a floating selection
+func pasteSelection(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	if img, err := readSystemClipboard(app); err == nil {
+		if err := pasteImage(app, img); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+		return
+	}
+
+	if err := app.PelCanvas.Paste(); err != nil {
+		dialog.ShowError(err, app.PelWindow)
+	}
+}
+
+// deleteSelection clears the selected pixels
+func deleteSelection(app *AppInit) {
+	if app == nil || app.PelCanvas == nil || !app.PelCanvas.HasSelection() {
+		return
+	}
+
+	if err := app.PelCanvas.DeleteSelection(); err != nil {
+		dialog.ShowError(err, app.PelWindow)
+	}
+}
+
+// handleSelectionKey handles keys typed on the canvas that act on the
+// selection: Delete and Backspace clear it, Escape deselects, Return drops
+// floating pixels and the arrow keys nudge the selected pixels
+func handleSelectionKey(app *AppInit, ev *fyne.KeyEvent) {
+	if app == nil || app.PelCanvas == nil || ev == nil || !app.PelCanvas.HasSelection() {
+		return
+	}
+
+	var dx, dy int
+	switch ev.Name {
+	case fyne.KeyDelete, fyne.KeyBackspace:
+		deleteSelection(app)
+		return
+	case fyne.KeyEscape:
+		app.PelCanvas.Deselect()
+		return
+	case fyne.KeyReturn, fyne.KeyEnter:
+		app.PelCanvas.CommitSelection()
+		return
+	case fyne.KeyLeft:
+		dx = -1
+	case fyne.KeyRight:
+		dx = 1
+	case fyne.KeyUp:
+		dy = -1
+	case fyne.KeyDown:
+		dy = 1
+	default:
+		return
+	}
+
+	if err := app.PelCanvas.MoveSelection(dx, dy); err != nil {
+		dialog.ShowError(err, app.PelWindow)
+	}
+}
@@ -0,0 +1,33 @@
+// Package ui provides keyboard handling for the Pel pixel art editor.
+package ui
+
+import (
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// SetupKeyboard connects window-level keyboard events to the canvas
+func SetupKeyboard(app *AppInit) {
+	if app == nil || app.PelWindow == nil || app.PelCanvas == nil {
+		log.Println("Warning: Cannot setup keyboard - app, window or canvas is nil")
+		return
+	}
+
+	// Forward key presses so shape tools can track Shift/Alt while dragging
+	if deskCanvas, ok := app.PelWindow.Canvas().(desktop.Canvas); ok {
+		deskCanvas.SetOnKeyDown(app.PelCanvas.KeyDown)
+		deskCanvas.SetOnKeyUp(app.PelCanvas.KeyUp)
+	}
+
+	// Keys without modifiers act on the selection
+	app.PelWindow.Canvas().SetOnTypedKey(func(ev *fyne.KeyEvent) {
+		handleSelectionKey(app, ev)
+	})
+
+	// Ctrl+Y is an alternative to the Redo menu shortcut (Ctrl+Shift+Z)
+	app.PelWindow.Canvas().AddShortcut(&fyne.ShortcutRedo{}, func(fyne.Shortcut) {
+		redo(app)
+	})
+}
@@ -0,0 +1,123 @@
+// Package ui provides the Canvas Size and Image Size dialogs for the Pel pixel art editor.
+package ui
+
+import (
+	"strconv"
+	"github.com/carlomunguia/pel/transform"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// anchorLabels marks the anchor buttons with arrows pointing at the edge or
+// corner that stays in place, in the order of transform.Anchors
+var anchorLabels = []string{"↖", "↑", "↗", "←", "•", "→", "↙", "↓", "↘"}
+
+// showCanvasSizeDialog asks for a new canvas size and anchor, then crops or
+// extends the canvas without scaling the drawing
+func showCanvasSizeDialog(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	cols, rows := app.PelCanvas.GetCanvasSize()
+	widthEntry, heightEntry := newSizeEntries(cols, rows)
+	anchor := transform.AnchorCenter
+	anchorGrid := newAnchorPicker(&anchor)
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Width", widthEntry),
+		widget.NewFormItem("Height", heightEntry),
+		widget.NewFormItem("Anchor", anchorGrid),
+	}
+	formItems[2].HintText = "Part of the drawing that stays in place; new pixels are transparent"
+
+	dialog.ShowForm("Canvas Size", "Resize", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		width, _ := strconv.Atoi(widthEntry.Text)
+		height, _ := strconv.Atoi(heightEntry.Text)
+		if err := app.PelCanvas.ResizeCanvas(width, height, anchor); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}, app.PelWindow)
+}
+
+// showImageSizeDialog asks for a new image size and scaling filter, then
+// scales the whole drawing
+func showImageSizeDialog(app *AppInit) {
+	if app == nil || app.PelCanvas == nil {
+		return
+	}
+
+	cols, rows := app.PelCanvas.GetCanvasSize()
+	widthEntry, heightEntry := newSizeEntries(cols, rows)
+
+	filterNames := make([]string, len(transform.Filters))
+	for i, filter := range transform.Filters {
+		filterNames[i] = filter.String()
+	}
+	filterSelect := widget.NewSelect(filterNames, nil)
+	filterSelect.SetSelectedIndex(int(transform.FilterNearest))
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Width", widthEntry),
+		widget.NewFormItem("Height", heightEntry),
+		widget.NewFormItem("Filter", filterSelect),
+	}
+	formItems[2].HintText = "EPX keeps the palette; xBR smooths outlines with new colors"
+
+	dialog.ShowForm("Image Size", "Scale", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		width, _ := strconv.Atoi(widthEntry.Text)
+		height, _ := strconv.Atoi(heightEntry.Text)
+		filter := transform.Filters[filterSelect.SelectedIndex()]
+		if err := app.PelCanvas.ScaleImage(width, height, filter); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}, app.PelWindow)
+}
+
+// newSizeEntries creates width and height entries filled with the current size
+func newSizeEntries(cols, rows int) (*widget.Entry, *widget.Entry) {
+	widthEntry := widget.NewEntry()
+	widthEntry.SetText(strconv.Itoa(cols))
+	widthEntry.Validator = rangeValidator("width", MinImageSize, MaxImageSize)
+
+	heightEntry := widget.NewEntry()
+	heightEntry.SetText(strconv.Itoa(rows))
+	heightEntry.Validator = rangeValidator("height", MinImageSize, MaxImageSize)
+
+	return widthEntry, heightEntry
+}
+
+// newAnchorPicker creates a 3 x 3 grid of buttons that sets anchor to the
+// anchor of the button pressed, highlighting it
+func newAnchorPicker(anchor *transform.Anchor) fyne.CanvasObject {
+	buttons := make([]*widget.Button, len(transform.Anchors))
+	grid := container.NewGridWithColumns(3)
+	for i, a := range transform.Anchors {
+		buttons[i] = widget.NewButton(anchorLabels[i], func() {
+			*anchor = a
+			for j, button := range buttons {
+				button.Importance = widget.MediumImportance
+				if transform.Anchors[j] == a {
+					button.Importance = widget.HighImportance
+				}
+				button.Refresh()
+			}
+		})
+		if a == *anchor {
+			buttons[i].Importance = widget.HighImportance
+		}
+		grid.Add(buttons[i])
+	}
+	return container.NewHBox(grid)
+}
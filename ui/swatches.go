@@ -8,14 +8,16 @@ import (
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 )
 
 // Swatch panel constants
 const (
-	MaxSwatches    = 64  // Maximum number of color swatches
+	MaxSwatches    = 64  // Number of color swatches outside indexed color mode
 	SwatchGridSize = 20  // Size of each swatch in the grid
 	SwatchesPerRow = 8   // Number of swatches per row
+	SwatchRows     = 3   // Rows of swatches shown before the panel scrolls
 	DefaultSwatchR = 255 // Default red value
 	DefaultSwatchG = 255 // Default green value
 	DefaultSwatchB = 255 // Default blue value
@@ -75,11 +77,14 @@ func BuildSwatches(app *AppInit) *fyne.Container {
 
 	log.Printf("Created %d swatches", len(app.Swatches))
 
-	// Create swatch grid
+	// Create swatch grid, scrolling when an indexed palette needs more rows
 	swatchGrid := container.NewGridWrap(
 		fyne.NewSize(SwatchGridSize, SwatchGridSize),
 		canvasSwatches...,
 	)
+	app.swatchGrid = swatchGrid
+	swatchScroll := container.NewVScroll(swatchGrid)
+	swatchScroll.SetMinSize(fyne.NewSize(0, SwatchRows*(SwatchGridSize+theme.Padding())))
 
 	// Create titled container
 	title := widget.NewLabelWithStyle("Color Palette",
@@ -91,12 +96,38 @@ func BuildSwatches(app *AppInit) *fyne.Container {
 		nil,
 		nil,
 		nil,
-		swatchGrid,
+		swatchScroll,
 	)
 
 	return swatchPanel
 }
 
+// resizeSwatches adds default colored swatches to the panel, or removes
+// those at the end, until there are count of them. Removing the selected
+// swatch selects the first one.
+func resizeSwatches(app *AppInit, count int) {
+	if app == nil || app.swatchGrid == nil || count < 1 || count == len(app.Swatches) {
+		return
+	}
+
+	for i := len(app.Swatches); i < count; i++ {
+		s := createSwatch(app, i)
+		app.Swatches = append(app.Swatches, s)
+		app.swatchGrid.Add(s)
+	}
+	if count < len(app.Swatches) {
+		app.Swatches = app.Swatches[:count]
+		app.swatchGrid.Objects = app.swatchGrid.Objects[:count]
+		app.swatchGrid.Refresh()
+	}
+
+	if app.State.SwatchSelected >= count {
+		app.State.SetSwatchSelected(0)
+		swatch.SelectSwatch(app.Swatches[0], app.Swatches)
+	}
+	log.Printf("Resized swatch panel to %d swatches", count)
+}
+
 // createSwatch creates a single swatch with the proper click handler
 func createSwatch(app *AppInit, index int) *swatch.Swatch {
 	if app == nil || app.State == nil {
@@ -178,6 +209,32 @@ func GetSelectedSwatch(app *AppInit) *swatch.Swatch {
 	return app.Swatches[index]
 }
 
+// swatchColors returns the colors of every swatch in order
+func swatchColors(app *AppInit) []color.Color {
+	colors := make([]color.Color, 0, len(app.Swatches))
+	for _, s := range app.Swatches {
+		if s != nil {
+			colors = append(colors, s.Color)
+		}
+	}
+	return colors
+}
+
+// fillSwatches sets the swatches to the given colors in order and resets
+// the remaining swatches to the default color
+func fillSwatches(app *AppInit, colors []color.NRGBA) {
+	for i, s := range app.Swatches {
+		if s == nil {
+			continue
+		}
+		if i < len(colors) {
+			s.SetColor(colors[i])
+		} else {
+			s.SetColor(DefaultSwatchColor)
+		}
+	}
+}
+
 // ClearSwatches resets all swatches to default color
 func ClearSwatches(app *AppInit) {
 	if app == nil || len(app.Swatches) == 0 {
@@ -0,0 +1,395 @@
+// Package ui provides the animation timeline for the Pel pixel art editor.
+package ui
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"strconv"
+	"time"
+	"github.com/carlomunguia/pel/apptype"
+	"github.com/carlomunguia/pel/pelcanvas"
+	"github.com/carlomunguia/pel/pelcanvas/animation"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Timeline constants
+const (
+	FrameThumbnailSize = 48  // Size of each frame thumbnail in the timeline
+	TimelineHeight     = 90  // Minimum height of the frame strip in pixels
+	DurationEntryWidth = 70  // Width of the frame duration entry in pixels
+	MaxOnionPercent    = 100 // Onion skin opacity slider range is 0-100%
+)
+
+// BuildTimeline creates the timeline strip: a row of frame thumbnails,
+// buttons for adding, duplicating, deleting, reordering and tagging frames,
+// the duration of the current frame, a play/pause preview and onion skin controls
+func BuildTimeline(app *AppInit) fyne.CanvasObject {
+	if app == nil || app.PelCanvas == nil {
+		log.Println("Warning: Cannot build timeline - app or canvas is nil")
+		return container.NewVBox()
+	}
+
+	pelCanvas := app.PelCanvas
+	timeline := func() *animation.Timeline {
+		return pelCanvas.Timeline()
+	}
+
+	showError := func(err error) {
+		if err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}
+
+	// Frame thumbnails, rebuilt when the number of frames changes
+	frames := container.NewHBox()
+	strip := container.NewHScroll(frames)
+	strip.SetMinSize(fyne.NewSize(0, TimelineHeight))
+
+	durationEntry := widget.NewEntry()
+	durationEntry.OnSubmitted = func(text string) {
+		duration, err := strconv.Atoi(text)
+		if err != nil {
+			showError(fmt.Errorf("invalid frame duration: %q", text))
+			return
+		}
+		if duration != timeline().Current().Duration {
+			showError(pelCanvas.SetFrameDuration(pelCanvas.CurrentFrame(), duration))
+		}
+	}
+	durationLabel := widget.NewLabel("")
+
+	player := &framePlayer{pelCanvas: pelCanvas}
+	playButton := widget.NewButtonWithIcon("", theme.MediaPlayIcon(), nil)
+	playButton.OnTapped = func() {
+		if player.playing() {
+			player.stop()
+			playButton.SetIcon(theme.MediaPlayIcon())
+		} else {
+			player.start()
+			playButton.SetIcon(theme.MediaPauseIcon())
+		}
+	}
+
+	updateTimeline := func() {
+		updateFrameCells(app, frames)
+		durationEntry.SetText(strconv.Itoa(timeline().Current().Duration))
+		durationLabel.SetText(fmt.Sprintf("Frame %d/%d", pelCanvas.CurrentFrame()+1, timeline().Len()))
+	}
+	updateTimeline()
+	pelCanvas.AddFrameListener(updateTimeline)
+	pelCanvas.AddHistoryListener(updateTimeline)
+
+	controls := container.NewHBox(
+		playButton,
+		widget.NewButtonWithIcon("", theme.ContentAddIcon(), func() {
+			showError(pelCanvas.AddFrame())
+		}),
+		widget.NewButtonWithIcon("", theme.ContentCopyIcon(), func() {
+			showError(pelCanvas.DuplicateFrame(pelCanvas.CurrentFrame()))
+		}),
+		widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+			showError(pelCanvas.DeleteFrame(pelCanvas.CurrentFrame()))
+		}),
+		widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() {
+			if i := pelCanvas.CurrentFrame(); i > 0 {
+				showError(pelCanvas.MoveFrame(i, i-1))
+			}
+		}),
+		widget.NewButtonWithIcon("", theme.NavigateNextIcon(), func() {
+			if i := pelCanvas.CurrentFrame(); i < timeline().Len()-1 {
+				showError(pelCanvas.MoveFrame(i, i+1))
+			}
+		}),
+		widget.NewButton("Tags", func() {
+			showTagsDialog(app)
+		}),
+		durationLabel,
+		container.NewGridWrap(fyne.NewSize(DurationEntryWidth, durationEntry.MinSize().Height), durationEntry),
+		widget.NewLabel("ms"),
+		widget.NewSeparator(),
+		buildOnionSkinControls(app),
+	)
+
+	return container.NewBorder(controls, nil, nil, nil, strip)
+}
+
+// buildOnionSkinControls creates the onion skin toggle, the number of frames
+// shown either side, their opacity and the previous and next frame tints
+func buildOnionSkinControls(app *AppInit) fyne.CanvasObject {
+	pelCanvas := app.PelCanvas
+	restoring := false // Controls are being set from restored settings
+	update := func(change func(opts *apptype.OnionSkinOptions)) {
+		if restoring {
+			return
+		}
+		opts := app.State.OnionSkin
+		change(&opts)
+		if err := pelCanvas.SetOnionSkin(opts); err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}
+
+	enabled := widget.NewCheck("Onion Skin", func(checked bool) {
+		update(func(opts *apptype.OnionSkinOptions) { opts.Enabled = checked })
+	})
+
+	counts := make([]string, 0, apptype.MaxOnionFrames)
+	for n := 1; n <= apptype.MaxOnionFrames; n++ {
+		counts = append(counts, strconv.Itoa(n))
+	}
+	frameCount := widget.NewSelect(counts, func(selected string) {
+		n, err := strconv.Atoi(selected)
+		if err != nil {
+			return
+		}
+		update(func(opts *apptype.OnionSkinOptions) {
+			opts.Before = n
+			opts.After = n
+		})
+	})
+
+	opacity := widget.NewSlider(0, MaxOnionPercent)
+	opacity.Step = 1
+	opacity.OnChangeEnded = func(value float64) {
+		update(func(opts *apptype.OnionSkinOptions) {
+			opts.Opacity = uint8(math.Round(value * math.MaxUint8 / MaxOnionPercent))
+		})
+	}
+
+	// Show the current settings, again whenever a project restores them
+	show := func() {
+		restoring = true
+		defer func() { restoring = false }()
+
+		opts := app.State.OnionSkin
+		enabled.SetChecked(opts.Enabled)
+		frameCount.SetSelected(strconv.Itoa(max(opts.Before, opts.After, 1)))
+		opacity.SetValue(math.Round(float64(opts.Opacity) * MaxOnionPercent / math.MaxUint8))
+	}
+	show()
+	app.AddSettingsListener(show)
+
+	tintButton := func(label string, tint func(opts *apptype.OnionSkinOptions) *color.NRGBA) *widget.Button {
+		return widget.NewButton(label, func() {
+			picker := dialog.NewColorPicker(label, "Onion skin tint; transparency sets its strength",
+				func(c color.Color) {
+					update(func(opts *apptype.OnionSkinOptions) {
+						*tint(opts) = color.NRGBAModel.Convert(c).(color.NRGBA)
+					})
+				}, app.PelWindow)
+			picker.Advanced = true
+			picker.SetColor(*tint(&app.State.OnionSkin))
+			picker.Show()
+		})
+	}
+
+	return container.NewHBox(
+		enabled,
+		frameCount,
+		container.NewGridWrap(fyne.NewSize(PickerWidth/2, opacity.MinSize().Height), opacity),
+		tintButton("Prev Tint", func(opts *apptype.OnionSkinOptions) *color.NRGBA { return &opts.PrevTint }),
+		tintButton("Next Tint", func(opts *apptype.OnionSkinOptions) *color.NRGBA { return &opts.NextTint }),
+	)
+}
+
+// showTagsDialog lists the frame tags with buttons to remove them and a form
+// for tagging a range of frames. Frame numbers shown to the user start at 1.
+func showTagsDialog(app *AppInit) {
+	pelCanvas := app.PelCanvas
+	tagList := container.NewVBox()
+
+	showError := func(err error) {
+		if err != nil {
+			dialog.ShowError(err, app.PelWindow)
+		}
+	}
+
+	var updateTags func()
+	updateTags = func() {
+		tagList.Objects = nil
+		tags := pelCanvas.Timeline().Tags()
+		if len(tags) == 0 {
+			tagList.Add(widget.NewLabel("No tags"))
+		}
+		for _, tag := range tags {
+			name := tag.Name
+			label := widget.NewLabel(fmt.Sprintf("%s: frames %d-%d, %s", tag.Name, tag.From+1, tag.To+1, tag.Direction))
+			remove := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+				showError(pelCanvas.RemoveFrameTag(name))
+				updateTags()
+			})
+			tagList.Add(container.NewBorder(nil, nil, nil, remove, label))
+		}
+		tagList.Refresh()
+	}
+	updateTags()
+
+	current := strconv.Itoa(pelCanvas.CurrentFrame() + 1)
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("walk")
+	fromEntry := widget.NewEntry()
+	fromEntry.SetText(current)
+	toEntry := widget.NewEntry()
+	toEntry.SetText(current)
+
+	directionNames := make([]string, len(animation.Directions))
+	for i, d := range animation.Directions {
+		directionNames[i] = d.String()
+	}
+	directionSelect := widget.NewSelect(directionNames, nil)
+	directionSelect.SetSelectedIndex(int(animation.DirectionForward))
+
+	addButton := widget.NewButtonWithIcon("Add Tag", theme.ContentAddIcon(), func() {
+		from, errFrom := strconv.Atoi(fromEntry.Text)
+		to, errTo := strconv.Atoi(toEntry.Text)
+		if errFrom != nil || errTo != nil {
+			showError(fmt.Errorf("frame numbers must be integers"))
+			return
+		}
+
+		tag := animation.Tag{
+			Name:      nameEntry.Text,
+			From:      from - 1,
+			To:        to - 1,
+			Direction: animation.Directions[directionSelect.SelectedIndex()],
+		}
+		if err := pelCanvas.AddFrameTag(tag); err != nil {
+			showError(err)
+			return
+		}
+		nameEntry.SetText("")
+		updateTags()
+	})
+
+	form := widget.NewForm(
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("From", fromEntry),
+		widget.NewFormItem("To", toEntry),
+		widget.NewFormItem("Direction", directionSelect),
+	)
+
+	content := container.NewVBox(tagList, widget.NewSeparator(), form, addButton)
+	dialog.ShowCustom("Frame Tags", "Close", content, app.PelWindow)
+}
+
+// updateFrameCells syncs the frame thumbnails with the timeline, highlighting
+// the current frame. Thumbnails are not redrawn during playback.
+func updateFrameCells(app *AppInit, frames *fyne.Container) {
+	pelCanvas := app.PelCanvas
+	timeline := pelCanvas.Timeline()
+
+	for len(frames.Objects) < timeline.Len() {
+		frames.Add(createFrameCell())
+	}
+	if len(frames.Objects) > timeline.Len() {
+		frames.Objects = frames.Objects[:timeline.Len()]
+	}
+
+	for i, f := range timeline.Frames() {
+		cell := frames.Objects[i].(*fyne.Container)
+		button := cell.Objects[0].(*widget.Button)
+		content := cell.Objects[1].(*fyne.Container)
+		thumbnail := content.Objects[0].(*canvas.Image)
+		label := content.Objects[1].(*widget.Label)
+
+		index := i
+		button.OnTapped = func() {
+			if err := pelCanvas.SetCurrentFrame(index); err != nil {
+				dialog.ShowError(err, app.PelWindow)
+			}
+		}
+		if i == timeline.CurrentIndex() {
+			button.Importance = widget.HighImportance
+		} else {
+			button.Importance = widget.LowImportance
+		}
+		button.Refresh()
+
+		if !pelCanvas.IsPlaying() || thumbnail.Image == nil {
+			thumbnail.Image = pelcanvas.Thumbnail(f.Layers.Flatten(), FrameThumbnailSize)
+			thumbnail.Refresh()
+		}
+		label.SetText(fmt.Sprintf("%d · %dms", i+1, f.Duration))
+	}
+	frames.Refresh()
+}
+
+// createFrameCell creates a frame cell: a button behind the frame thumbnail
+// and its number and duration
+func createFrameCell() fyne.CanvasObject {
+	button := widget.NewButton("", nil)
+
+	thumbnail := canvas.NewImageFromImage(nil)
+	thumbnail.ScaleMode = canvas.ImageScalePixels
+	thumbnail.FillMode = canvas.ImageFillContain
+	thumbnail.SetMinSize(fyne.NewSize(FrameThumbnailSize, FrameThumbnailSize))
+
+	label := widget.NewLabel("")
+	label.Alignment = fyne.TextAlignCenter
+
+	return container.NewStack(button, container.NewVBox(thumbnail, label))
+}
+
+// framePlayer previews the animation by advancing the current frame after
+// each frame's duration. Timers hand every step back to the UI goroutine.
+type framePlayer struct {
+	pelCanvas *pelcanvas.PelCanvas
+	timer     *time.Timer
+}
+
+// playing returns true while the preview is running
+func (player *framePlayer) playing() bool {
+	return player.timer != nil
+}
+
+// start begins the preview loop from the current frame
+func (player *framePlayer) start() {
+	if player.playing() {
+		return
+	}
+	player.pelCanvas.SetPlaying(true)
+	player.schedule()
+}
+
+// stop ends the preview, leaving the canvas on the frame it reached
+func (player *framePlayer) stop() {
+	if !player.playing() {
+		return
+	}
+	player.timer.Stop()
+	player.timer = nil
+	player.pelCanvas.SetPlaying(false)
+}
+
+// schedule shows the next frame once the current frame's duration has passed
+func (player *framePlayer) schedule() {
+	duration := time.Duration(player.pelCanvas.Timeline().Current().Duration) * time.Millisecond
+
+	var timer *time.Timer
+	timer = time.AfterFunc(duration, func() {
+		fyne.Do(func() {
+			// Ignore steps from a preview that has since been stopped
+			if player.timer != timer {
+				return
+			}
+
+			timeline := player.pelCanvas.Timeline()
+			next := (timeline.CurrentIndex() + 1) % timeline.Len()
+			if err := player.pelCanvas.SetCurrentFrame(next); err != nil {
+				log.Printf("Playback stopped: %v", err)
+				player.stop()
+				return
+			}
+			player.schedule()
+		})
+	})
+	player.timer = timer
+}
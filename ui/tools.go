@@ -0,0 +1,108 @@
+// Package ui provides the tool options dialogs for the Pel pixel art editor.
+package ui
+
+import (
+	"strconv"
+	"github.com/carlomunguia/pel/apptype"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// fillConnectivities lists the fill connectivity choices in the order shown
+var fillConnectivities = []apptype.FillConnectivity{
+	apptype.FillConnectivity4,
+	apptype.FillConnectivity8,
+}
+
+// buildToolOptionsItems creates the tool options items of the Edit menu
+func buildToolOptionsItems(app *AppInit) []*fyne.MenuItem {
+	fillOptionsItem := fyne.NewMenuItem("Fill Options...", func() {
+		showFillOptionsDialog(app)
+	})
+
+	shapeOptionsItem := fyne.NewMenuItem("Shape Options...", func() {
+		showShapeOptionsDialog(app)
+	})
+
+	return []*fyne.MenuItem{fillOptionsItem, shapeOptionsItem}
+}
+
+// showFillOptionsDialog asks for the fill connectivity, tolerance and
+// whether every matching pixel is filled
+func showFillOptionsDialog(app *AppInit) {
+	if app == nil || app.State == nil {
+		return
+	}
+
+	opts := app.State.FillOptions
+	connectivityNames := make([]string, len(fillConnectivities))
+	for i, connectivity := range fillConnectivities {
+		connectivityNames[i] = connectivity.String()
+	}
+	connectivitySelect := widget.NewSelect(connectivityNames, nil)
+	connectivitySelect.SetSelected(opts.Connectivity.String())
+
+	toleranceEntry := widget.NewEntry()
+	toleranceEntry.SetText(strconv.Itoa(opts.Tolerance))
+	toleranceEntry.Validator = rangeValidator("tolerance", apptype.MinFillTolerance, apptype.MaxFillTolerance)
+
+	globalCheck := widget.NewCheck("Global", nil)
+	globalCheck.SetChecked(opts.Global)
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("Connectivity", connectivitySelect),
+		widget.NewFormItem("Tolerance", toleranceEntry),
+		widget.NewFormItem("", globalCheck),
+	}
+	formItems[0].HintText = "8-way also fills through diagonal gaps"
+	formItems[1].HintText = "Largest difference per channel from the clicked color"
+	formItems[2].HintText = "Fill every matching pixel, not just the connected region"
+
+	dialog.ShowForm("Fill Options", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		if i := connectivitySelect.SelectedIndex(); i >= 0 {
+			opts.Connectivity = fillConnectivities[i]
+		}
+		opts.Tolerance, _ = strconv.Atoi(toleranceEntry.Text)
+		opts.Global = globalCheck.Checked
+		app.State.SetFillOptions(opts)
+	}, app.PelWindow)
+}
+
+// showShapeOptionsDialog asks whether rectangles and ellipses are filled
+// and for the width of their outline
+func showShapeOptionsDialog(app *AppInit) {
+	if app == nil || app.State == nil {
+		return
+	}
+
+	opts := app.State.ShapeOptions
+	filledCheck := widget.NewCheck("Filled", nil)
+	filledCheck.SetChecked(opts.Filled)
+
+	strokeEntry := widget.NewEntry()
+	strokeEntry.SetText(strconv.Itoa(opts.StrokeWidth))
+	strokeEntry.Validator = rangeValidator("stroke width", apptype.MinStrokeWidth, apptype.MaxStrokeWidth)
+
+	formItems := []*widget.FormItem{
+		widget.NewFormItem("", filledCheck),
+		widget.NewFormItem("Stroke Width", strokeEntry),
+	}
+	formItems[0].HintText = "Fill the shape instead of drawing its outline"
+	formItems[1].HintText = "Outline thickness in pixels, ignored when filled"
+
+	dialog.ShowForm("Shape Options", "OK", "Cancel", formItems, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		opts.Filled = filledCheck.Checked
+		opts.StrokeWidth, _ = strconv.Atoi(strokeEntry.Text)
+		app.State.SetShapeOptions(opts)
+	}, app.PelWindow)
+}
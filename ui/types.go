@@ -23,6 +23,13 @@ type AppInit struct {
 	PelWindow fyne.Window          // The application's main window
 	State     *apptype.State       // Global application state
 	Swatches  []*swatch.Swatch     // Color palette swatches
+
+	HistoryPanel  fyne.CanvasObject // Dockable history panel (nil until the layout is built)
+	TimelinePanel fyne.CanvasObject // Animation timeline strip (nil until the layout is built)
+
+	copiedImage       []byte          // PNG last put on the system clipboard by Copy or Cut
+	settingsListeners []func()        // Called after settings are restored from a project
+	swatchGrid        *fyne.Container // Grid holding the swatches (nil until the layout is built)
 }
 
 // NewAppInit creates a new AppInit instance with the provided components.
@@ -181,6 +188,22 @@ func (a *AppInit) RefreshCanvas() error {
 	return nil
 }
 
+// AddSettingsListener registers a function called whenever brush and tool
+// settings are restored from a project, so controls can show the new values.
+func (a *AppInit) AddSettingsListener(listener func()) {
+	if a == nil || listener == nil {
+		return
+	}
+	a.settingsListeners = append(a.settingsListeners, listener)
+}
+
+// settingsRestored notifies every settings listener
+func (a *AppInit) settingsRestored() {
+	for _, listener := range a.settingsListeners {
+		listener()
+	}
+}
+
 // Cleanup performs cleanup operations before shutdown.
 // This can be extended to clean up resources, save state, etc.
 func (a *AppInit) Cleanup() error {
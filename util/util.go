@@ -145,12 +145,14 @@ func ColorToRGBA(c color.Color) (r, g, b, a uint8) {
 
 // ColorToHex converts a color to a hex string.
 // Returns format "#RRGGBB" or "#RRGGBBAA" if alpha < 255.
+// Channels are non-premultiplied so the result round-trips through HexToColor.
 func ColorToHex(c color.Color) string {
 	if c == nil {
 		return "#000000"
 	}
 
-	r, g, b, a := ColorToRGBA(c)
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	r, g, b, a := nrgba.R, nrgba.G, nrgba.B, nrgba.A
 
 	if a == 255 {
 		return fmt.Sprintf("#%02X%02X%02X", r, g, b)